@@ -0,0 +1,96 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+// peersHashAnnotation is the annotation of this pod holding the revision of
+// the peers its hooks last succeeded for.
+const peersHashAnnotation = "peer-finder.io/peers-hash"
+
+// annotationObserver annotates this pod with the revision of the peers after
+// each successful run of a hook, so that pods which converged on the same
+// peers share it. Pods are patched in the background like the ConfigMap is
+// written.
+type annotationObserver struct {
+	client    kubernetes.Interface
+	namespace string
+	pod       string
+	revision  string
+	pending   chan string
+}
+
+// newAnnotationObserver returns an annotationObserver patching the pod named
+// pod in ns until ctx is cancelled.
+func newAnnotationObserver(ctx context.Context, client kubernetes.Interface, ns, pod string) *annotationObserver {
+	o := &annotationObserver{client: client, namespace: ns, pod: pod, pending: make(chan string, 1)}
+	go o.run(ctx)
+	return o
+}
+
+func (o *annotationObserver) applying(_ *peerfinder.Update, u peerfinder.Update) {
+	o.revision = peersRevision(u.Peers)
+}
+
+func (o *annotationObserver) hookRan(_ *hook, err error) {
+	if err != nil {
+		return
+	}
+	// Replace the revision waiting to be written, if any.
+	select {
+	case <-o.pending:
+	default:
+	}
+	o.pending <- o.revision
+}
+
+// run patches the pending revision until ctx is cancelled, retrying failed
+// patches.
+func (o *annotationObserver) run(ctx context.Context) {
+	var revision, written string
+	var retry <-chan time.Time
+	for {
+		select {
+		case revision = <-o.pending:
+		case <-retry:
+		case <-ctx.Done():
+			return
+		}
+		retry = nil
+		if revision == written {
+			continue
+		}
+		pctx, cancel := context.WithTimeout(ctx, configMapTimeout)
+		err := kube.AnnotatePod(pctx, o.client, o.namespace, o.pod, peersHashAnnotation, revision)
+		cancel()
+		if err != nil {
+			slog.Warn("Failed to annotate the pod with the peers, retrying", "in", configMapRetry, "err", err)
+			retry = time.After(configMapRetry)
+			continue
+		}
+		written = revision
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAnnotationObserver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"}})
+	o := newAnnotationObserver(ctx, client, "default", "web-0")
+
+	annotation := func() string {
+		p, err := client.CoreV1().Pods("default").Get(ctx, "web-0", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.Annotations[peersHashAnnotation]
+	}
+	o.applying(nil, testUpdate)
+	o.hookRan(nil, errors.New("exit status 1"))
+	time.Sleep(50 * time.Millisecond)
+	if got := annotation(); got != "" {
+		t.Errorf("expected no annotation after a failed hook, got %q", got)
+	}
+
+	o.hookRan(nil, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for annotation() != peersRevision(testUpdate.Peers) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the pod to be annotated with %s, got %q", peersRevision(testUpdate.Peers), annotation())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
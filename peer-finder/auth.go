@@ -0,0 +1,161 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// apiAuth are the flags securing the HTTP and gRPC APIs of serve with TLS,
+// client certificates and a bearer token.
+type apiAuth struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	tokenFile    string
+
+	tls   *tls.Config
+	token []byte
+}
+
+func (a *apiAuth) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&a.certFile, "tls-cert-file", "", "A PEM encoded certificate, followed by its intermediates, the APIs are served over TLS with. Plain HTTP and gRPC are served if empty.")
+	fs.StringVar(&a.keyFile, "tls-key-file", "", "The PEM encoded private key of -tls-cert-file.")
+	fs.StringVar(&a.clientCAFile, "tls-client-ca-file", "", "A PEM bundle of the CAs clients must present a certificate signed by, for mutual TLS.")
+	fs.StringVar(&a.tokenFile, "token-file", "", "A file holding the bearer token clients must send in the Authorization header, or the authorization metadata with gRPC. /healthz, /readyz and /metrics are not authenticated, for probes and scrapers.")
+}
+
+// load reads the certificates and token the flags point to.
+func (a *apiAuth) load() error {
+	if (a.certFile == "") != (a.keyFile == "") {
+		return errors.New("-tls-cert-file and -tls-key-file must be set together")
+	}
+	if a.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(a.certFile, a.keyFile)
+		if err != nil {
+			return err
+		}
+		a.tls = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	if a.clientCAFile != "" {
+		if a.tls == nil {
+			return errors.New("-tls-client-ca-file requires -tls-cert-file")
+		}
+		pem, err := os.ReadFile(a.clientCAFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in %s", a.clientCAFile)
+		}
+		a.tls.ClientCAs, a.tls.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	}
+	if a.tokenFile != "" {
+		token, err := os.ReadFile(a.tokenFile)
+		if err != nil {
+			return err
+		}
+		if a.token = []byte(strings.TrimSpace(string(token))); len(a.token) == 0 {
+			return fmt.Errorf("empty token in %s", a.tokenFile)
+		}
+	}
+	return nil
+}
+
+// authorized returns whether header, the Authorization header or metadata of
+// a request, holds the bearer token.
+func (a *apiAuth) authorized(header string) bool {
+	if a.token == nil {
+		return true
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), a.token) == 1
+}
+
+// handler requires the bearer token for the requests to h.
+func (a *apiAuth) handler(h http.Handler) http.Handler {
+	if a.token == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="peer-finder"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serve serves srv on l, over TLS if configured.
+func (a *apiAuth) serve(srv *http.Server, l net.Listener) error {
+	if a.tls == nil {
+		return srv.Serve(l)
+	}
+	srv.TLSConfig = a.tls
+	return srv.ServeTLS(l, "", "")
+}
+
+// grpcOptions returns the options of the gRPC server enforcing TLS and the
+// bearer token.
+func (a *apiAuth) grpcOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if a.tls != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(a.tls)))
+	}
+	if a.token != nil {
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := a.checkMetadata(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := a.checkMetadata(ss.Context()); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}))
+	}
+	return opts
+}
+
+func (a *apiAuth) checkMetadata(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("authorization"); len(v) == 1 && a.authorized(v[0]) {
+		return nil
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing bearer token")
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/contrib/peer-finder/pkg/api"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// writeCert writes a certificate for name signed by parent, self-signed if
+// nil, and its key to dir, returning their paths.
+func writeCert(t *testing.T, dir, name string, parent *tls.Certificate) (string, string, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, any(key)
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestAPIAuthLoad(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeCert(t, dir, "localhost", nil)
+	empty := filepath.Join(dir, "empty")
+	os.WriteFile(empty, []byte("\n"), 0600)
+	cases := []struct {
+		auth  apiAuth
+		valid bool
+	}{
+		{apiAuth{}, true},
+		{apiAuth{certFile: certFile, keyFile: keyFile, clientCAFile: certFile}, true},
+		{apiAuth{certFile: certFile}, false},
+		{apiAuth{clientCAFile: certFile}, false},
+		{apiAuth{certFile: certFile, keyFile: keyFile, clientCAFile: keyFile}, false},
+		{apiAuth{tokenFile: empty}, false},
+	}
+	for _, c := range cases {
+		if err := c.auth.load(); (err == nil) != c.valid {
+			t.Errorf("%+v: expected valid %v, got %v", c.auth, c.valid, err)
+		}
+	}
+}
+
+func TestAPIAuthHandler(t *testing.T) {
+	a := &apiAuth{token: []byte("secret")}
+	server := httptest.NewServer(a.handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	defer server.Close()
+	for header, expected := range map[string]int{
+		"Bearer secret": http.StatusOK,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"":              http.StatusUnauthorized,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Authorization", header)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("%q: expected %d, got %d", header, expected, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIAuthGRPC(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _, ca := writeCert(t, dir, "ca", nil)
+	certFile, keyFile, _ := writeCert(t, dir, "localhost", &ca)
+	_, _, client := writeCert(t, dir, "client", &ca)
+	tokenFile := filepath.Join(dir, "token")
+	os.WriteFile(tokenFile, []byte("secret\n"), 0600)
+	a := &apiAuth{certFile: certFile, keyFile: keyFile, clientCAFile: caFile, tokenFile: tokenFile}
+	if err := a.load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pf, err := peerfinder.New(peerfinder.Config{Service: "nginx", Domain: "default.svc.cluster.local", Hostname: "web-0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr := "unix:" + filepath.Join(dir, "grpc.sock")
+	if err := serveGRPC(ctx, addr, newPeerStore(pf), a.grpcOptions()...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	cases := []struct {
+		certs []tls.Certificate
+		token string
+		code  codes.Code
+	}{
+		{[]tls.Certificate{client}, "Bearer secret", codes.OK},
+		{[]tls.Certificate{client}, "Bearer wrong", codes.Unauthenticated},
+		{nil, "Bearer secret", codes.Unavailable},
+	}
+	for _, c := range cases {
+		creds := credentials.NewTLS(&tls.Config{RootCAs: pool, ServerName: "localhost", Certificates: c.certs})
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = api.NewPeerFinderClient(conn).ListPeers(metadata.AppendToOutgoingContext(ctx, "authorization", c.token), &api.ListPeersRequest{})
+		if code := status.Code(err); code != c.code {
+			t.Errorf("client certificate %v, token %q: expected %v, got %v", c.certs != nil, c.token, c.code, err)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+// seenPeersAnnotation is the annotation of the pods holding the revision of
+// the peers they found, for -barrier.
+const seenPeersAnnotation = "peer-finder.io/seen-peers-hash"
+
+// barrierRetry is how long to wait before checking again whether the peers
+// agree on the membership.
+const barrierRetry = 2 * time.Second
+
+// barrier holds the peers back until all of them found the same ones. Each
+// pod publishes the revision of the peers it found as an annotation, so that
+// the others can tell whether they agree.
+type barrier struct {
+	client    kubernetes.Interface
+	namespace string
+	pod       string
+	// published is the revision last annotated.
+	published string
+}
+
+// converged publishes the peers of u as found by this pod and returns nil if
+// all of them found the same ones, an error listing the others otherwise.
+func (b *barrier) converged(ctx context.Context, u peerfinder.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, configMapTimeout)
+	defer cancel()
+	revision := peersRevision(u.Peers)
+	if revision != b.published {
+		if err := kube.AnnotatePod(ctx, b.client, b.namespace, b.pod, seenPeersAnnotation, revision); err != nil {
+			return fmt.Errorf("cannot publish the peers found: %v", err)
+		}
+		b.published = revision
+	}
+	seen, err := kube.PeerAnnotations(ctx, b.client, b.namespace, u.Peers, seenPeersAnnotation)
+	if err != nil {
+		return err
+	}
+	var behind []string
+	for _, p := range u.Peers {
+		if seen[p] != revision {
+			behind = append(behind, p)
+		}
+	}
+	if len(behind) > 0 {
+		return fmt.Errorf("%s found other peers", strings.Join(behind, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBarrier(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"}},
+	)
+	web0 := &barrier{client: client, namespace: "default", pod: "web-0"}
+	web1 := &barrier{client: client, namespace: "default", pod: "web-1"}
+
+	// web-1 only found itself so far.
+	alone := testUpdate
+	alone.Self, alone.Peers = "web-1.nginx.default.svc.cluster.local", []string{"web-1.nginx.default.svc.cluster.local"}
+	if err := web1.converged(ctx, alone); err != nil {
+		t.Errorf("expected a single peer to agree with itself: %v", err)
+	}
+	if err := web0.converged(ctx, testUpdate); err == nil {
+		t.Errorf("expected web-0 to wait for web-1")
+	}
+
+	both := testUpdate
+	both.Self = alone.Self
+	if err := web1.converged(ctx, both); err != nil {
+		t.Errorf("expected web-1 to agree with web-0: %v", err)
+	}
+	if err := web0.converged(ctx, testUpdate); err != nil {
+		t.Errorf("expected web-0 to agree with web-1: %v", err)
+	}
+}
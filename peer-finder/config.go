@@ -0,0 +1,109 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// envPrefix is the prefix of the environment variables setting flags.
+const envPrefix = "PEER_FINDER_"
+
+// envName returns the environment variable setting the flag name, e.g.
+// PEER_FINDER_ON_CHANGE for -on-change.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// parseFlags parses args into fs, then sets the remaining flags from the
+// environment and from the YAML or JSON file named by the config flag. Flags
+// given on the command line take precedence over environment variables, which
+// take precedence over the config file.
+func parseFlags(fs *flag.FlagSet, args []string, config *string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if err = fs.Set(f.Name, v); err != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", v, envName(f.Name), err)
+		}
+		set[f.Name] = true
+	})
+	if err != nil || *config == "" {
+		return err
+	}
+
+	values, err := readConfig(*config)
+	if err != nil {
+		return err
+	}
+	for name, v := range values {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown option %q", *config, name)
+		}
+		if set[name] {
+			continue
+		}
+		// Lists set flags that may be repeated once per element.
+		list, ok := v.([]interface{})
+		if !ok {
+			list = []interface{}{v}
+		}
+		for _, e := range list {
+			if err := fs.Set(name, fmt.Sprint(e)); err != nil {
+				return fmt.Errorf("%s: invalid value %v for %s: %v", *config, e, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readConfig reads a YAML or JSON file mapping flag names to their values.
+func readConfig(path string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err = yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	values := map[string]interface{}{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	// Keep numbers as written, e.g. 1 rather than 1e+00.
+	d.UseNumber()
+	if err := d.Decode(&values); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
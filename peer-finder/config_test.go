@@ -0,0 +1,83 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peer-finder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("service: from-file\nns: from-file\ndomain: from-file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("PEER_FINDER_NS", "from-env")
+	os.Setenv("PEER_FINDER_DOMAIN", "from-env")
+	defer os.Unsetenv("PEER_FINDER_NS")
+	defer os.Unsetenv("PEER_FINDER_DOMAIN")
+
+	var o options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o.addFlags(fs)
+	if err := o.parse(fs, []string{"-config", path, "-domain", "from-flag"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"service", o.service, "from-file"},
+		{"ns", o.namespace, "from-env"},
+		{"domain", o.domain, "from-flag"},
+		{"backend", o.backend, "dns"},
+	}
+	for _, c := range cases {
+		if c.got != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.name, c.expected, c.got)
+		}
+	}
+}
+
+func TestParseFlagsUnknownOption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peer-finder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"servce": "typo"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var o options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o.addFlags(fs)
+	if err := o.parse(fs, []string{"-config", path}); err == nil {
+		t.Errorf("expected an error for an unknown option")
+	}
+}
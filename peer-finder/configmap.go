@@ -0,0 +1,121 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+// configMapRetry is how long to wait before writing the ConfigMap again after
+// failing to.
+const configMapRetry = 10 * time.Second
+
+// configMapTimeout bounds the time spent writing the ConfigMap.
+const configMapTimeout = 30 * time.Second
+
+// peersRevision returns a hash of the set of peers, whatever their order.
+func peersRevision(peers []string) string {
+	sorted := append([]string(nil), peers...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// leads returns whether this pod is the one of the peers of u publishing them,
+// the first one, so that all pods agree on it.
+func leads(u peerfinder.Update) bool {
+	return len(u.Peers) > 0 && u.Peers[0] == u.Self
+}
+
+// leads returns whether this pod writes the ConfigMap for u, the leader with
+// -leader-elect and otherwise the first of the peers.
+func (o *configMapObserver) leads(u peerfinder.Update) bool {
+	if o.leading != nil {
+		return o.leading()
+	}
+	return leads(u)
+}
+
+// configMapObserver writes the peers to a ConfigMap while this pod leads
+// them. Writes happen in the background, only the latest peers being written
+// if they change meanwhile.
+type configMapObserver struct {
+	writer  *kube.ConfigMapWriter
+	pending chan peerfinder.Update
+	// leading, if set, returns whether this pod is the leader writing the
+	// ConfigMap.
+	leading func() bool
+}
+
+// newConfigMapObserver returns a configMapObserver writing the ConfigMap named
+// name in ns until ctx is cancelled, while leading if not nil says so.
+func newConfigMapObserver(ctx context.Context, client kubernetes.Interface, ns, name string, leading func() bool) *configMapObserver {
+	o := &configMapObserver{writer: kube.NewConfigMapWriter(client, ns, name), pending: make(chan peerfinder.Update, 1), leading: leading}
+	go o.run(ctx)
+	return o
+}
+
+func (o *configMapObserver) applying(_ *peerfinder.Update, u peerfinder.Update) {
+	if !o.leads(u) {
+		return
+	}
+	// Replace the peers waiting to be written, if any.
+	select {
+	case <-o.pending:
+	default:
+	}
+	o.pending <- u
+}
+
+func (o *configMapObserver) hookRan(*hook, error) {}
+
+// run writes the pending peers until ctx is cancelled, retrying failed writes.
+func (o *configMapObserver) run(ctx context.Context) {
+	var u peerfinder.Update
+	var retry <-chan time.Time
+	for {
+		select {
+		case u = <-o.pending:
+		case <-retry:
+		case <-ctx.Done():
+			return
+		}
+		retry = nil
+		wctx, cancel := context.WithTimeout(ctx, configMapTimeout)
+		err := o.writer.Write(wctx, map[string]string{
+			"peers":    strings.Join(u.Peers, "\n"),
+			"revision": peersRevision(u.Peers),
+			"leader":   u.Self,
+		})
+		cancel()
+		if err != nil {
+			slog.Warn("Failed to write the peers to the ConfigMap, retrying", "in", configMapRetry, "err", err)
+			retry = time.After(configMapRetry)
+		}
+	}
+}
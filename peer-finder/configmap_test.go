@@ -0,0 +1,66 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPeersRevision(t *testing.T) {
+	a := peersRevision([]string{"web-0", "web-1"})
+	if b := peersRevision([]string{"web-1", "web-0"}); a != b {
+		t.Errorf("expected the revision not to depend on the order, got %s and %s", a, b)
+	}
+	if b := peersRevision([]string{"web-0"}); a == b {
+		t.Errorf("expected different peers to have different revisions")
+	}
+}
+
+func TestConfigMapObserver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset()
+	o := newConfigMapObserver(ctx, client, "default", "nginx-peers", nil)
+
+	follower := testUpdate
+	follower.Self = "web-1.nginx.default.svc.cluster.local"
+	o.applying(nil, follower)
+	o.applying(nil, testUpdate)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cm, err := client.CoreV1().ConfigMaps("default").Get(ctx, "nginx-peers", metav1.GetOptions{})
+		if err == nil {
+			if expected := "web-0.nginx.default.svc.cluster.local\nweb-1.nginx.default.svc.cluster.local"; cm.Data["peers"] != expected {
+				t.Errorf("expected peers %q, got %q", expected, cm.Data["peers"])
+			}
+			if cm.Data["revision"] != peersRevision(testUpdate.Peers) || cm.Data["leader"] != testUpdate.Self {
+				t.Errorf("unexpected data %v", cm.Data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the ConfigMap to be written: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
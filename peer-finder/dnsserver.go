@@ -0,0 +1,181 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// dnsServerOptions are the flags of the DNS server of serve.
+type dnsServerOptions struct {
+	addr string
+	ttl  time.Duration
+}
+
+func (o *dnsServerOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.addr, "dns-address", "", "The address to serve the peers on as DNS records over UDP and TCP, e.g. 127.0.0.1:5353. Disabled if empty.")
+	fs.DurationVar(&o.ttl, "dns-ttl", 5*time.Second, "The TTL of the records served on -dns-address.")
+}
+
+// dnsServer answers queries for the service and its peers with the records
+// of the latest update: SRV, A and AAAA records of the service name, and A or
+// AAAA records of the name of each peer.
+type dnsServer struct {
+	service string
+	domain  string
+	ttl     uint32
+	// resolver resolves the names of peers, net.DefaultResolver if nil.
+	resolver peerfinder.Resolver
+	// zone holds the records by lowercase fully qualified name.
+	zone atomic.Pointer[map[string][]dns.RR]
+}
+
+func newDNSServer(service, domain string, ttl time.Duration) *dnsServer {
+	return &dnsServer{service: dns.Fqdn(strings.ToLower(service)), domain: dns.Fqdn(strings.ToLower(domain)), ttl: uint32(ttl / time.Second)}
+}
+
+// update replaces the records served with those of u. Peers that cannot be
+// resolved are left out.
+func (s *dnsServer) update(ctx context.Context, u *peerfinder.Update) {
+	zone := map[string][]dns.RR{}
+	for _, name := range u.Peers {
+		ip, err := peerAddress(ctx, s.resolver, name)
+		if err != nil {
+			slog.Warn("Leaving unresolved peer out of the DNS records", "peer", name, "err", err)
+			continue
+		}
+		zone[s.service] = append(zone[s.service], s.address(s.service, ip))
+		if net.ParseIP(name) != nil {
+			continue
+		}
+		target := dns.Fqdn(strings.ToLower(name))
+		zone[target] = append(zone[target], s.address(target, ip))
+		d := u.Details[name]
+		zone[s.service] = append(zone[s.service], &dns.SRV{
+			Hdr:      dns.RR_Header{Name: s.service, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: s.ttl},
+			Priority: uint16(d.Priority),
+			Weight:   uint16(d.Weight),
+			Port:     uint16(d.Port),
+			Target:   target,
+		})
+	}
+	s.zone.Store(&zone)
+}
+
+// address returns the A or AAAA record of name for ip.
+func (s *dnsServer) address(name string, ip net.IP) dns.RR {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: s.ttl}, A: ip4}
+	}
+	return &dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: s.ttl}, AAAA: ip}
+}
+
+// ServeDNS implements dns.Handler. Queries for names outside of the domain
+// are refused, there is no recursion.
+func (s *dnsServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	if len(req.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		w.WriteMsg(m)
+		return
+	}
+	m.Authoritative = true
+	q := req.Question[0]
+	name := strings.ToLower(q.Name)
+	var zone map[string][]dns.RR
+	if z := s.zone.Load(); z != nil {
+		zone = *z
+	}
+	rrs, ok := zone[name]
+	switch {
+	case !dns.IsSubDomain(s.domain, name):
+		m.Authoritative = false
+		m.Rcode = dns.RcodeRefused
+	case !ok:
+		m.Rcode = dns.RcodeNameError
+	}
+	for _, rr := range rrs {
+		if q.Qtype != rr.Header().Rrtype && q.Qtype != dns.TypeANY {
+			continue
+		}
+		m.Answer = append(m.Answer, rr)
+		if srv, ok := rr.(*dns.SRV); ok {
+			m.Extra = append(m.Extra, zone[srv.Target]...)
+		}
+	}
+	if _, ok := w.LocalAddr().(*net.UDPAddr); ok {
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+		m.Truncate(size)
+	}
+	w.WriteMsg(m)
+}
+
+// serve serves the records of the peers of store over UDP and TCP until ctx
+// is cancelled.
+func (o *dnsServerOptions) serve(ctx context.Context, store *peerStore, service, domain string) error {
+	l, err := net.Listen("tcp", o.addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve DNS: %v", err)
+	}
+	pc, err := net.ListenPacket("udp", o.addr)
+	if err != nil {
+		l.Close()
+		return fmt.Errorf("cannot serve DNS: %v", err)
+	}
+	s := newDNSServer(service, domain, o.ttl)
+	servers := []*dns.Server{{Listener: l, Handler: s}, {PacketConn: pc, Handler: s}}
+	go func() {
+		for {
+			_, u, changed := store.latest()
+			if u != nil {
+				s.update(ctx, u)
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				for _, srv := range servers {
+					srv.Shutdown()
+				}
+				return
+			}
+		}
+	}()
+	for _, srv := range servers {
+		go func() {
+			if err := srv.ActivateAndServe(); err != nil {
+				slog.Error("DNS server failed", "err", err)
+			}
+		}()
+	}
+	slog.Info("Serving DNS", "address", o.addr, "name", s.service)
+	return nil
+}
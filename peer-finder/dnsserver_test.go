@@ -0,0 +1,95 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestDNSServer(t *testing.T) {
+	s := newDNSServer("nginx.default.svc.cluster.local", "default.svc.cluster.local", 5*time.Second)
+	s.resolver = hostsResolver{"web-0.nginx.default.svc.cluster.local": "10.0.0.1", "web-1.nginx.default.svc.cluster.local": "fd00::2"}
+	s.update(context.Background(), &peerfinder.Update{
+		Peers: []string{"web-0.nginx.default.svc.cluster.local", "web-1.nginx.default.svc.cluster.local", "web-2.nginx.default.svc.cluster.local"},
+		Details: map[string]peerfinder.Peer{
+			"web-0.nginx.default.svc.cluster.local": {Port: 80, Weight: 50},
+			"web-1.nginx.default.svc.cluster.local": {Port: 80, Weight: 50},
+		},
+	})
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: s}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	cases := []struct {
+		name     string
+		qtype    uint16
+		rcode    int
+		expected []string
+		extra    int
+	}{
+		{"nginx.default.svc.cluster.local.", dns.TypeSRV, dns.RcodeSuccess, []string{
+			"0 50 80 web-0.nginx.default.svc.cluster.local.",
+			"0 50 80 web-1.nginx.default.svc.cluster.local.",
+		}, 2},
+		{"NGINX.default.svc.cluster.local.", dns.TypeA, dns.RcodeSuccess, []string{"10.0.0.1"}, 0},
+		{"nginx.default.svc.cluster.local.", dns.TypeAAAA, dns.RcodeSuccess, []string{"fd00::2"}, 0},
+		{"web-0.nginx.default.svc.cluster.local.", dns.TypeA, dns.RcodeSuccess, []string{"10.0.0.1"}, 0},
+		{"web-0.nginx.default.svc.cluster.local.", dns.TypeAAAA, dns.RcodeSuccess, nil, 0},
+		{"web-2.nginx.default.svc.cluster.local.", dns.TypeA, dns.RcodeNameError, nil, 0},
+		{"example.com.", dns.TypeA, dns.RcodeRefused, nil, 0},
+	}
+	for _, c := range cases {
+		m := new(dns.Msg)
+		m.SetQuestion(c.name, c.qtype)
+		r, err := dns.Exchange(m, pc.LocalAddr().String())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		if r.Rcode != c.rcode {
+			t.Errorf("%s: expected %s, got %s", c.name, dns.RcodeToString[c.rcode], dns.RcodeToString[r.Rcode])
+		}
+		var answers []string
+		for _, rr := range r.Answer {
+			switch rr := rr.(type) {
+			case *dns.SRV:
+				answers = append(answers, rr.String()[len(rr.Hdr.String()):])
+			case *dns.A:
+				answers = append(answers, rr.A.String())
+			case *dns.AAAA:
+				answers = append(answers, rr.AAAA.String())
+			}
+		}
+		if !reflect.DeepEqual(answers, c.expected) {
+			t.Errorf("%s %s: expected %v, got %v", c.name, dns.TypeToString[c.qtype], c.expected, answers)
+		}
+		if len(r.Extra) != c.extra {
+			t.Errorf("%s: expected %d additional records, got %v", c.name, c.extra, r.Extra)
+		}
+	}
+}
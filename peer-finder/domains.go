@@ -0,0 +1,202 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+// lookup is a governing service peers are looked up through in a domain
+// other than the one of this pod, e.g. in another cluster.
+type lookup struct {
+	service   string
+	namespace string
+	// domain is the domain of the service, e.g. "default.svc.cluster2.local".
+	domain string
+	// kubeconfig is the kubeconfig of the cluster whose EndpointSlices are
+	// watched, the service being looked up through DNS if empty.
+	kubeconfig string
+	// priority is the priority of the domain with -order=domain, that of
+	// this pod being 0.
+	priority int
+}
+
+// name returns the fully qualified name of the service.
+func (l lookup) name() string {
+	return l.service + "." + l.domain + "."
+}
+
+// parseLookup parses entry, a cluster domain, the full name of a service or
+// a <service>[.<namespace>]@<domain> peer source, optionally followed by
+// :<priority>, priority otherwise, ns being the namespace of this pod.
+func (o *options) parseLookup(entry, ns string, priority int) (lookup, error) {
+	e, p, ok := strings.Cut(entry, ":")
+	if ok {
+		var err error
+		if priority, err = strconv.Atoi(p); err != nil {
+			return lookup{}, fmt.Errorf("invalid priority in %q", entry)
+		}
+	}
+	e = strings.TrimSuffix(e, ".")
+	if source, domain, ok := strings.Cut(e, "@"); ok {
+		service, namespace, _ := strings.Cut(source, ".")
+		if namespace == "" {
+			namespace = ns
+		}
+		if service == "" || namespace == "" || strings.Contains(namespace, ".") || domain == "" {
+			return lookup{}, fmt.Errorf("invalid peer source %q, expected <service>[.<namespace>]@<domain>", entry)
+		}
+		return lookup{service: service, namespace: namespace, domain: namespace + ".svc." + domain, priority: priority}, nil
+	}
+	if i := strings.Index(e, ".svc."); i >= 0 {
+		service, namespace, ok := strings.Cut(e[:i], ".")
+		if !ok || service == "" || namespace == "" || strings.Contains(namespace, ".") {
+			return lookup{}, fmt.Errorf("invalid domain %q, expected <domain> or <service>.<namespace>.svc.<domain>", entry)
+		}
+		return lookup{service: service, namespace: namespace, domain: e[len(service)+1:], priority: priority}, nil
+	}
+	if ns == "" {
+		return lookup{}, fmt.Errorf("domain %q requires the namespace of this pod, or to be given as <service>.<namespace>.svc.<domain>", entry)
+	}
+	return lookup{service: o.service, namespace: ns, domain: ns + ".svc." + e, priority: priority}, nil
+}
+
+// extLookups parses -extdomain, -peer-source and -remote-kubeconfig, ns being
+// the namespace of this pod. Domains without a priority are given their
+// position.
+func (o *options) extLookups(ns string) ([]lookup, error) {
+	var lookups []lookup
+	for _, v := range o.extDomains {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e == "" {
+				continue
+			}
+			l, err := o.parseLookup(e, ns, len(lookups)+1)
+			if err != nil {
+				return nil, fmt.Errorf("-extdomain: %v", err)
+			}
+			lookups = append(lookups, l)
+		}
+	}
+	for _, v := range o.peerSources {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e == "" {
+				continue
+			}
+			if !strings.Contains(e, "@") {
+				return nil, fmt.Errorf("invalid -peer-source %q, expected <service>[.<namespace>]@<domain>", e)
+			}
+			l, err := o.parseLookup(e, ns, len(lookups)+1)
+			if err != nil {
+				return nil, fmt.Errorf("-peer-source: %v", err)
+			}
+			lookups = append(lookups, l)
+		}
+	}
+	for _, v := range o.remoteKubeconfigs {
+		e, kubeconfig, ok := strings.Cut(v, "=")
+		if !ok || kubeconfig == "" {
+			return nil, fmt.Errorf("invalid -remote-kubeconfig %q, expected <domain>[:<priority>]=<kubeconfig>", v)
+		}
+		l, err := o.parseLookup(strings.TrimSpace(e), ns, len(lookups)+1)
+		if err != nil {
+			return nil, fmt.Errorf("-remote-kubeconfig: %v", err)
+		}
+		l.kubeconfig = kubeconfig
+		lookups = append(lookups, l)
+	}
+	return lookups, nil
+}
+
+// withExtDomains returns a Discoverer finding the peers of d, in domain, and
+// those of the services of -extdomain, -peer-source and -remote-kubeconfig,
+// each peer being annotated with the domain it was found in. The service of
+// this pod is only looked up once, through d.
+func (o *options) withExtDomains(ctx context.Context, d peerfinder.Discoverer, ns, domain string) (peerfinder.Discoverer, error) {
+	lookups, err := o.extLookups(ns)
+	if err != nil || len(lookups) == 0 {
+		return d, err
+	}
+	policy, ok := failurePolicies[o.extFailure]
+	if !ok {
+		return nil, fmt.Errorf("unknown -extdomain-failure %q", o.extFailure)
+	}
+	ds := []peerfinder.Discoverer{&peerfinder.DomainDiscoverer{Discoverer: d, Domain: domain, Priority: o.domainPriority}}
+	for _, l := range lookups {
+		if l.service == o.service && l.domain == domain {
+			continue
+		}
+		var ext peerfinder.Discoverer
+		if l.kubeconfig != "" {
+			ext, err = o.remoteDiscoverer(ctx, l)
+		} else {
+			ext, err = o.dnsDiscoverer(l.name())
+		}
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, &peerfinder.DomainDiscoverer{Discoverer: ext, Domain: l.domain, Priority: l.priority})
+	}
+	m := peerfinder.NewMultiDiscoverer(ds...)
+	m.Policy, m.StaleTTL = policy, o.extStaleTTL
+	m.OnError = func(d peerfinder.Discoverer, err error) {
+		slog.Warn("Failed to look up peers in a domain", "source", peerfinder.Source(d), "policy", o.extFailure, "err", err)
+	}
+	return m, nil
+}
+
+// remoteDiscoverer returns the Discoverer watching the EndpointSlices of the
+// service of l through the API of its cluster.
+func (o *options) remoteDiscoverer(ctx context.Context, l lookup) (peerfinder.Discoverer, error) {
+	client, err := kube.ClientFromKubeconfig(l.kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("cluster of %s: %v", l.domain, err)
+	}
+	d, err := kube.NewEndpointSliceDiscoverer(ctx, client, l.namespace, l.service, l.domain)
+	if err != nil {
+		return nil, fmt.Errorf("cannot watch the EndpointSlices of %s in the cluster of %s: %v", l.service, l.domain, err)
+	}
+	o.configureEndpointSlices(ctx, d, client, true)
+	return d, nil
+}
+
+// failurePolicies maps the values of -extdomain-failure to failure policies.
+var failurePolicies = map[string]peerfinder.FailurePolicy{
+	"fail":     peerfinder.FailurePolicyFail,
+	"continue": peerfinder.FailurePolicyContinue,
+	"stale":    peerfinder.FailurePolicyStale,
+}
+
+// domains returns the domains the peers of pf are looked up in.
+func (o *options) domains(pf *peerfinder.PeerFinder) []string {
+	domains := []string{pf.Domain()}
+	lookups, _ := o.extLookups(o.podNamespace())
+	for _, l := range lookups {
+		if !slices.Contains(domains, l.domain) {
+			domains = append(domains, l.domain)
+		}
+	}
+	return domains
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestExtLookups(t *testing.T) {
+	cases := []struct {
+		extDomains []string
+		ns         string
+		expected   []string
+		valid      bool
+	}{
+		{nil, "default", nil, true},
+		{[]string{"cluster2.local"}, "default", []string{"nginx.default.svc.cluster2.local."}, true},
+		{[]string{"cluster2.local, cassandra.db.svc.cluster3.local.", "cluster4.local"}, "default", []string{
+			"nginx.default.svc.cluster2.local.",
+			"cassandra.db.svc.cluster3.local.",
+			"nginx.default.svc.cluster4.local.",
+		}, true},
+		{[]string{"cassandra.db.svc.cluster3.local"}, "", []string{"cassandra.db.svc.cluster3.local."}, true},
+		// Domains are used as given, whatever their suffix.
+		{[]string{"cluster2.example.com", "cluster3.corp."}, "default", []string{
+			"nginx.default.svc.cluster2.example.com.",
+			"nginx.default.svc.cluster3.corp.",
+		}, true},
+		{[]string{"cassandra.db.svc.cluster3.example.com"}, "default", []string{"cassandra.db.svc.cluster3.example.com."}, true},
+		{[]string{"cluster2.local"}, "", nil, false},
+		{[]string{"db.svc.cluster3.local"}, "default", nil, false},
+		{[]string{"a.b.c.svc.cluster3.local"}, "default", nil, false},
+	}
+	for _, c := range cases {
+		o := &options{service: "nginx", extDomains: c.extDomains}
+		lookups, err := o.extLookups(c.ns)
+		if (err == nil) != c.valid {
+			t.Errorf("%v: expected valid %v, got %v", c.extDomains, c.valid, err)
+			continue
+		}
+		var names []string
+		for _, l := range lookups {
+			names = append(names, l.name())
+		}
+		if !reflect.DeepEqual(names, c.expected) {
+			t.Errorf("%v: expected %v, got %v", c.extDomains, c.expected, names)
+		}
+	}
+}
+
+func TestWithExtDomains(t *testing.T) {
+	o := &options{service: "nginx", dnsMode: "plain", extDomains: []string{"cluster2.local"}, extFailure: "continue"}
+	d, err := o.withExtDomains(context.Background(), peerfinder.DiscovererFunc(nil), "default", "default.svc.cluster.local")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m, ok := d.(*peerfinder.MultiDiscoverer); !ok || m.Policy != peerfinder.FailurePolicyContinue {
+		t.Errorf("expected a MultiDiscoverer continuing on failures, got %#v", d)
+	}
+	o.extFailure = "retry"
+	if _, err := o.withExtDomains(context.Background(), peerfinder.DiscovererFunc(nil), "default", "default.svc.cluster.local"); err == nil {
+		t.Errorf("expected an unknown -extdomain-failure to be rejected")
+	}
+}
+
+func TestExtLookupsRemote(t *testing.T) {
+	o := &options{service: "nginx", remoteKubeconfigs: []string{
+		"cluster2.local=/etc/peer-finder/cluster2/kubeconfig",
+		"cassandra.db.svc.cluster3.local=/etc/peer-finder/cluster3/kubeconfig",
+	}}
+	lookups, err := o.extLookups("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []lookup{
+		{service: "nginx", namespace: "default", domain: "default.svc.cluster2.local", kubeconfig: "/etc/peer-finder/cluster2/kubeconfig", priority: 1},
+		{service: "cassandra", namespace: "db", domain: "db.svc.cluster3.local", kubeconfig: "/etc/peer-finder/cluster3/kubeconfig", priority: 2},
+	}
+	if !reflect.DeepEqual(lookups, expected) {
+		t.Errorf("expected %v, got %v", expected, lookups)
+	}
+	for _, v := range []string{"cluster2.local", "cluster2.local=", "db.svc.cluster3.local=/kubeconfig", "cluster2.local:first=/kubeconfig"} {
+		o.remoteKubeconfigs = []string{v}
+		if _, err := o.extLookups("default"); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestExtLookupsPriority(t *testing.T) {
+	o := &options{
+		service:           "nginx",
+		extDomains:        []string{"cluster2.local:10,cluster3.local"},
+		remoteKubeconfigs: []string{"cluster4.local:-1=/etc/peer-finder/cluster4/kubeconfig"},
+	}
+	lookups, err := o.extLookups("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var priorities []int
+	for _, l := range lookups {
+		priorities = append(priorities, l.priority)
+	}
+	if expected := []int{10, 2, -1}; !reflect.DeepEqual(priorities, expected) {
+		t.Errorf("expected priorities %v, got %v", expected, priorities)
+	}
+	if name := lookups[0].name(); name != "nginx.default.svc.cluster2.local." {
+		t.Errorf("expected the priority to be left out of the name, got %s", name)
+	}
+}
+
+func TestPeerSources(t *testing.T) {
+	o := &options{service: "svc-a", peerSources: []string{"svc-a@cluster1.local,svc-b@cluster2.local", "svc-c.db@cluster3.local:5"}}
+	lookups, err := o.extLookups("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []lookup{
+		{service: "svc-a", namespace: "default", domain: "default.svc.cluster1.local", priority: 1},
+		{service: "svc-b", namespace: "default", domain: "default.svc.cluster2.local", priority: 2},
+		{service: "svc-c", namespace: "db", domain: "db.svc.cluster3.local", priority: 5},
+	}
+	if !reflect.DeepEqual(lookups, expected) {
+		t.Errorf("expected %v, got %v", expected, lookups)
+	}
+	for _, v := range []string{"cluster2.local", "@cluster2.local", "svc-b@", "svc-b.a.b@cluster2.local"} {
+		o.peerSources = []string{v}
+		if _, err := o.extLookups("default"); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+
+	// The service of this pod is looked up once.
+	o.dnsMode, o.extFailure = "plain", "fail"
+	o.peerSources = []string{"svc-a@cluster1.local,svc-b@cluster2.local"}
+	d, err := o.withExtDomains(context.Background(), peerfinder.DiscovererFunc(nil), "default", "default.svc.cluster1.local")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := d.(fmt.Stringer).String(); strings.Count(s, "svc-a") != 0 || !strings.Contains(s, "svc-b.default.svc.cluster2.local") {
+		t.Errorf("expected svc-a to be skipped, got %s", s)
+	}
+}
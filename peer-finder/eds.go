@@ -0,0 +1,121 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpointservice "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"google.golang.org/grpc"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// edsOptions are the flags of the Envoy EDS server of serve.
+type edsOptions struct {
+	addr    string
+	cluster string
+	port    int
+	// resolver resolves the names of peers, which Envoy requires addresses
+	// of. net.DefaultResolver if nil.
+	resolver peerfinder.Resolver
+}
+
+func (o *edsOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.addr, "xds-address", "", "The address to serve the peers on as an Envoy EDS cluster over xDS, host:port or unix:<path> for a Unix socket. Disabled if empty.")
+	fs.StringVar(&o.cluster, "xds-cluster", "", "The name of the EDS cluster, -service if empty.")
+	fs.IntVar(&o.port, "xds-port", 0, "The port of the endpoints of the peers found without one, e.g. through A records. Such peers are left out if 0.")
+}
+
+// assignment returns the endpoints of the peers of u, resolving their names
+// to addresses. Peers that cannot be resolved or have no port are left out.
+func (o *edsOptions) assignment(ctx context.Context, u *peerfinder.Update) *endpointv3.ClusterLoadAssignment {
+	locality := &endpointv3.LocalityLbEndpoints{}
+	for _, name := range u.Peers {
+		d := u.Details[name]
+		port := d.Port
+		if port == 0 {
+			port = o.port
+		}
+		if port == 0 {
+			slog.Warn("Leaving peer without port out of the EDS cluster", "peer", name)
+			continue
+		}
+		ip, err := peerAddress(ctx, o.resolver, name)
+		if err != nil {
+			slog.Warn("Leaving unresolved peer out of the EDS cluster", "peer", name, "err", err)
+			continue
+		}
+		locality.LbEndpoints = append(locality.LbEndpoints, &endpointv3.LbEndpoint{
+			HostIdentifier: &endpointv3.LbEndpoint_Endpoint{Endpoint: &endpointv3.Endpoint{
+				Hostname: name,
+				Address: &corev3.Address{Address: &corev3.Address_SocketAddress{SocketAddress: &corev3.SocketAddress{
+					Address:       ip.String(),
+					PortSpecifier: &corev3.SocketAddress_PortValue{PortValue: uint32(port)},
+				}}},
+			}},
+		})
+	}
+	return &endpointv3.ClusterLoadAssignment{ClusterName: o.cluster, Endpoints: []*endpointv3.LocalityLbEndpoints{locality}}
+}
+
+// serve serves the peers of store over EDS, and ADS, until ctx is cancelled,
+// with opts such as those of apiAuth. The cluster is served to all Envoy
+// nodes, whatever their ID.
+func (o *edsOptions) serve(ctx context.Context, store *peerStore, opts ...grpc.ServerOption) error {
+	l, err := listen(o.addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve xDS: %v", err)
+	}
+	c := cache.NewLinearCache(resource.EndpointType)
+	xds := server.NewServer(ctx, c, nil)
+	srv := grpc.NewServer(opts...)
+	endpointservice.RegisterEndpointDiscoveryServiceServer(srv, xds)
+	discoveryv3.RegisterAggregatedDiscoveryServiceServer(srv, xds)
+	go func() {
+		for {
+			_, u, changed := store.latest()
+			if u != nil {
+				if err := c.UpdateResource(o.cluster, o.assignment(ctx, u)); err != nil {
+					slog.Error("Failed to update the EDS cluster", "cluster", o.cluster, "err", err)
+				}
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				srv.GracefulStop()
+				return
+			}
+		}
+	}()
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			slog.Error("xDS server failed", "err", err)
+		}
+	}()
+	slog.Info("Serving EDS", "address", o.addr, "cluster", o.cluster)
+	return nil
+}
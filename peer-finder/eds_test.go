@@ -0,0 +1,185 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpointservice "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// hostsResolver resolves names to the addresses of its map.
+type hostsResolver map[string]string
+
+func (r hostsResolver) LookupSRV(context.Context, string, string, string) (string, []*net.SRV, error) {
+	return "", nil, errors.New("not implemented")
+}
+
+func (r hostsResolver) LookupIP(_ context.Context, _, host string) ([]net.IP, error) {
+	if addr, ok := r[host]; ok {
+		return []net.IP{net.ParseIP(addr)}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// endpoints returns the addresses of the endpoints of a, as host:port.
+func endpoints(a *endpointv3.ClusterLoadAssignment) []string {
+	var addrs []string
+	for _, l := range a.Endpoints {
+		for _, e := range l.LbEndpoints {
+			s := e.GetEndpoint().Address.GetSocketAddress()
+			addrs = append(addrs, net.JoinHostPort(s.Address, fmt.Sprint(s.GetPortValue())))
+		}
+	}
+	return addrs
+}
+
+func TestEDSAssignment(t *testing.T) {
+	o := &edsOptions{cluster: "nginx", resolver: hostsResolver{"web-0.nginx": "10.0.0.1"}}
+	u := &peerfinder.Update{
+		Peers:   []string{"web-0.nginx", "web-1.nginx", "10.0.0.3"},
+		Details: map[string]peerfinder.Peer{"web-0.nginx": {Port: 80}, "web-1.nginx": {Port: 80}},
+	}
+	cases := []struct {
+		port     int
+		expected []string
+	}{
+		{0, []string{"10.0.0.1:80"}},
+		{8080, []string{"10.0.0.1:80", "10.0.0.3:8080"}},
+	}
+	for _, c := range cases {
+		o.port = c.port
+		a := o.assignment(context.Background(), u)
+		if a.ClusterName != "nginx" {
+			t.Errorf("expected the nginx cluster, got %q", a.ClusterName)
+		}
+		if addrs := endpoints(a); !reflect.DeepEqual(addrs, c.expected) {
+			t.Errorf("port %d: expected %v, got %v", c.port, c.expected, addrs)
+		}
+	}
+}
+
+func TestEDS(t *testing.T) {
+	pf, err := peerfinder.New(peerfinder.Config{Service: "nginx", Domain: "default.svc.cluster.local", Hostname: "web-0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store := newPeerStore(pf)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	o := &edsOptions{addr: "unix:" + filepath.Join(t.TempDir(), "xds.sock"), cluster: "nginx"}
+	if err := o.serve(ctx, store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn, err := grpc.NewClient(o.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	stream, err := endpointservice.NewEndpointDiscoveryServiceClient(conn).StreamEndpoints(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := &discoveryv3.DiscoveryRequest{TypeUrl: resource.EndpointType, ResourceNames: []string{"nginx"}}
+	if err := stream.Send(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store.set(peerfinder.Update{Peers: []string{"10.0.0.1"}, Details: map[string]peerfinder.Peer{"10.0.0.1": {Port: 80}}})
+	for _, expected := range [][]string{{"10.0.0.1:80"}, {"10.0.0.1:80", "10.0.0.2:80"}} {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(resp.Resources) != 1 {
+			t.Fatalf("expected one resource, got %v", resp.Resources)
+		}
+		a := &endpointv3.ClusterLoadAssignment{}
+		if err := resp.Resources[0].UnmarshalTo(a); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if addrs := endpoints(a); !reflect.DeepEqual(addrs, expected) {
+			t.Errorf("expected %v, got %v", expected, addrs)
+		}
+		// Acknowledge the response to get the next one.
+		req.VersionInfo, req.ResponseNonce = resp.VersionInfo, resp.Nonce
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		store.set(peerfinder.Update{
+			Peers:   []string{"10.0.0.1", "10.0.0.2"},
+			Details: map[string]peerfinder.Peer{"10.0.0.1": {Port: 80}, "10.0.0.2": {Port: 80}},
+		})
+	}
+}
+
+func TestEDSAuth(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	os.WriteFile(tokenFile, []byte("secret\n"), 0600)
+	a := &apiAuth{tokenFile: tokenFile}
+	if err := a.load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pf, err := peerfinder.New(peerfinder.Config{Service: "nginx", Domain: "default.svc.cluster.local", Hostname: "web-0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store := newPeerStore(pf)
+	store.set(peerfinder.Update{Peers: []string{"10.0.0.1"}, Details: map[string]peerfinder.Peer{"10.0.0.1": {Port: 80}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	o := &edsOptions{addr: "unix:" + filepath.Join(dir, "xds.sock"), cluster: "nginx"}
+	if err := o.serve(ctx, store, a.grpcOptions()...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn, err := grpc.NewClient(o.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	for token, expected := range map[string]codes.Code{"Bearer secret": codes.OK, "Bearer wrong": codes.Unauthenticated} {
+		stream, err := endpointservice.NewEndpointDiscoveryServiceClient(conn).StreamEndpoints(metadata.AppendToOutgoingContext(ctx, "authorization", token))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := stream.Send(&discoveryv3.DiscoveryRequest{TypeUrl: resource.EndpointType, ResourceNames: []string{"nginx"}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := stream.Recv(); status.Code(err) != expected {
+			t.Errorf("token %q: expected %v, got %v", token, expected, err)
+		}
+	}
+}
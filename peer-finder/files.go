@@ -0,0 +1,132 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// fileOptions are the flags configuring the files written on every update.
+type fileOptions struct {
+	templates    stringList
+	outputs      stringList
+	writePeersTo string
+}
+
+func (o *fileOptions) addFlags(fs *flag.FlagSet) {
+	fs.Var(&o.templates, "template", "A Go template rendered with the peers before scripts are run, may be repeated. Each template is written to the -template-out in the same position.")
+	fs.Var(&o.outputs, "template-out", "The file a -template is written to, may be repeated.")
+	fs.StringVar(&o.writePeersTo, "write-peers-to", "", "A file the peers are written to, in the format of -output, before scripts are run.")
+}
+
+// load parses the templates and returns the files to write.
+func (o *fileOptions) load(render renderer) (*fileOutputs, error) {
+	if len(o.templates) != len(o.outputs) {
+		return nil, fmt.Errorf("every -template requires a -template-out")
+	}
+	f := &fileOutputs{peersFile: o.writePeersTo, render: render}
+	for i, path := range o.templates {
+		tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).ParseFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		f.templates = append(f.templates, &fileTemplate{tmpl: tmpl, out: o.outputs[i]})
+	}
+	return f, nil
+}
+
+// fileOutputs are the files written on every update.
+type fileOutputs struct {
+	templates []*fileTemplate
+	peersFile string
+	render    renderer
+}
+
+// empty returns true if there are no files to write.
+func (f *fileOutputs) empty() bool {
+	return len(f.templates) == 0 && f.peersFile == ""
+}
+
+// write writes all files for u.
+func (f *fileOutputs) write(u peerfinder.Update) error {
+	for _, t := range f.templates {
+		if err := t.render(u); err != nil {
+			return fmt.Errorf("failed to render %s: %v", t.out, err)
+		}
+	}
+	if f.peersFile == "" {
+		return nil
+	}
+	peers, err := f.render(u)
+	if err != nil {
+		return err
+	}
+	slog.Info("Writing peers", "path", f.peersFile)
+	if err := writeFileAtomic(f.peersFile, []byte(peers+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", f.peersFile, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to path through a temporary file in the same
+// directory which is synced and renamed over path, so that readers never see
+// a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+name+".")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	// Persist the rename itself.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
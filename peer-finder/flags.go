@@ -0,0 +1,75 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// argvFlag is a flag.Value for a command line. It is either set to a JSON
+// array, or appended to by repeating the flag once per argument.
+type argvFlag []string
+
+func (a *argvFlag) String() string {
+	if a == nil || len(*a) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(*a)
+	return string(b)
+}
+
+func (a *argvFlag) Set(v string) error {
+	if strings.HasPrefix(strings.TrimSpace(v), "[") {
+		var argv []string
+		if err := json.Unmarshal([]byte(v), &argv); err != nil {
+			return err
+		}
+		*a = argv
+		return nil
+	}
+	*a = append(*a, v)
+	return nil
+}
+
+// stringList is a flag.Value for a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// split returns the comma separated values of l, without empty ones.
+func (l stringList) split() []string {
+	var values []string
+	for _, v := range l {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArgvFlag(t *testing.T) {
+	cases := []struct {
+		values   []string
+		expected []string
+		err      bool
+	}{
+		{[]string{"/reload"}, []string{"/reload"}, false},
+		{[]string{"/reload", "--all"}, []string{"/reload", "--all"}, false},
+		{[]string{`["/reload", "--all"]`}, []string{"/reload", "--all"}, false},
+		{[]string{"/ignored", `["/reload"]`}, []string{"/reload"}, false},
+		{[]string{`["/reload"`}, nil, true},
+	}
+	for _, c := range cases {
+		var a argvFlag
+		var err error
+		for _, v := range c.values {
+			if err = a.Set(v); err != nil {
+				break
+			}
+		}
+		if c.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", c.values)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.values, err)
+		} else if !reflect.DeepEqual([]string(a), c.expected) {
+			t.Errorf("%q: expected %q, got %q", c.values, c.expected, a)
+		}
+	}
+}
+
+func TestStringListSplit(t *testing.T) {
+	var l stringList
+	for _, v := range []string{"role,version", " tier ", ""} {
+		l.Set(v)
+	}
+	if expected, got := []string{"role", "version", "tier"}, l.split(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
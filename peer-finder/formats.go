@@ -0,0 +1,214 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// byOrdinal returns a copy of peers sorted by their StatefulSet ordinal.
+func byOrdinal(peers []string) []string {
+	sorted := append([]string(nil), peers...)
+	peerfinder.SortByOrdinal(sorted)
+	return sorted
+}
+
+// renderEtcd renders the peers for ETCD_INITIAL_CLUSTER, e.g.
+// etcd-0=https://etcd-0.etcd.default.svc.cluster.local:2380,...
+func (o *outputOptions) renderEtcd(u peerfinder.Update) (string, error) {
+	members := make([]string, 0, len(u.Peers))
+	for _, p := range byOrdinal(u.Peers) {
+		members = append(members, fmt.Sprintf("%s=%s://%s:%d", peerfinder.Hostname(p), o.etcdScheme, p, o.etcdPeerPort))
+	}
+	return strings.Join(members, ","), nil
+}
+
+// ordinal returns the ordinal of peer, or an error for formats that require
+// one.
+func ordinal(peer string) (int, error) {
+	n, ok := peerfinder.Ordinal(peer)
+	if !ok {
+		return 0, fmt.Errorf("%s has no ordinal", peer)
+	}
+	return n, nil
+}
+
+// renderZooKeeper renders the server lines of zoo.cfg, e.g.
+// server.1=zk-0.zk.default.svc.cluster.local:2888:3888.
+func (o *outputOptions) renderZooKeeper(u peerfinder.Update) (string, error) {
+	lines := make([]string, 0, len(u.Peers))
+	for _, p := range byOrdinal(u.Peers) {
+		n, err := ordinal(p)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("server.%d=%s:%d:%d", n+o.zkIDOffset, p, o.zkQuorumPort, o.zkElectionPort))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// renderCassandraSeeds renders the seeds of cassandra.yaml, the first
+// -seed-count peers by ordinal.
+func (o *outputOptions) renderCassandraSeeds(u peerfinder.Update) (string, error) {
+	seeds := byOrdinal(u.Peers)
+	if len(seeds) > o.seedCount {
+		seeds = seeds[:o.seedCount]
+	}
+	return strings.Join(seeds, ","), nil
+}
+
+// mongoMaxVoters is the maximum number of voting members of a replica set.
+const mongoMaxVoters = 7
+
+// mongoReplicaSet is the document passed to rs.initiate().
+type mongoReplicaSet struct {
+	ID      string        `json:"_id"`
+	Members []mongoMember `json:"members"`
+}
+
+type mongoMember struct {
+	ID       int    `json:"_id"`
+	Host     string `json:"host"`
+	Priority int    `json:"priority"`
+	Votes    *int   `json:"votes,omitempty"`
+}
+
+// renderMongoDB renders a replica set configuration for rs.initiate(). Lower
+// ordinals get higher priorities, members beyond the maximum number of voters
+// neither vote nor can become primary.
+func (o *outputOptions) renderMongoDB(u peerfinder.Update) (string, error) {
+	rs := mongoReplicaSet{ID: o.mongoReplicaSet, Members: []mongoMember{}}
+	peers := byOrdinal(u.Peers)
+	voters := len(peers)
+	if voters > mongoMaxVoters {
+		voters = mongoMaxVoters
+	}
+	for i, p := range peers {
+		n, err := ordinal(p)
+		if err != nil {
+			return "", err
+		}
+		m := mongoMember{ID: n, Host: fmt.Sprintf("%s:%d", p, o.mongoPort), Priority: voters - i}
+		if i >= voters {
+			zero := 0
+			m.Priority, m.Votes = 0, &zero
+		}
+		rs.Members = append(rs.Members, m)
+	}
+	b, err := json.Marshal(rs)
+	return string(b), err
+}
+
+// renderRabbitMQ renders the cluster_nodes tuple of rabbitmq.config, e.g.
+// {['rabbit@rabbitmq-0.rabbitmq.default.svc.cluster.local'], disc}.
+func (o *outputOptions) renderRabbitMQ(u peerfinder.Update) (string, error) {
+	nodes := make([]string, 0, len(u.Peers))
+	for _, p := range byOrdinal(u.Peers) {
+		host := p
+		if !o.rabbitLongNames {
+			host = peerfinder.Hostname(p)
+		}
+		nodes = append(nodes, fmt.Sprintf("'%s@%s'", o.rabbitNodeName, host))
+	}
+	return fmt.Sprintf("{[%s], %s}", strings.Join(nodes, ", "), o.rabbitNodeType), nil
+}
+
+// renderElasticsearch renders the discovery.seed_hosts and
+// cluster.initial_master_nodes settings of elasticsearch.yml. Node names are
+// expected to be the hostnames of the pods, the default of node.name.
+func (o *outputOptions) renderElasticsearch(u peerfinder.Update) (string, error) {
+	var b strings.Builder
+	peers := byOrdinal(u.Peers)
+	b.WriteString("discovery.seed_hosts:\n")
+	for _, p := range peers {
+		fmt.Fprintf(&b, "  - %s:%d\n", p, o.esTransportPort)
+	}
+	b.WriteString("cluster.initial_master_nodes:")
+	for _, p := range peers {
+		fmt.Fprintf(&b, "\n  - %s", peerfinder.Hostname(p))
+	}
+	return b.String(), nil
+}
+
+// renderKRaft renders the controller.quorum.voters of a KRaft mode Kafka
+// cluster, e.g. 0@kafka-0.kafka.default.svc.cluster.local:9093,...
+func (o *outputOptions) renderKRaft(u peerfinder.Update) (string, error) {
+	voters := make([]string, 0, len(u.Peers))
+	for _, p := range byOrdinal(u.Peers) {
+		n, err := ordinal(p)
+		if err != nil {
+			return "", err
+		}
+		voters = append(voters, fmt.Sprintf("%d@%s:%d", n+o.kraftIDOffset, p, o.kraftPort))
+	}
+	return strings.Join(voters, ","), nil
+}
+
+// ringHash names the hash of the tokens of -format=ring, for applications to
+// hash their keys the same way.
+const ringHash = "sha256-32"
+
+// hashRing is the consistent hash ring of -format=ring. A key belongs to the
+// peer of the first token greater than or equal to its hash, wrapping around
+// to the first token.
+type hashRing struct {
+	Hash   string      `json:"hash"`
+	VNodes int         `json:"vnodes"`
+	Ring   []ringToken `json:"ring"`
+}
+
+type ringToken struct {
+	Token uint32 `json:"token"`
+	Peer  string `json:"peer"`
+}
+
+// ringTokenOf returns the hash of key on the ring, the first 4 bytes of its
+// SHA-256 as a big endian integer.
+func ringTokenOf(key string) uint32 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// renderRing renders the consistent hash ring of the peers, each one owning
+// -ring-vnodes tokens, the hashes of <peer>#<n> for n from 0, so that every
+// pod derives the same ring from the same peers whatever their order.
+func (o *outputOptions) renderRing(u peerfinder.Update) (string, error) {
+	ring := hashRing{Hash: ringHash, VNodes: o.ringVNodes, Ring: make([]ringToken, 0, len(u.Peers)*o.ringVNodes)}
+	for _, p := range u.Peers {
+		for n := 0; n < o.ringVNodes; n++ {
+			ring.Ring = append(ring.Ring, ringToken{ringTokenOf(p + "#" + strconv.Itoa(n)), p})
+		}
+	}
+	sort.Slice(ring.Ring, func(i, j int) bool {
+		a, b := ring.Ring[i], ring.Ring[j]
+		if a.Token != b.Token {
+			return a.Token < b.Token
+		}
+		// Collisions are unlikely, but must be ordered the same everywhere.
+		return a.Peer < b.Peer
+	})
+	b, err := json.Marshal(ring)
+	return string(b), err
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"k8s.io/contrib/peer-finder/pkg/api"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/sets"
+)
+
+// grpcServer implements the gRPC API on top of a peerStore.
+type grpcServer struct {
+	api.UnimplementedPeerFinderServer
+	store *peerStore
+}
+
+// peers converts the latest peers to their API representation.
+func (s *grpcServer) peers(l peerList, u *peerfinder.Update) *api.Peers {
+	p := &api.Peers{Self: l.Self, Source: l.Source, Domains: l.Domains}
+	if u == nil {
+		return p
+	}
+	p.Updated = timestamppb.New(u.Time)
+	for _, name := range u.Peers {
+		d := u.Details[name]
+		p.Peers = append(p.Peers, &api.Peer{Name: name, Port: int32(d.Port), Priority: int32(d.Priority), Weight: int32(d.Weight)})
+	}
+	return p
+}
+
+func (s *grpcServer) ListPeers(context.Context, *api.ListPeersRequest) (*api.Peers, error) {
+	l, u, _ := s.store.latest()
+	return s.peers(l, u), nil
+}
+
+func (s *grpcServer) WatchPeers(_ *api.WatchPeersRequest, stream api.PeerFinder_WatchPeersServer) error {
+	var sent []string
+	initial := true
+	for {
+		l, u, changed := s.store.latest()
+		if u != nil {
+			added, removed := sets.Diff(sets.NewString(sent...), sets.NewString(u.Peers...))
+			if err := stream.Send(&api.PeersUpdate{Peers: s.peers(l, u), Added: added, Removed: removed, Initial: initial}); err != nil {
+				return err
+			}
+			sent, initial = u.Peers, false
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// serveGRPC serves the gRPC API for store on addr until ctx is cancelled.
+func serveGRPC(ctx context.Context, addr string, store *peerStore, opts ...grpc.ServerOption) error {
+	l, err := listen(addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve gRPC: %v", err)
+	}
+	srv := grpc.NewServer(opts...)
+	api.RegisterPeerFinderServer(srv, &grpcServer{store: store})
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			slog.Error("gRPC server failed", "err", err)
+		}
+	}()
+	slog.Info("Serving gRPC", "address", addr)
+	return nil
+}
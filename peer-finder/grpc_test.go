@@ -0,0 +1,81 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"k8s.io/contrib/peer-finder/pkg/api"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestGRPC(t *testing.T) {
+	pf, err := peerfinder.New(peerfinder.Config{Service: "nginx", Domain: "default.svc.cluster.local", Hostname: "web-0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store := newPeerStore(pf)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr := "unix:" + filepath.Join(t.TempDir(), "peer-finder.sock")
+	if err := serveGRPC(ctx, addr, store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	client := api.NewPeerFinderClient(conn)
+
+	peers, err := client.ListPeers(ctx, &api.ListPeersRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if peers.Updated != nil || len(peers.Peers) != 0 || peers.Self != pf.Self() {
+		t.Errorf("unexpected peers before the first update: %v", peers)
+	}
+
+	stream, err := client.WatchPeers(ctx, &api.WatchPeersRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.set(peerfinder.Update{Peers: []string{"a"}, Details: map[string]peerfinder.Peer{"a": {Port: 80}}, Time: time.Now()})
+	for _, expected := range []struct {
+		added   []string
+		initial bool
+	}{{[]string{"a"}, true}, {[]string{"b"}, false}} {
+		u, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(u.Added, expected.added) || u.Initial != expected.initial {
+			t.Errorf("expected added %v and initial %v, got %v", expected.added, expected.initial, u)
+		}
+		if u.Initial && (len(u.Peers.Peers) != 1 || u.Peers.Peers[0].Port != 80) {
+			t.Errorf("unexpected peers %v", u.Peers.Peers)
+		}
+		store.set(peerfinder.Update{Peers: []string{"a", "b"}, Time: time.Now()})
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// health serves the liveness and readiness of peer-finder on /healthz and
+// /readyz, for Kubernetes probes.
+type health struct {
+	addr  string
+	stale time.Duration
+	pf    *peerfinder.PeerFinder
+	// resolver resolves the pods shaking hands, the system resolver if nil.
+	resolver peerfinder.Resolver
+	ready    atomic.Bool
+	peers    atomic.Pointer[[]string]
+}
+
+func (h *health) addFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&h.stale, "health-stale", 5*time.Minute, "How long the peers may go without being looked up before /healthz fails. 0 only checks that peers are being looked up.")
+}
+
+// addAddressFlag registers the flag of the address health is served on by
+// itself.
+func (h *health) addAddressFlag(fs *flag.FlagSet) {
+	fs.StringVar(&h.addr, "health-address", "", "The address to serve /healthz, /readyz, the peers last applied on /applied-peers and the Prometheus /metrics on, e.g. :8080 or unix:<path> for a Unix socket. Disabled if empty.")
+}
+
+// setReady makes /readyz succeed.
+func (h *health) setReady() {
+	h.ready.Store(true)
+}
+
+// setPeers makes /applied-peers serve peers, those last applied.
+func (h *health) setPeers(peers []string) {
+	h.peers.Store(&peers)
+}
+
+// register adds the health and metrics handlers to mux.
+func (h *health) register(mux *http.ServeMux) {
+	mux.Handle("/metrics", metricsHandler())
+	mux.HandleFunc(peerfinder.HandshakePath, func(w http.ResponseWriter, r *http.Request) {
+		peerfinder.HandshakeHandler(peerfinder.DefaultHandshakeTimeout, h.pf.Service(), h.resolver).ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		active := h.pf.LastActive()
+		switch {
+		case active.IsZero():
+			http.Error(w, "not looking up peers", http.StatusServiceUnavailable)
+		case h.stale > 0 && time.Since(active) > h.stale:
+			http.Error(w, "peers last looked up at "+active.Format(time.RFC3339), http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok\n"))
+		}
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !h.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc(appliedPeersPath, func(w http.ResponseWriter, r *http.Request) {
+		peers := h.peers.Load()
+		if peers == nil {
+			http.Error(w, "no peers applied", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(appliedPeers{Peers: *peers})
+	})
+}
+
+// serve serves health for pf on its address, if any, until ctx is
+// cancelled.
+func (h *health) serve(ctx context.Context, pf *peerfinder.PeerFinder) error {
+	h.pf = pf
+	if h.addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	h.register(mux)
+	return serveHTTP(ctx, "health and metrics", h.addr, mux)
+}
+
+// listen listens on addr, a TCP address or unix:<path> for a Unix socket.
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// Remove the socket left by a previous instance.
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serveHTTP serves handler on addr in the background until ctx is
+// cancelled. what describes what is served in logs.
+func serveHTTP(ctx context.Context, what, addr string, handler http.Handler) error {
+	l, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: handler}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	go func() {
+		if err := srv.Serve(l); err != http.ErrServerClosed {
+			slog.Error("HTTP server failed", "serving", what, "err", err)
+		}
+	}()
+	slog.Info("Serving "+what, "address", addr)
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestHealth(t *testing.T) {
+	pf, err := peerfinder.New(peerfinder.Config{
+		Service:    "svc",
+		Domain:     "default.svc.cluster.local",
+		Hostname:   "a",
+		Discoverer: peerfinder.DiscovererFunc(func(context.Context) ([]peerfinder.Peer, error) { return nil, nil }),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := &health{pf: pf}
+	mux := http.NewServeMux()
+	h.register(mux)
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	if code := status("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected /healthz to fail before start, got %d", code)
+	}
+	pf.Start(context.Background())
+	defer pf.Stop()
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Errorf("expected /healthz to succeed, got %d", code)
+	}
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected /readyz to fail before being ready, got %d", code)
+	}
+	h.setReady()
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Errorf("expected /readyz to succeed, got %d", code)
+	}
+	if code := status("/applied-peers"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected /applied-peers to fail before peers are applied, got %d", code)
+	}
+	h.setPeers([]string{"a"})
+	if code := status("/applied-peers"); code != http.StatusOK {
+		t.Errorf("expected /applied-peers to succeed, got %d", code)
+	}
+}
+
+func TestServeHTTPUnix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "http.sock")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") })
+	if err := serveHTTP(ctx, "test", "unix:"+path, handler); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://localhost/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if b, _ := io.ReadAll(resp.Body); string(b) != "ok" {
+		t.Errorf("expected ok, got %q", b)
+	}
+}
@@ -0,0 +1,394 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// hook is a program run with the new line separated list of peers on stdin.
+type hook struct {
+	// name is how the hook is logged.
+	name string
+	// flag is the hook flag setting it, e.g. on-change, by which its runs
+	// are counted.
+	flag string
+	argv []string
+	opts hookOptions
+	// leaderOnly skips the hook unless this pod leads the peers.
+	leaderOnly bool
+}
+
+// noShell is the -shell running scripts without a shell.
+const noShell = "none"
+
+// scriptHook returns a hook running script with shell. Arguments are passed
+// to the script as $1, $2... With noShell, script is split on spaces and run
+// directly, arguments being appended to its command line.
+func scriptHook(script, shell string) *hook {
+	if shell == noShell {
+		return &hook{name: script, argv: strings.Fields(script)}
+	}
+	return &hook{name: script, argv: []string{shell, "-c", script, "peer-finder"}}
+}
+
+// execHook returns a hook running argv without a shell.
+func execHook(argv []string) *hook {
+	return &hook{name: fmt.Sprintf("%q", argv), argv: argv}
+}
+
+func (h *hook) String() string {
+	return h.name
+}
+
+// LogValue implements slog.LogValuer.
+func (h *hook) LogValue() slog.Value {
+	return slog.StringValue(h.name)
+}
+
+// run runs the hook with sendStdin on stdin, env added to its environment
+// and args appended to its command line. Failures are handled according to
+// -on-script-failure, the error being returned if it is ignored, or an
+// *exitCodeError for the command to exit with if it is not. Retries stop once
+// ctx is cancelled, the last error being returned.
+func (h *hook) run(ctx context.Context, sendStdin string, env []string, args ...string) error {
+	retries := 0
+	if h.opts.onFailure == "retry" {
+		retries = h.opts.retries
+	}
+	backoff := h.opts.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := h.exec(sendStdin, env, args...)
+		for _, o := range h.opts.observers {
+			o.hookRan(h, err)
+		}
+		switch {
+		case err == nil:
+			return nil
+		case attempt < retries:
+			slog.Info("Retrying hook", "hook", h, "backoff", backoff)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				slog.Warn("Not retrying hook, shutting down", "hook", h)
+				return err
+			}
+			backoff *= 2
+		case h.opts.onFailure == "ignore":
+			slog.Warn("Ignoring the failure of hook", "hook", h)
+			return err
+		default:
+			slog.Error("Giving up on hook", "hook", h)
+			return &exitCodeError{exitError, fmt.Errorf("hook %s failed: %w", h, err)}
+		}
+	}
+}
+
+// hookList is a list of hooks run one after the other, such as those of a
+// repeated hook flag.
+type hookList []*hook
+
+func (l hookList) String() string {
+	names := make([]string, 0, len(l))
+	for _, h := range l {
+		names = append(names, h.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// LogValue implements slog.LogValuer.
+func (l hookList) LogValue() slog.Value {
+	return slog.StringValue(l.String())
+}
+
+// run runs the hooks in order, with the arguments of hook.run, recording
+// their runs in the metrics. Each one runs even if the previous one failed
+// and -on-script-failure=ignore, the error of the first one that failed being
+// returned, while those after a hook given up on don't. The hooks of
+// -leader-only are skipped unless this pod leads.
+func (l hookList) run(ctx context.Context, sendStdin string, env []string, args ...string) error {
+	var first error
+	for i, h := range l {
+		if h.leaderOnly && !h.opts.leading() {
+			slog.Info("Skipping hook, this pod is not the leader", "hook", h)
+			continue
+		}
+		start := time.Now()
+		err := h.run(ctx, sendStdin, env, args...)
+		status := observeHook(h, start, err)
+		if fatal(err) != nil {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+		if len(l) == 1 {
+			continue
+		}
+		slog.Info("Hook completed", "hook", h, "index", i+1, "count", len(l), "status", status)
+	}
+	return first
+}
+
+// fatal returns err if it is the failure of a hook that -on-script-failure
+// gives up on, for the command to exit with, nil otherwise.
+func fatal(err error) error {
+	var exit *exitCodeError
+	if errors.As(err, &exit) {
+		return err
+	}
+	return nil
+}
+
+// check runs the hooks in order, once each whatever -on-script-failure, and
+// returns the error of the first one that fails.
+func (l hookList) check(sendStdin string, env []string) error {
+	for _, h := range l {
+		start := time.Now()
+		err := h.exec(sendStdin, env)
+		observeHook(h, start, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exec runs the hook once, killing it and the processes it started if it
+// runs for longer than -script-timeout.
+func (h *hook) exec(sendStdin string, env []string, args ...string) error {
+	ctx, span := tracer.Start(context.Background(), "Hook", trace.WithAttributes(attribute.String("hook.name", h.name), attribute.StringSlice("hook.args", args)))
+	defer span.End()
+	err := h.execContext(ctx, sendStdin, env, args...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// execContext runs the hook once within ctx, the context of its span.
+func (h *hook) execContext(ctx context.Context, sendStdin string, env []string, args ...string) error {
+	slog.Info("Running hook", "hook", h, "args", args)
+	slog.Debug("Hook input", "hook", h, "stdin", sendStdin)
+	argv := h.argv[1:len(h.argv):len(h.argv)]
+	// Like the echo this used to go through, terminate the last line so that
+	// scripts can simply `while read`.
+	stdin := sendStdin + "\n"
+	switch h.opts.peersVia {
+	case "file":
+		path, err := writePeersFile(sendStdin)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(path)
+		argv = append(argv, path)
+		stdin = ""
+	case "arg":
+		if sendStdin != "" {
+			argv = append(argv, strings.Split(sendStdin, "\n")...)
+		}
+		stdin = ""
+	}
+	argv = append(argv, args...)
+	if h.opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.opts.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, h.argv[0], argv...)
+	cmd.Env = append(os.Environ(), env...)
+	if h.opts.leading != nil {
+		cmd.Env = append(cmd.Env, "IS_LEADER="+strconv.FormatBool(h.opts.leading()))
+	}
+	// Run the hook in its own process group, so that the processes it started
+	// are killed with it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Don't wait for the output of orphans that escaped the process group.
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = strings.NewReader(stdin)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("killed after running for %v", h.opts.timeout)
+	}
+	if err != nil {
+		slog.Warn("Hook failed", "hook", h, "output", string(out), "err", err)
+		return err
+	}
+	slog.Info("Hook succeeded", "hook", h, "output", string(out))
+	return nil
+}
+
+// writePeersFile writes peers to a temporary file for -peers-via=file and
+// returns its path.
+func writePeersFile(peers string) (string, error) {
+	f, err := os.CreateTemp("", "peer-finder-peers-")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(peers + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// hookEnv returns the environment variables describing u to hooks, service
+// being the fully qualified name of the governing service. Lists of peers
+// are comma separated.
+func hookEnv(u peerfinder.Update, service string) []string {
+	ordinal := ""
+	if n, ok := peerfinder.Ordinal(u.Self); ok {
+		ordinal = strconv.Itoa(n)
+	}
+	ready, notReady := readiness(u)
+	return []string{
+		"PEERS=" + strings.Join(u.Peers, ","),
+		"PEER_COUNT=" + strconv.Itoa(len(u.Peers)),
+		"PEERS_READY=" + strings.Join(ready, ","),
+		"PEERS_NOT_READY=" + strings.Join(notReady, ","),
+		"PEERS_ADDED=" + strings.Join(u.Added, ","),
+		"PEERS_REMOVED=" + strings.Join(u.Removed, ","),
+		"SELF_NAME=" + u.Self,
+		"SELF_ORDINAL=" + ordinal,
+		"SERVICE_FQDN=" + service,
+	}
+}
+
+// hookOptions are the flags applying to all hooks.
+type hookOptions struct {
+	timeout      time.Duration
+	onFailure    string
+	retries      int
+	retryBackoff time.Duration
+	shell        string
+	peersVia     string
+	// observers are told about each run of the hooks.
+	observers []observer
+	// leading, if set with -leader-elect, returns whether this pod leads the
+	// peers, the hooks of leaderOnly only running if it does.
+	leading    func() bool
+	leaderOnly []string
+}
+
+func (o *hookOptions) addFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&o.timeout, "script-timeout", 0, "How long a hook may run before it is killed, along with the processes it started, and considered failed. 0 lets hooks run for as long as they need.")
+	fs.StringVar(&o.onFailure, "on-script-failure", "fatal", "What to do when a hook fails, one of: fatal (exit), retry (retry -script-retries times, then exit), ignore (carry on).")
+	fs.IntVar(&o.retries, "script-retries", 3, "How many times a failed hook is retried with -on-script-failure=retry.")
+	fs.DurationVar(&o.retryBackoff, "script-retry-backoff", 1*time.Second, "How long to wait before retrying a failed hook the first time, the wait doubling after each retry.")
+	fs.StringVar(&o.peersVia, "peers-via", "stdin", "How hooks receive the peers, one of: stdin, file (written to a temporary file whose path is the first argument), arg (one argument per line, requires -output=text without -format).")
+	fs.StringVar(&o.shell, "shell", "bash", "The shell scripts are run with, e.g. /bin/sh on images without bash, or none to split scripts on spaces and run them without a shell.")
+}
+
+// validate checks the options.
+func (o *hookOptions) validate() error {
+	switch o.onFailure {
+	case "fatal", "retry", "ignore":
+	default:
+		return fmt.Errorf("unknown -on-script-failure policy %q", o.onFailure)
+	}
+	switch o.peersVia {
+	case "stdin", "file", "arg":
+	default:
+		return fmt.Errorf("unknown -peers-via %q", o.peersVia)
+	}
+	if o.shell == "" {
+		return fmt.Errorf("-shell must not be empty, use -shell=%s to run scripts without a shell", noShell)
+	}
+	return nil
+}
+
+// checkOutput returns an error if the hooks cannot receive the peers as
+// rendered by out: -peers-via=arg passes one argument per line, which only
+// makes sense of the list of peers, not of a document.
+func (o *hookOptions) checkOutput(out *outputOptions) error {
+	if o.peersVia == "arg" && !out.list() {
+		return fmt.Errorf("-peers-via=arg requires -output=text without -format")
+	}
+	return nil
+}
+
+// hookFlag holds the pair of flags configuring a hook, -<name> for a shell
+// script and -<name>-exec for a program run directly.
+type hookFlag struct {
+	name    string
+	scripts stringList
+	exec    argvFlag
+	opts    *hookOptions
+}
+
+// addHookFlag registers the flags of the hook name, configured with o.
+func (o *hookOptions) addHookFlag(fs *flag.FlagSet, name, usage string) *hookFlag {
+	h := &hookFlag{name: name, opts: o}
+	fs.Var(&h.scripts, name, usage+" May be repeated to run several scripts in order.")
+	fs.Var(&h.exec, name+"-exec", fmt.Sprintf("Like -%s, but runs a program without a shell. Its command line is given as a JSON array or by repeating the flag once per argument.", name))
+	return h
+}
+
+// hook returns the configured hooks, nil if there are none.
+func (h *hookFlag) hook() (hookList, error) {
+	var l hookList
+	switch {
+	case len(h.scripts) > 0 && len(h.exec) > 0:
+		return nil, fmt.Errorf("only one of -%s and -%s-exec may be set", h.name, h.name)
+	case len(h.scripts) > 0:
+		for _, s := range h.scripts {
+			if strings.TrimSpace(s) == "" {
+				return nil, fmt.Errorf("-%s must not be empty", h.name)
+			}
+			l = append(l, scriptHook(s, h.opts.shell))
+		}
+	case len(h.exec) > 0:
+		l = hookList{execHook(h.exec)}
+	default:
+		return nil, nil
+	}
+	if err := h.opts.validate(); err != nil {
+		return nil, err
+	}
+	leaderOnly := slices.Contains(h.opts.leaderOnly, h.name)
+	for _, hk := range l {
+		hk.opts, hk.leaderOnly, hk.flag = *h.opts, leaderOnly, h.name
+	}
+	return l, nil
+}
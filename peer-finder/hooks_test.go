@@ -0,0 +1,228 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestHookArgs(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	cases := []struct {
+		name string
+		h    *hook
+	}{
+		{"script", scriptHook(`read stdin; echo "$stdin $1" > `+out, "bash")},
+		{"sh", scriptHook(`read stdin; echo "$stdin $1" > `+out, "/bin/sh")},
+		{"exec", execHook([]string{"bash", "-c", `read stdin; echo "$stdin $1" > ` + out, "hook"})},
+	}
+	for _, c := range cases {
+		c.h.run(context.Background(), "web-1", nil, "web-1")
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got, expected := string(b), "web-1 web-1\n"; got != expected {
+			t.Errorf("%s: expected %q, got %q", c.name, expected, got)
+		}
+	}
+}
+
+func TestHookPeersVia(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	cases := []struct {
+		via    string
+		script string
+	}{
+		{"stdin", `cat > ` + out},
+		{"file", `cat "$1" > ` + out},
+		{"arg", `printf '%s\n' "$@" > ` + out},
+	}
+	for _, c := range cases {
+		h := scriptHook(c.script, "bash")
+		h.opts.peersVia = c.via
+		if err := h.exec("web-0\nweb-1", nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.via, err)
+		}
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("%s: %v", c.via, err)
+		}
+		if got, expected := string(b), "web-0\nweb-1\n"; got != expected {
+			t.Errorf("%s: expected %q, got %q", c.via, expected, got)
+		}
+	}
+}
+
+func TestScriptHookNoShell(t *testing.T) {
+	h := scriptHook("/reload  --all", noShell)
+	if expected := []string{"/reload", "--all"}; !reflect.DeepEqual(h.argv, expected) {
+		t.Errorf("expected %q, got %q", expected, h.argv)
+	}
+}
+
+func TestHookEnv(t *testing.T) {
+	expected := []string{
+		"PEERS=web-0.nginx.default.svc.cluster.local,web-1.nginx.default.svc.cluster.local",
+		"PEER_COUNT=2",
+		"PEERS_READY=web-0.nginx.default.svc.cluster.local",
+		"PEERS_NOT_READY=web-1.nginx.default.svc.cluster.local",
+		"PEERS_ADDED=web-1.nginx.default.svc.cluster.local",
+		"PEERS_REMOVED=",
+		"SELF_NAME=web-0.nginx.default.svc.cluster.local",
+		"SELF_ORDINAL=0",
+		"SERVICE_FQDN=nginx.default.svc.cluster.local",
+	}
+	u := testUpdate
+	u.Details = map[string]peerfinder.Peer{"web-1.nginx.default.svc.cluster.local": {NotReady: true}}
+	if got := hookEnv(u, "nginx.default.svc.cluster.local"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	h := scriptHook("sleep 10 & sleep 10", "bash")
+	h.opts.timeout = 100 * time.Millisecond
+	start := time.Now()
+	if err := h.exec("", nil); err == nil {
+		t.Errorf("expected an error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expected the hook to be killed, it ran for %v", d)
+	}
+}
+
+func TestHookFailure(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	// Fails the first time only.
+	h := scriptHook(`[ -e `+marker+` ] || { touch `+marker+`; exit 1; }`, "bash")
+	h.opts = hookOptions{onFailure: "retry", retries: 1, retryBackoff: time.Millisecond}
+	h.run(context.Background(), "", nil)
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("expected the hook to have run: %v", err)
+	}
+
+	h = scriptHook("exit 1", "bash")
+	h.opts = hookOptions{onFailure: "ignore"}
+	if err := h.run(context.Background(), "", nil); err == nil || fatal(err) != nil {
+		t.Errorf("expected the failure to be ignored, got %v", err)
+	}
+
+	// Giving up returns the error to exit with, for the deferred cleanups
+	// to run.
+	h.opts = hookOptions{onFailure: "fatal"}
+	var exit *exitCodeError
+	if err := h.run(context.Background(), "", nil); !errors.As(err, &exit) || exit.code != exitError {
+		t.Errorf("expected an exit code error, got %v", err)
+	}
+
+	// Retries stop on shutdown.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.opts = hookOptions{onFailure: "retry", retries: 3, retryBackoff: time.Hour}
+	if err := h.run(ctx, "", nil); err == nil || fatal(err) != nil {
+		t.Errorf("expected the error of the last run, got %v", err)
+	}
+}
+
+func TestHookLeader(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	leading := false
+	var f hookFlag
+	f.name = "on-start"
+	f.opts = &hookOptions{onFailure: "fatal", shell: "bash", peersVia: "stdin", leaderOnly: []string{"on-start"}, leading: func() bool { return leading }}
+	f.scripts.Set(`echo "$IS_LEADER" >> ` + out)
+	l, err := f.hook()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.run(context.Background(), "", nil)
+	if _, err := os.Stat(out); err == nil {
+		t.Errorf("expected the hook not to run on a follower")
+	}
+	leading = true
+	l.run(context.Background(), "", nil)
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("expected the hook to run on the leader: %v", err)
+	}
+	if string(b) != "true\n" {
+		t.Errorf("expected IS_LEADER=true, got %q", b)
+	}
+
+	// Other hooks run either way, knowing whether this pod leads.
+	leading = false
+	f.name = "on-change"
+	if l, err = f.hook(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.run(context.Background(), "", nil)
+	if b, _ = os.ReadFile(out); string(b) != "true\nfalse\n" {
+		t.Errorf("expected IS_LEADER=false, got %q", b)
+	}
+}
+
+func TestHookList(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	var f hookFlag
+	f.opts = &hookOptions{onFailure: "ignore", shell: "bash", peersVia: "stdin"}
+	for _, s := range []string{"echo first >> " + out, "exit 1", "echo second >> " + out} {
+		f.scripts.Set(s)
+	}
+	l, err := f.hook()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.run(context.Background(), "", nil); err == nil {
+		t.Errorf("expected the error of the failed hook")
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if expected := "first\nsecond\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+}
+
+func TestHookCheckOutput(t *testing.T) {
+	cases := []struct {
+		peersVia string
+		out      outputOptions
+		valid    bool
+	}{
+		{"arg", outputOptions{output: "text"}, true},
+		{"arg", outputOptions{output: "text", withPort: true}, true},
+		{"arg", outputOptions{output: "json"}, false},
+		{"arg", outputOptions{output: "text", format: "etcd"}, false},
+		{"file", outputOptions{output: "json"}, true},
+	}
+	for _, c := range cases {
+		o := hookOptions{peersVia: c.peersVia}
+		if err := o.checkOutput(&c.out); (err == nil) != c.valid {
+			t.Errorf("-peers-via=%s with %+v: expected valid=%v, got %v", c.peersVia, c.out, c.valid, err)
+		}
+	}
+}
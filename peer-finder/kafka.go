@@ -0,0 +1,130 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/hamba/avro/v2"
+	"github.com/segmentio/kafka-go"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// notificationSchema is the Avro schema of the records produced with
+// -kafka-format=avro.
+const notificationSchema = `{
+  "type": "record",
+  "name": "PeersChange",
+  "namespace": "io.k8s.peerfinder",
+  "fields": [
+    {"name": "time", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "self", "type": "string"},
+    {"name": "old", "type": {"type": "array", "items": "string"}},
+    {"name": "new", "type": {"type": "array", "items": "string"}},
+    {"name": "added", "type": {"type": "array", "items": "string"}},
+    {"name": "removed", "type": {"type": "array", "items": "string"}}
+  ]
+}`
+
+// kafkaOptions are the flags of the Kafka topic the changes of the peers are
+// produced to.
+type kafkaOptions struct {
+	brokers stringList
+	topic   string
+	format  string
+}
+
+func (o *kafkaOptions) addFlags(fs *flag.FlagSet) {
+	fs.Var(&o.brokers, "kafka-brokers", "The addresses of the Kafka brokers each change of the peers is produced to, comma separated or by repeating the flag. Disabled if empty.")
+	fs.StringVar(&o.topic, "kafka-topic", "peer-finder", "The Kafka topic the changes are produced to, keyed by the name of this pod.")
+	fs.StringVar(&o.format, "kafka-format", "json", "The format of the records, one of: json (the document POSTed to -notify-url), avro (its binary Avro encoding, the schema being in the README).")
+}
+
+// messageWriter is implemented by *kafka.Writer.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// kafkaObserver produces the changes of the peers to a Kafka topic.
+type kafkaObserver struct {
+	w      messageWriter
+	encode func(notification) ([]byte, error)
+}
+
+// encoder returns how records are encoded in format.
+func encoder(format string) (func(notification) ([]byte, error), error) {
+	switch format {
+	case "json":
+		return func(n notification) ([]byte, error) { return json.Marshal(n) }, nil
+	case "avro":
+		schema, err := avro.Parse(notificationSchema)
+		if err != nil {
+			return nil, err
+		}
+		return func(n notification) ([]byte, error) { return avro.Marshal(schema, n) }, nil
+	}
+	return nil, fmt.Errorf("unknown -kafka-format %q", format)
+}
+
+// observer returns a kafkaObserver producing records in the background, the
+// writer being closed once ctx is cancelled.
+func (o *kafkaOptions) observer(ctx context.Context) (*kafkaObserver, error) {
+	encode, err := encoder(o.format)
+	if err != nil {
+		return nil, err
+	}
+	var brokers []string
+	for _, b := range o.brokers {
+		brokers = append(brokers, strings.Split(b, ",")...)
+	}
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        o.topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Async:        true,
+		Completion: func(_ []kafka.Message, err error) {
+			if err != nil {
+				slog.Warn("Failed to produce to Kafka", "topic", o.topic, "err", err)
+			}
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		w.Close()
+	}()
+	return &kafkaObserver{w: w, encode: encode}, nil
+}
+
+func (o *kafkaObserver) applying(base *peerfinder.Update, u peerfinder.Update) {
+	b, err := o.encode(newNotification(base, u))
+	if err == nil {
+		// Asynchronous, errors are reported to the completion callback.
+		err = o.w.WriteMessages(context.Background(), kafka.Message{Key: []byte(u.Self), Value: b})
+	}
+	if err != nil {
+		slog.Warn("Failed to produce to Kafka", "err", err)
+	}
+}
+
+func (o *kafkaObserver) hookRan(*hook, error) {}
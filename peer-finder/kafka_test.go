@@ -0,0 +1,81 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/segmentio/kafka-go"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// fakeWriter records the messages written.
+type fakeWriter struct {
+	msgs []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func TestKafkaObserver(t *testing.T) {
+	schema := avro.MustParse(notificationSchema)
+	decoders := map[string]func([]byte, *notification) error{
+		"json": func(b []byte, n *notification) error { return json.Unmarshal(b, n) },
+		"avro": func(b []byte, n *notification) error { return avro.Unmarshal(schema, b, n) },
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	base := &peerfinder.Update{Peers: []string{"a"}}
+	u := peerfinder.Update{Peers: []string{"a", "b"}, Added: []string{"b"}, Self: "a", Time: now}
+	expected := notification{Time: now, Self: "a", Old: []string{"a"}, New: []string{"a", "b"}, Added: []string{"b"}, Removed: []string{}}
+	for format, decode := range decoders {
+		encode, err := encoder(format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		w := &fakeWriter{}
+		(&kafkaObserver{w: w, encode: encode}).applying(base, u)
+		if len(w.msgs) != 1 || string(w.msgs[0].Key) != "a" {
+			t.Fatalf("%s: expected one message keyed by a, got %v", format, w.msgs)
+		}
+		var n notification
+		if err := decode(w.msgs[0].Value, &n); err != nil {
+			t.Fatalf("%s: invalid record: %v", format, err)
+		}
+		if !n.Time.Equal(expected.Time) {
+			t.Errorf("%s: expected time %v, got %v", format, expected.Time, n.Time)
+		}
+		n.Time = expected.Time
+		if n.Removed == nil {
+			// Empty Avro arrays are decoded as nil.
+			n.Removed = []string{}
+		}
+		if !reflect.DeepEqual(n, expected) {
+			t.Errorf("%s: expected %+v, got %+v", format, expected, n)
+		}
+	}
+	if _, err := encoder("xml"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+// leaderOnlyHooks are the hooks -leader-only may list.
+var leaderOnlyHooks = []string{"on-start", "on-change", "on-peer-added", "on-peer-removed", "on-stop", "on-scale-down"}
+
+// leaderOptions are the flags of the election of a leader among the peers.
+type leaderOptions struct {
+	elect bool
+	lease string
+	only  stringList
+}
+
+func (o *leaderOptions) addFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.elect, "leader-elect", false, "Whether the peers elect a leader through a Lease of the namespace, IS_LEADER being set to true or false for hooks. This requires permission to get, create and update leases.")
+	fs.StringVar(&o.lease, "leader-elect-lease", "", "The name of the Lease of -leader-elect, <service>-leader if empty.")
+	fs.Var(&o.only, "leader-only", "The hooks only run on the leader with -leader-elect, one of: "+strings.Join(leaderOnlyHooks, ", ")+". May be comma separated or repeated.")
+}
+
+// elector returns the LeaseElector of the pod named pod in ns, nil without
+// -leader-elect, campaigning until ctx is cancelled. It returns once a leader
+// is known, so that leader-only hooks run on one of the peers.
+func (o *leaderOptions) elector(ctx context.Context, ns, service, pod string) (*kube.LeaseElector, error) {
+	for _, h := range o.only.split() {
+		if !slices.Contains(leaderOnlyHooks, h) {
+			return nil, fmt.Errorf("unknown -leader-only hook %q, must be one of: %s", h, strings.Join(leaderOnlyHooks, ", "))
+		}
+	}
+	if !o.elect {
+		if len(o.only) > 0 {
+			return nil, fmt.Errorf("-leader-only requires -leader-elect")
+		}
+		return nil, nil
+	}
+	lease := o.lease
+	if lease == "" {
+		lease = service + "-leader"
+	}
+	client, err := kube.InClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	e, err := kube.NewLeaseElector(client, ns, lease, pod)
+	if err != nil {
+		return nil, err
+	}
+	go e.Run(ctx)
+	if err := e.WaitForLeader(ctx); err != nil {
+		return nil, fmt.Errorf("no leader of Lease %s/%s: %v", ns, lease, err)
+	}
+	return e, nil
+}
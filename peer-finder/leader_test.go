@@ -0,0 +1,41 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLeaderOptionsValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		opts leaderOptions
+	}{
+		{"unknown hook", leaderOptions{elect: true, only: stringList{"on-start,on-change-check"}}},
+		{"without election", leaderOptions{only: stringList{"on-start"}}},
+	}
+	for _, c := range cases {
+		if _, err := c.opts.elector(context.Background(), "default", "web", "web-0"); err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+	var none leaderOptions
+	if e, err := none.elector(context.Background(), "default", "web", "web-0"); e != nil || err != nil {
+		t.Errorf("expected no elector without -leader-elect, got %v, %v", e, err)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logger.Debug("hidden")
+	logger.Info("Peers updated", "now", []string{"a", "b"})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected a single line, got %q", lines)
+	}
+	var entry struct {
+		Level string   `json:"level"`
+		Msg   string   `json:"msg"`
+		Now   []string `json:"now"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[0], err)
+	}
+	if entry.Level != "INFO" || entry.Msg != "Peers updated" || len(entry.Now) != 2 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	buf.Reset()
+	if logger, err = newLogger(&buf, "text", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logger.Debug("shown")
+	if !strings.Contains(buf.String(), "level=DEBUG msg=shown") {
+		t.Errorf("expected a debug line, got %q", buf.String())
+	}
+
+	if _, err := newLogger(&buf, "xml", 0); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+var (
+	// registry holds the metrics of peer-finder.
+	registry = prometheus.NewRegistry()
+
+	dnsLookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "peer_finder_dns_lookup_duration_seconds",
+		Help:    "The duration of the DNS lookups of the peers, by name looked up, record type and result.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"name", "type", "result"})
+	dnsAnswerRecords = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "peer_finder_dns_answer_records",
+		Help:    "The count of records of the successful DNS lookups of the peers, by name looked up and record type.",
+		Buckets: []float64{0, 1, 2, 3, 5, 10, 20, 50, 100, 200, 500},
+	}, []string{"name", "type"})
+	hookRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "peer_finder_hook_runs_total",
+		Help: "The runs of the hooks by hook flag and status, succeeded or failed once retried.",
+	}, []string{"hook", "status"})
+	hookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "peer_finder_hook_duration_seconds",
+		Help:    "The duration of the runs of the hooks, retries included, by hook flag.",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"hook"})
+	splitBrainDetected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_finder_split_brain",
+		Help: "1 while the peers have disagreed with this pod on the membership for longer than -split-brain-after, 0 otherwise.",
+	})
+	divergentPeers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "peer_finder_divergent_peers",
+		Help: "The count of peers whose peers differed from those of this pod when last checked with -split-brain-after.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		dnsLookupDuration,
+		dnsAnswerRecords,
+		hookRuns,
+		hookDuration,
+		splitBrainDetected,
+		divergentPeers,
+	)
+}
+
+// metricsHandler serves the metrics in the Prometheus format.
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// instrumentedResolver records the latency and answer size of the lookups of
+// a peerfinder.Resolver.
+type instrumentedResolver struct {
+	peerfinder.Resolver
+}
+
+// instrument returns r recording metrics, net.DefaultResolver if r is nil.
+func instrument(r peerfinder.Resolver) peerfinder.Resolver {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	return instrumentedResolver{r}
+}
+
+func observeLookup(name, qtype string, start time.Time, records int, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	dnsLookupDuration.WithLabelValues(name, qtype, result).Observe(time.Since(start).Seconds())
+	if err == nil {
+		dnsAnswerRecords.WithLabelValues(name, qtype).Observe(float64(records))
+	}
+}
+
+func (r instrumentedResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	start := time.Now()
+	cname, srvs, err := r.Resolver.LookupSRV(ctx, service, proto, name)
+	observeLookup(name, "SRV", start, len(srvs), err)
+	return cname, srvs, err
+}
+
+func (r instrumentedResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	start := time.Now()
+	ips, err := r.Resolver.LookupIP(ctx, network, host)
+	qtype := map[string]string{"ip4": "A", "ip6": "AAAA"}[network]
+	if qtype == "" {
+		qtype = "A+AAAA"
+	}
+	observeLookup(host, qtype, start, len(ips), err)
+	return ips, err
+}
+
+// TTL implements peerfinder.TTLer if the wrapped Resolver does.
+func (r instrumentedResolver) TTL() time.Duration {
+	if t, ok := r.Resolver.(peerfinder.TTLer); ok {
+		return t.TTL()
+	}
+	return 0
+}
+
+// observeHook records the run of h started at start, err being why it
+// failed, and returns its status.
+func observeHook(h *hook, start time.Time, err error) string {
+	status := "succeeded"
+	if err != nil {
+		status = "failed"
+	}
+	hookRuns.WithLabelValues(h.flag, status).Inc()
+	hookDuration.WithLabelValues(h.flag).Observe(time.Since(start).Seconds())
+	return status
+}
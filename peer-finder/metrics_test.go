@@ -0,0 +1,116 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeResolver returns its records or err.
+type fakeResolver struct {
+	srvs []*net.SRV
+	err  error
+}
+
+func (r fakeResolver) LookupSRV(context.Context, string, string, string) (string, []*net.SRV, error) {
+	return "", r.srvs, r.err
+}
+
+func (r fakeResolver) LookupIP(context.Context, string, string) ([]net.IP, error) {
+	return nil, r.err
+}
+
+func (r fakeResolver) TTL() time.Duration {
+	return 30 * time.Second
+}
+
+// histogram returns the count and sum of the samples of o, one of the
+// histograms of a HistogramVec.
+func histogram(t *testing.T, o prometheus.Observer) (uint64, float64) {
+	var m dto.Metric
+	if err := o.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestInstrumentedResolver(t *testing.T) {
+	// The metrics are global, only what the lookups added is checked.
+	records := dnsAnswerRecords.WithLabelValues("metrics-test", "SRV")
+	srv := dnsLookupDuration.WithLabelValues("metrics-test", "SRV", "success")
+	ip := dnsLookupDuration.WithLabelValues("metrics-test", "A", "error")
+	count, sum := histogram(t, records)
+	srvCount, _ := histogram(t, srv)
+	ipCount, _ := histogram(t, ip)
+
+	r := instrument(fakeResolver{srvs: []*net.SRV{{Target: "web-0"}, {Target: "web-1"}}})
+	r.LookupSRV(context.Background(), "", "", "metrics-test")
+	instrument(fakeResolver{err: errors.New("timeout")}).LookupIP(context.Background(), "ip4", "metrics-test")
+
+	if n, s := histogram(t, records); n != count+1 || s != sum+2 {
+		t.Errorf("expected 1 more lookup of 2 records, got %d more of %v", n-count, s-sum)
+	}
+	if n, _ := histogram(t, srv); n != srvCount+1 {
+		t.Errorf("expected 1 more successful SRV lookup, got %d", n-srvCount)
+	}
+	if n, _ := histogram(t, ip); n != ipCount+1 {
+		t.Errorf("expected 1 more failed A lookup, got %d", n-ipCount)
+	}
+	// Failed lookups have no answer.
+	if n, _ := histogram(t, dnsAnswerRecords.WithLabelValues("metrics-test", "A")); n != 0 {
+		t.Errorf("expected no answer records of the failed lookup, got %d", n)
+	}
+	if ttl := r.(instrumentedResolver).TTL(); ttl != 30*time.Second {
+		t.Errorf("expected the TTL of the wrapped resolver, got %v", ttl)
+	}
+}
+
+func TestHookMetrics(t *testing.T) {
+	var f hookFlag
+	f.name = "on-metrics-test"
+	f.opts = &hookOptions{onFailure: "ignore", shell: "bash", peersVia: "stdin"}
+	f.scripts.Set("true")
+	f.scripts.Set("exit 1")
+	l, err := f.hook()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The metrics are global, only what the runs added is checked.
+	before := map[string]float64{}
+	for _, status := range []string{"succeeded", "failed"} {
+		before[status] = testutil.ToFloat64(hookRuns.WithLabelValues("on-metrics-test", status))
+	}
+	count, _ := histogram(t, hookDuration.WithLabelValues("on-metrics-test"))
+	l.run(context.Background(), "", nil)
+	l.run(context.Background(), "", nil)
+	for status, n := range before {
+		if added := testutil.ToFloat64(hookRuns.WithLabelValues("on-metrics-test", status)) - n; added != 2 {
+			t.Errorf("expected 2 more %s runs, got %v", status, added)
+		}
+	}
+	if n, _ := histogram(t, hookDuration.WithLabelValues("on-metrics-test")); n != count+4 {
+		t.Errorf("expected the 4 runs to be timed, got %d", n-count)
+	}
+}
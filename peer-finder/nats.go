@@ -0,0 +1,90 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// natsOptions are the flags of the NATS subject the changes of the peers are
+// published to.
+type natsOptions struct {
+	url     string
+	subject string
+	creds   string
+}
+
+func (o *natsOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "nats-url", "", "The URL of the NATS server each change of the peers is published to, as the JSON document POSTed to -notify-url, e.g. nats://nats:4222. Disabled if empty.")
+	fs.StringVar(&o.subject, "nats-subject", "", "The NATS subject the changes are published to, peer-finder.<namespace>.<service> if empty.")
+	fs.StringVar(&o.creds, "nats-creds", "", "A NATS credentials file to authenticate with.")
+}
+
+// natsObserver publishes the changes of the peers to a NATS subject.
+type natsObserver struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// observer connects to the NATS server, the connection being drained once
+// ctx is cancelled. The connection is retried forever in the background,
+// changes being buffered meanwhile, so that NATS being down doesn't prevent
+// peer-finder from starting.
+func (o *natsOptions) observer(ctx context.Context) (*natsObserver, error) {
+	opts := []nats.Option{
+		nats.Name("peer-finder"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				slog.Warn("Disconnected from NATS", "url", o.url, "err", err)
+			}
+		}),
+	}
+	if o.creds != "" {
+		opts = append(opts, nats.UserCredentials(o.creds))
+	}
+	conn, err := nats.Connect(o.url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to NATS: %v", err)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Drain()
+	}()
+	return &natsObserver{conn: conn, subject: o.subject}, nil
+}
+
+func (o *natsObserver) applying(base *peerfinder.Update, u peerfinder.Update) {
+	b, err := json.Marshal(newNotification(base, u))
+	if err == nil {
+		err = o.conn.Publish(o.subject, b)
+	}
+	if err != nil {
+		slog.Warn("Failed to publish to NATS", "subject", o.subject, "err", err)
+	}
+}
+
+func (o *natsObserver) hookRan(*hook, error) {}
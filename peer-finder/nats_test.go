@@ -0,0 +1,67 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestNATSObserver(t *testing.T) {
+	server := natsserver.RunRandClientPortServer()
+	defer server.Shutdown()
+	conn, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("peer-finder.default.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn.Flush()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o := &natsOptions{url: server.ClientURL(), subject: "peer-finder.default.nginx"}
+	obs, err := o.observer(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	base := &peerfinder.Update{Peers: []string{"a"}}
+	obs.applying(base, peerfinder.Update{Peers: []string{"a", "b"}, Added: []string{"b"}})
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var n notification
+	if err := json.Unmarshal(msg.Data, &n); err != nil {
+		t.Fatalf("invalid notification %q: %v", msg.Data, err)
+	}
+	expected := notification{Old: []string{"a"}, New: []string{"a", "b"}, Added: []string{"b"}, Removed: []string{}}
+	if msg.Subject != o.subject || !reflect.DeepEqual(n, expected) {
+		t.Errorf("expected %+v on %s, got %+v on %s", expected, o.subject, n, msg.Subject)
+	}
+}
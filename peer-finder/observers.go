@@ -0,0 +1,195 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+// observer is told about the peers watch applies and the runs of hooks,
+// e.g. to keep a record of them.
+type observer interface {
+	// applying is called before u is applied, its hooks running next, base
+	// being the update applied before, nil for the initial one.
+	applying(base *peerfinder.Update, u peerfinder.Update)
+	// hookRan is called after each run of a hook, err being why it failed.
+	hookRan(h *hook, err error)
+}
+
+// eventTimeout bounds the time spent posting an event.
+const eventTimeout = 10 * time.Second
+
+// eventQueue is the count of events waiting to be posted beyond which new
+// ones are dropped.
+const eventQueue = 64
+
+// eventMessageLimit is the length beyond which the messages of events are
+// cut, that of the notes of events.k8s.io.
+const eventMessageLimit = 1024
+
+// event is an event waiting to be posted.
+type event struct {
+	eventType, reason, message string
+}
+
+// eventObserver posts Kubernetes events on this pod in the background, so
+// that a slow API server does not delay the hooks.
+type eventObserver struct {
+	recorder *kube.EventRecorder
+	queue    chan event
+}
+
+// newEventObserver returns an eventObserver for the pod named pod in ns.
+func newEventObserver(ctx context.Context, ns, pod string) (*eventObserver, error) {
+	client, err := kube.InClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	r, err := kube.NewPodEventRecorder(ctx, client, ns, pod)
+	if err != nil {
+		return nil, fmt.Errorf("cannot post events on pod %s/%s: %v", ns, pod, err)
+	}
+	return postEvents(ctx, r), nil
+}
+
+// postEvents returns an eventObserver posting events with r until ctx is
+// cancelled.
+func postEvents(ctx context.Context, r *kube.EventRecorder) *eventObserver {
+	o := &eventObserver{recorder: r, queue: make(chan event, eventQueue)}
+	go o.run(ctx)
+	return o
+}
+
+// event queues an event, its message cut to eventMessageLimit.
+func (o *eventObserver) event(eventType, reason, message string) {
+	if len(message) > eventMessageLimit {
+		cut := eventMessageLimit - len("...")
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		message = message[:cut] + "..."
+	}
+	select {
+	case o.queue <- event{eventType, reason, message}:
+	default:
+		slog.Warn("Dropping event, too many are pending", "reason", reason)
+	}
+}
+
+// run posts the queued events until ctx is cancelled.
+func (o *eventObserver) run(ctx context.Context) {
+	for {
+		select {
+		case e := <-o.queue:
+			pctx, cancel := context.WithTimeout(ctx, eventTimeout)
+			if err := o.recorder.Event(pctx, e.eventType, e.reason, e.message); err != nil {
+				slog.Warn("Failed to post event", "reason", e.reason, "err", err)
+			}
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (o *eventObserver) applying(base *peerfinder.Update, u peerfinder.Update) {
+	if base == nil {
+		o.event(corev1.EventTypeNormal, "PeersFound", fmt.Sprintf("Found %d peers: %s", len(u.Peers), strings.Join(u.Peers, ", ")))
+		return
+	}
+	o.event(corev1.EventTypeNormal, "PeersChanged", fmt.Sprintf("Added [%s], removed [%s], %d peers", strings.Join(u.Added, ", "), strings.Join(u.Removed, ", "), len(u.Peers)))
+}
+
+func (o *eventObserver) hookRan(h *hook, err error) {
+	if err != nil {
+		o.event(corev1.EventTypeWarning, "HookFailed", fmt.Sprintf("Hook %s failed: %v", h, err))
+	}
+}
+
+// auditRecord is a line of the audit file.
+type auditRecord struct {
+	Time time.Time `json:"time"`
+	// Event is "change" for a change of the peers, "hook" for a run of a
+	// hook.
+	Event string   `json:"event"`
+	Old   []string `json:"old"`
+	New   []string `json:"new"`
+	Hook  string   `json:"hook,omitempty"`
+	// ExitStatus is the exit status of the hook, 0 if it succeeded.
+	ExitStatus *int   `json:"exit_status,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// auditObserver appends a JSON record of each change of the peers and each
+// run of a hook to a file.
+type auditObserver struct {
+	f        *os.File
+	old, new []string
+}
+
+// newAuditObserver returns an auditObserver appending to the file at path.
+func newAuditObserver(path string) (*auditObserver, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &auditObserver{f: f, old: []string{}, new: []string{}}, nil
+}
+
+func (o *auditObserver) write(r auditRecord) {
+	b, err := json.Marshal(r)
+	if err == nil {
+		_, err = o.f.Write(append(b, '\n'))
+	}
+	if err == nil {
+		// The file is read after incidents, which may as well be crashes.
+		err = o.f.Sync()
+	}
+	if err != nil {
+		slog.Warn("Failed to write audit record", "path", o.f.Name(), "err", err)
+	}
+}
+
+func (o *auditObserver) applying(base *peerfinder.Update, u peerfinder.Update) {
+	o.old = []string{}
+	if base != nil {
+		o.old = base.Peers
+	}
+	o.new = u.Peers
+	o.write(auditRecord{Time: time.Now(), Event: "change", Old: o.old, New: o.new})
+}
+
+func (o *auditObserver) hookRan(h *hook, err error) {
+	status := exitCode(err)
+	r := auditRecord{Time: time.Now(), Event: "hook", Old: o.old, New: o.new, Hook: h.String(), ExitStatus: &status}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	o.write(r)
+}
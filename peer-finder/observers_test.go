@@ -0,0 +1,107 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+func TestAuditObserver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.json")
+	o, err := newAuditObserver(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	initial := peerfinder.Update{Peers: []string{"a"}}
+	o.applying(nil, initial)
+	o.applying(&initial, peerfinder.Update{Peers: []string{"a", "b"}})
+	o.hookRan(scriptHook("exit 1", "bash"), errors.New("failed"))
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	var records []auditRecord
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var r auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	if r := records[0]; r.Event != "change" || len(r.Old) != 0 || !reflect.DeepEqual(r.New, []string{"a"}) {
+		t.Errorf("unexpected initial record %+v", r)
+	}
+	r := records[2]
+	if r.Event != "hook" || r.Hook != "exit 1" || r.ExitStatus == nil || *r.ExitStatus != exitError || !reflect.DeepEqual(r.New, []string{"a", "b"}) {
+		t.Errorf("unexpected hook record %+v", r)
+	}
+}
+
+func TestEventObserver(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"}})
+	r, err := kube.NewPodEventRecorder(ctx, client, "default", "web-0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	o := postEvents(ctx, r)
+	var u peerfinder.Update
+	for i := range 100 {
+		u.Peers = append(u.Peers, fmt.Sprintf("web-%d.nginx.default.svc.cluster.local", i))
+	}
+	// Posted in the background, with the list of peers cut.
+	o.applying(nil, u)
+	for {
+		events, err := client.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events.Items) == 1 {
+			if e := events.Items[0]; e.Reason != "PeersFound" || len(e.Message) > eventMessageLimit {
+				t.Errorf("expected a PeersFound event of at most %d bytes, got %s of %d", eventMessageLimit, e.Reason, len(e.Message))
+			}
+			return
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("expected the event to be posted")
+		}
+	}
+}
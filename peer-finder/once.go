@@ -0,0 +1,106 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func runOnce(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	var o options
+	o.addFlags(fs)
+	var out outputOptions
+	out.addFlags(fs)
+	var files fileOptions
+	files.addFlags(fs)
+	var hooks hookOptions
+	hooks.addFlags(fs)
+	onStartFlag := hooks.addHookFlag(fs, "on-start", "Script to run with the new line separated list of peers via stdin. If unset, the peers are printed on stdout.")
+	timeout := fs.Duration("timeout", 0, "How long to wait for this pod to be found among the peers before exiting with code 3. 0 waits until it is.")
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+	onStart, err := onStartFlag.hook()
+	if err != nil {
+		return err
+	}
+	render, err := out.renderer()
+	if err != nil {
+		return err
+	}
+	if err := hooks.checkOutput(&out); err != nil {
+		return err
+	}
+	outputs, err := files.load(render)
+	if err != nil {
+		return err
+	}
+
+	pf, err := o.peerFinder(ctx)
+	if err != nil {
+		return err
+	}
+	u, err := awaitSelf(ctx, pf, *timeout)
+	if err != nil || u == nil {
+		return err
+	}
+	if err := outputs.write(*u); err != nil {
+		return err
+	}
+	in, err := render(*u)
+	if err != nil {
+		return err
+	}
+	if onStart == nil {
+		fmt.Println(in)
+		return nil
+	}
+	return fatal(onStart.run(ctx, in, hookEnv(*u, pf.Service())))
+}
+
+// startupTimeoutError is returned when self wasn't found within timeout.
+func startupTimeoutError(timeout time.Duration, self string) error {
+	return &exitCodeError{exitStartupTimeout, fmt.Errorf("timed out after %v waiting to find %s among the peers", timeout, self)}
+}
+
+// awaitSelf polls the peers until this pod is among them and returns them,
+// or nil if ctx is cancelled first. An exitStartupTimeout error is returned
+// if that takes longer than timeout, if positive.
+func awaitSelf(ctx context.Context, pf *peerfinder.PeerFinder, timeout time.Duration) (*peerfinder.Update, error) {
+	lookupCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		lookupCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	pf.Start(lookupCtx)
+	defer pf.Stop()
+	u, ok := <-pf.Updates()
+	switch {
+	case ok:
+		return &u, nil
+	case ctx.Err() != nil:
+		return nil, nil
+	default:
+		return nil, startupTimeoutError(timeout, pf.Self())
+	}
+}
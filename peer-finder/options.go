@@ -0,0 +1,658 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/gossip"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/grpcprobe"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+// options are the flags shared by all commands.
+type options struct {
+	service     string
+	namespace   string
+	domain      string
+	backend     string
+	podSelector string
+	notReady    bool
+	topology    bool
+	peerLabels  stringList
+	peerAnnots  stringList
+	recordType  string
+	portName    string
+	portProto   string
+	order       string
+	nameserver  string
+	dnsTCP      bool
+	dnsTimeout  time.Duration
+	pollPeriod  time.Duration
+	delay       time.Duration
+	maxBackoff  time.Duration
+	stabilize   time.Duration
+	pollTTL     bool
+	adaptive    bool
+	minPoll     time.Duration
+	maxPoll     time.Duration
+	dnsMode     string
+	dnsCA       string
+	resolvConf  string
+	udpSize     uint
+	requireSelf bool
+	minPeers    int
+	replicas    bool
+	config      string
+	logFormat   string
+	verbosity   int
+	heartbeat   string
+	clusterset  string
+	clusterID   string
+	extDomains  stringList
+	peerSources stringList
+	extFailure  string
+	extStaleTTL time.Duration
+	handshake   int
+	gossipPort  int
+	failureMode string
+	quorum      bool
+	quorumWait  time.Duration
+	hsTimeout   time.Duration
+	probePort   int
+	probeWait   time.Duration
+	probeMode   string
+	probeType   string
+	grpcService string
+	probeLimit  int
+	probeEvery  time.Duration
+	// domainPriority is the priority of the domain of this pod.
+	domainPriority int
+	// remoteKubeconfigs are the -remote-kubeconfig entries.
+	remoteKubeconfigs stringList
+}
+
+func (o *options) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.service, "service", "", "Governing service responsible for the DNS records of the domain this pod is in.")
+	fs.StringVar(&o.namespace, "ns", "", "The namespace this pod is running in. If unspecified, the POD_NAMESPACE env var is used.")
+	fs.StringVar(&o.domain, "domain", "", "The Cluster Domain which is used by the Cluster, if not set tries to determine it from the -resolv-conf file.")
+	fs.StringVar(&o.clusterset, "clusterset-domain", "", "The Multi-Cluster Services clusterset domain, e.g. clusterset.local, or auto to use clusterset.local if the service is found there. If set, peers are looked up across the clusters of the clusterset, through the DNS records of <service>.<namespace>.svc.<domain> or the EndpointSlices imported for the ServiceImport of the service with -backend=endpointslice.")
+	fs.StringVar(&o.clusterID, "cluster-id", "", "The ID of the cluster of this pod within the clusterset of -clusterset-domain, this pod being expected as <hostname>.<cluster-id>.<service>.<namespace>.svc.<domain>. If unset, it is read from the id.k8s.io ClusterProperty, which requires permission to get clusterproperties.")
+	fs.Var(&o.extDomains, "extdomain", "Other domains peers are also looked up in through DNS, e.g. those of other clusters, comma separated or by repeating the flag. Each is a cluster domain, e.g. cluster2.local, the service being looked up as <service>.<namespace>.svc.<domain>, or the name of the service there, <service>.<namespace>.svc.<domain>, if its name or namespace differ.")
+	fs.IntVar(&o.domainPriority, "domain-priority", 0, "The priority of the domain of this pod with -order=domain, those of -extdomain and -remote-kubeconfig being given as <domain>:<priority>, or else their position, 1 for the first one.")
+	fs.Var(&o.peerSources, "peer-source", "Services peers are also looked up through, in other domains, as <service>[.<namespace>]@<domain>, comma separated or by repeating the flag, e.g. svc-a@cluster1.local,svc-b@cluster2.local when the name of the service differs per cluster. The service of this pod is skipped, the namespace defaulting to that of this pod.")
+	fs.DurationVar(&o.extStaleTTL, "extdomain-stale-ttl", 0, "How long -extdomain-failure=stale keeps the peers of a failing domain since it was last looked up successfully, forever if 0.")
+	fs.Var(&o.remoteKubeconfigs, "remote-kubeconfig", "Other clusters peers are also found in through their API, by repeating the flag, as <domain>=<kubeconfig>, the EndpointSlices of the service being watched with the kubeconfig, e.g. mounted from a secret. The domain is as with -extdomain, the peers being named after it.")
+	fs.StringVar(&o.extFailure, "extdomain-failure", "fail", "How lookups handle some of the domains failing with -extdomain or -remote-kubeconfig, one of: fail (the lookup fails, the peers being left unchanged), continue (the peers of the failing domains are left out), stale (the peers last found in the failing domains are kept). Lookups fail if all domains do.")
+	fs.IntVar(&o.gossipPort, "gossip-port", 0, "The port, TCP and UDP, peer-finders gossip their membership on with memberlist, seeded with the peers found by -backend. Peers that join or fail are then known within a second of each other, however stale DNS is. 0 disables the gossip.")
+	fs.StringVar(&o.failureMode, "failure-detection", "", "What to do with the peers of -backend whose peer-finder the others found dead through the gossip of -gossip-port, which then only detects failures, one of: remove (leave them out), flag (report them as unreachable in --output=json and templates). If empty, the peers reported are the members of the gossip.")
+	fs.IntVar(&o.handshake, "handshake-port", 0, "The port of the -health-address of the peer-finder of the peers, each peer being only reported once its peer-finder, asked on that port, connected back to this pod on the same port, e.g. to leave out the peers a network policy blocks. 0 reports peers without a handshake.")
+	fs.DurationVar(&o.hsTimeout, "handshake-timeout", peerfinder.DefaultHandshakeTimeout, "How long a handshake of -handshake-port may take before the peer is left out.")
+	fs.IntVar(&o.probePort, "probe-port", 0, "A port each peer is probed on, with -probe-type, before being reported, e.g. that of the application, since DNS lists the peers of a failed node for a while. Self is never probed. 0 reports peers without a probe.")
+	fs.DurationVar(&o.probeWait, "probe-timeout", peerfinder.DefaultProbeTimeout, "How long a probe of -probe-port may take before the peer is found unreachable.")
+	fs.StringVar(&o.probeType, "probe-type", "tcp", "How peers are probed on -probe-port, one of: tcp (a TCP connect), grpc (the serving status of the standard gRPC health service, over plaintext, reported in --output=json and templates).")
+	fs.StringVar(&o.grpcService, "probe-grpc-service", "", "The service whose serving status is checked with -probe-type=grpc, the server as a whole if empty.")
+	fs.IntVar(&o.probeLimit, "probe-concurrency", peerfinder.DefaultProbeConcurrency, "How many peers are probed at once with -probe-port, so that large services don't open a connection to every peer at the same time.")
+	fs.DurationVar(&o.probeEvery, "probe-interval", 0, "How long the result of the probe of a peer is reused for with -probe-port before probing it again, e.g. for the endpointslice backend not to probe every peer on each change. 0 probes the peers at each lookup.")
+	fs.StringVar(&o.probeMode, "probe-unreachable", "remove", "What to do with the peers failing the probe of -probe-port, one of: remove (leave them out), flag (report them as unreachable in --output=json and templates).")
+	fs.StringVar(&o.resolvConf, "resolv-conf", peerfinder.DefaultResolvConfPath, "The resolver configuration the domain, search list and nameservers are read from.")
+	fs.StringVar(&o.config, "config", "", "A YAML or JSON file of flag names to values, used for flags that are neither set on the command line nor through a PEER_FINDER_<FLAG> environment variable.")
+	fs.StringVar(&o.podSelector, "pod-selector", "", "A label selector, e.g. app=agent, peers are found among the ready pods matching in the namespace of this pod, through the Kubernetes API, instead of through a governing service, e.g. for DaemonSets and Deployments. Peers are then identified by their IP and this pod by the POD_IP env var, -service being optional.")
+	fs.BoolVar(&o.notReady, "include-not-ready", false, "Whether the endpointslice backend and -pod-selector also report the peers that are not ready, hooks being given the ready and not ready ones in PEERS_READY and PEERS_NOT_READY, and templates in .ReadyPeers and .NotReadyPeers.")
+	fs.BoolVar(&o.topology, "node-topology", false, "Whether the endpointslice backend and -pod-selector read the region of peers, and their zone if the EndpointSlice lacks it, from the topology labels of their nodes, which requires permission to list and watch nodes.")
+	fs.Var(&o.peerLabels, "peer-labels", "The labels of the pods of peers reported with them by the endpointslice backend and -pod-selector, in --output=json and templates, comma separated or by repeating the flag, e.g. role,version. With the endpointslice backend, this requires permission to get services and to list and watch pods.")
+	fs.Var(&o.peerAnnots, "peer-annotations", "The annotations of the pods of peers reported with them, as -peer-labels.")
+	fs.StringVar(&o.backend, "backend", "dns", "The discovery backend used to find peers, one of: dns, endpointslice, auto. The endpointslice backend falls back to dns if the API cannot be used. auto watches EndpointSlices whenever the API can be used, and polls DNS otherwise or with -record-type=a or aaaa, only logging the fallback as info.")
+	fs.StringVar(&o.portName, "port-name", "", "The name of the port of the service peers are reported with. If unset, peers are reported with their lowest port.")
+	fs.StringVar(&o.portProto, "port-protocol", "tcp", "The protocol of -port-name.")
+	fs.StringVar(&o.order, "order", "name", "The order peers are listed in, one of: name, priority, domain. With priority, peers are sorted by the priority then the weight of their SRV records, as preferred by clients. With domain, peers are sorted by the priority of the domain they were found in, see -domain-priority.")
+	fs.StringVar(&o.nameserver, "nameserver", "", "The address of the nameserver DNS lookups are sent to, as ip[:port]. If unset, the system resolver is used.")
+	fs.BoolVar(&o.dnsTCP, "dns-tcp", false, "Whether DNS lookups are sent over TCP rather than over UDP. Truncated responses over UDP are always retried over TCP.")
+	fs.DurationVar(&o.dnsTimeout, "dns-timeout", 5*time.Second, "The maximum duration of a lookup of the peers, after which it is abandoned until the next poll. 0 disables the timeout.")
+	fs.DurationVar(&o.pollPeriod, "poll-period", peerfinder.DefaultPollPeriod, "The interval between two lookups of the peers.")
+	fs.DurationVar(&o.delay, "initial-delay", 0, "How long to wait before the first lookup, leaving time for the records of this pod to be published.")
+	fs.DurationVar(&o.maxBackoff, "max-backoff", 30*time.Second, "The maximum interval between lookups after consecutive failures, the interval doubling from -poll-period after each one. 0 retries every -poll-period.")
+	fs.DurationVar(&o.stabilize, "stabilize", 0, "How long a change of the peers must have been stable for before it is reported, so that on-change hooks don't run for every intermediate state of a rolling update. 0 reports changes right away.")
+	fs.BoolVar(&o.pollTTL, "poll-ttl", false, "Whether the dns backend looks up peers again once their records expire rather than every -poll-period. Lookups are then sent to the first nameserver of -resolv-conf, unless -nameserver is set.")
+	fs.BoolVar(&o.adaptive, "adaptive-poll", false, "Whether the interval between lookups doubles each time the peers are found unchanged, from -min-poll-period up to -max-poll-period, going back to -min-poll-period as soon as they change.")
+	fs.DurationVar(&o.minPoll, "min-poll-period", 1*time.Second, "The minimum interval between lookups with -poll-ttl or -adaptive-poll.")
+	fs.DurationVar(&o.maxPoll, "max-poll-period", 30*time.Second, "The maximum interval between lookups with -poll-ttl or -adaptive-poll.")
+	fs.StringVar(&o.dnsMode, "dns-mode", "plain", "How DNS lookups are sent to -nameserver, one of: plain, dot (DNS over TLS, port 853 unless given), doh (DNS over HTTPS, -nameserver being the URL of the server, e.g. https://dns.example.com/dns-query).")
+	fs.StringVar(&o.dnsCA, "dns-ca", "", "A PEM file of the certificate authorities the server is verified with in the dot and doh modes, instead of the system ones.")
+	fs.UintVar(&o.udpSize, "dns-udp-size", 1232, "The size of UDP responses advertised through EDNS0 when sending lookups to -nameserver, or with -poll-ttl. 0 disables EDNS0.")
+	fs.BoolVar(&o.requireSelf, "require-self", true, "Whether peers are only reported once this pod is among them. With -require-self=false, hooks run regardless, e.g. for pods that are only published once ready; this pod is then only given by the self field of the json output and the .Self of templates.")
+	fs.IntVar(&o.minPeers, "min-peers", 0, "The minimum count of peers, this pod included, to be found before on-start runs, e.g. the size of a quorum that must not be bootstrapped with part of its members.")
+	fs.BoolVar(&o.quorum, "removal-quorum", false, "Whether a change removing peers is held back unless a majority of the peers before it are still found, so that a DNS outage is not taken for all of them leaving.")
+	fs.DurationVar(&o.quorumWait, "removal-quorum-timeout", 0, "How long a change held back by -removal-quorum must be found for before it is applied anyway, e.g. to scale down by more than half. 0 holds it back until a majority of the peers is found again.")
+	fs.BoolVar(&o.replicas, "wait-for-replicas", false, "Whether on-start only runs once as many peers as the spec.replicas of the StatefulSet owning this pod are found, instead of -min-peers. The replicas are read through the Kubernetes API, which requires permission to get pods and statefulsets.")
+	fs.StringVar(&o.heartbeat, "heartbeat-file", "", "A file touched after each successful lookup of the peers, for exec liveness probes to check that peers are still being looked up.")
+	fs.StringVar(&o.logFormat, "log-format", "text", "The format of logs, one of: text, json.")
+	fs.IntVar(&o.verbosity, "v", 0, "The verbosity of logs: 0 logs changes and errors, 1 also logs every lookup, along with the input of hooks.")
+	fs.StringVar(&o.recordType, "record-type", "srv", "The DNS records of the service peers are found with by the dns backend, one of: srv, a, aaaa. With a and aaaa, peers are identified by their addresses and this pod by the POD_IP env var, or the address of its hostname if unset.")
+}
+
+// parse parses the command line and the other sources of flag values, and
+// sets up logging.
+func (o *options) parse(fs *flag.FlagSet, args []string) error {
+	if err := parseFlags(fs, args, &o.config); err != nil {
+		return err
+	}
+	logger, err := newLogger(os.Stderr, o.logFormat, o.verbosity)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// podNamespace returns the namespace this pod is running in, from -ns or
+// else the POD_NAMESPACE env var.
+func (o *options) podNamespace() string {
+	if o.namespace != "" {
+		return o.namespace
+	}
+	return os.Getenv("POD_NAMESPACE")
+}
+
+// podName returns the name of this pod, its hostname.
+func podName() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get hostname: %s", err)
+	}
+	return hostname, nil
+}
+
+// peerFinder validates the options and builds a PeerFinder from them.
+func (o *options) peerFinder(ctx context.Context) (*peerfinder.PeerFinder, error) {
+	ns := o.podNamespace()
+	hostname, err := podName()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.clusterset == "auto" {
+		o.clusterset = o.detectClusterset(ctx, ns)
+	}
+	var domainName string
+	if o.clusterset != "" {
+		if ns != "" {
+			domainName = ns + ".svc." + strings.TrimSuffix(o.clusterset, ".")
+		}
+	} else {
+		if domainName, err = peerfinder.DomainFromResolvConf(ns, o.domain, o.resolvConf); err != nil {
+			return nil, err
+		}
+		if o.domain == "" {
+			slog.Info("Determined the domain", "domain", domainName)
+		}
+	}
+
+	if o.podSelector != "" && o.service == "" {
+		// Only names the peers for serve, no service is looked up.
+		o.service = podSelectorService
+	}
+	if o.service == "" || domainName == "" {
+		return nil, fmt.Errorf("incomplete args, require -service and -ns or an env var for POD_NAMESPACE")
+	}
+
+	var self string
+	switch o.recordType {
+	case "srv":
+	case "a", "aaaa":
+		if o.backend == "endpointslice" {
+			return nil, fmt.Errorf("-record-type=%s requires -backend=dns or auto", o.recordType)
+		}
+		if self, err = peerfinder.SelfAddress(ctx, hostname, addressNetworks[o.recordType]); err != nil {
+			return nil, fmt.Errorf("failed to determine the address of this pod: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown record type %q", o.recordType)
+	}
+	if o.podSelector != "" {
+		if self, err = peerfinder.SelfAddress(ctx, hostname, "ip"); err != nil {
+			return nil, fmt.Errorf("failed to determine the address of this pod: %v", err)
+		}
+	}
+	if o.clusterset != "" && self == "" {
+		clusterID, err := o.clusterIDOrProperty(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine the ID of the cluster, set -cluster-id: %v", err)
+		}
+		self = strings.Join([]string{hostname, clusterID, o.service, domainName}, ".")
+	}
+
+	order, ok := orders[o.order]
+	if !ok {
+		return nil, fmt.Errorf("unknown order %q", o.order)
+	}
+
+	minPeers := o.minPeers
+	if o.replicas {
+		if minPeers, err = statefulSetReplicas(ctx, ns, hostname); err != nil {
+			return nil, fmt.Errorf("failed to get the replicas of the StatefulSet: %v", err)
+		}
+		slog.Info("Waiting for the replicas of the StatefulSet", "replicas", minPeers)
+	}
+
+	discoverer, err := o.discoverer(ctx, ns, domainName)
+	if err != nil {
+		return nil, err
+	}
+	if discoverer, err = o.withExtDomains(ctx, discoverer, ns, domainName); err != nil {
+		return nil, err
+	}
+	if discoverer, err = o.withGossip(ctx, discoverer, self, hostname, domainName); err != nil {
+		return nil, err
+	}
+	probe, err := o.withProbes(discoverer)
+	if err != nil {
+		return nil, err
+	}
+	if probe != nil {
+		discoverer = probe
+	}
+	var handshake *peerfinder.HandshakeDiscoverer
+	if o.handshake > 0 {
+		handshake = &peerfinder.HandshakeDiscoverer{
+			Discoverer: discoverer,
+			Port:       o.handshake,
+			Timeout:    o.hsTimeout,
+			OnFailure: func(p peerfinder.Peer, err error) {
+				slog.Info("Leaving out peer failing the handshake", "peer", p.Name, "err", err)
+			},
+		}
+		discoverer = handshake
+	}
+	var onLookup func(error)
+	if o.heartbeat != "" {
+		onLookup = func(err error) {
+			if err == nil {
+				touch(o.heartbeat)
+			}
+		}
+	}
+	pf, err := peerfinder.New(peerfinder.Config{
+		Service:       o.service,
+		Domain:        domainName,
+		Hostname:      hostname,
+		Self:          self,
+		SelfOptional:  !o.requireSelf,
+		MinPeers:      minPeers,
+		Discoverer:    discoverer,
+		Order:         order,
+		PollPeriod:    o.pollPeriod,
+		InitialDelay:  o.delay,
+		LookupTimeout: o.dnsTimeout,
+		MaxBackoff:    o.maxBackoff,
+		Stabilize:     o.stabilize,
+		RemovalQuorum: o.quorum,
+		QuorumTimeout: o.quorumWait,
+		PollTTL:       o.pollTTL,
+		AdaptivePoll:  o.adaptive,
+		MinPollPeriod: o.minPoll,
+		MaxPollPeriod: o.maxPoll,
+		OnLookup:      onLookup,
+	})
+	if handshake != nil && err == nil {
+		// The peers connect back to the name they know this pod by.
+		handshake.Self = pf.Self()
+	}
+	if probe != nil && err == nil {
+		probe.Self = pf.Self()
+	}
+	return pf, err
+}
+
+// withProbes returns d probed according to -probe-port, nil if peers are not
+// probed.
+func (o *options) withProbes(d peerfinder.Discoverer) (*peerfinder.ProbeDiscoverer, error) {
+	if o.probeMode != "remove" && o.probeMode != "flag" {
+		return nil, fmt.Errorf("unknown -probe-unreachable %q", o.probeMode)
+	}
+	var prober peerfinder.Prober
+	switch o.probeType {
+	case "tcp":
+		prober = peerfinder.TCPProber{Port: o.probePort}
+	case "grpc":
+		prober = grpcprobe.Prober{Port: o.probePort, Service: o.grpcService}
+	default:
+		return nil, fmt.Errorf("unknown -probe-type %q", o.probeType)
+	}
+	if o.probePort <= 0 {
+		return nil, nil
+	}
+	if o.probeLimit < 1 {
+		return nil, errors.New("-probe-concurrency must be at least 1")
+	}
+	return &peerfinder.ProbeDiscoverer{
+		Discoverer:  d,
+		Prober:      prober,
+		Timeout:     o.probeWait,
+		Concurrency: o.probeLimit,
+		Interval:    o.probeEvery,
+		Flag:        o.probeMode == "flag",
+		OnFailure: func(p peerfinder.Peer, err error) {
+			slog.Info("Peer failed its probe", "peer", p.Name, "err", err)
+		},
+	}, nil
+}
+
+// withGossip returns d wrapped according to -gossip-port and
+// -failure-detection, self being the name of this pod if not the default.
+func (o *options) withGossip(ctx context.Context, d peerfinder.Discoverer, self, hostname, domainName string) (peerfinder.Discoverer, error) {
+	switch o.failureMode {
+	case "", "remove", "flag":
+	default:
+		return nil, fmt.Errorf("unknown -failure-detection %q", o.failureMode)
+	}
+	if o.gossipPort <= 0 {
+		if o.failureMode != "" {
+			return nil, errors.New("-failure-detection requires -gossip-port")
+		}
+		return d, nil
+	}
+	// The name the others find this pod under, as defaulted by New.
+	name := self
+	if name == "" {
+		name = strings.Join([]string{hostname, o.service, domainName}, ".")
+	}
+	if o.failureMode == "" {
+		g, err := gossip.New(ctx, name, "", o.gossipPort, d)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start gossiping: %v", err)
+		}
+		return g, nil
+	}
+	f, err := gossip.NewFailureDetector(ctx, name, "", o.gossipPort, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start gossiping: %v", err)
+	}
+	f.Flag = o.failureMode == "flag"
+	return f, nil
+}
+
+// touch creates the file at path or updates its modification time.
+func touch(path string) {
+	now := time.Now()
+	err := os.Chtimes(path, now, now)
+	if os.IsNotExist(err) {
+		err = os.WriteFile(path, nil, 0644)
+	}
+	if err != nil {
+		slog.Warn("Failed to touch heartbeat file", "path", path, "err", err)
+	}
+}
+
+// defaultClusterset is the clusterset domain of the MCS API.
+const defaultClusterset = "clusterset.local"
+
+// detectClusterset returns defaultClusterset if the service is found there,
+// e.g. because it is exported through Submariner Lighthouse, or else "".
+func (o *options) detectClusterset(ctx context.Context, ns string) string {
+	name := o.service + "." + ns + ".svc." + defaultClusterset + "."
+	var r peerfinder.Resolver = net.DefaultResolver
+	if resolver, err := o.resolver(); err == nil && resolver != nil {
+		r = resolver
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.dnsTimeout)
+	defer cancel()
+	if _, _, err := r.LookupSRV(ctx, "", "", name); err != nil {
+		slog.Info("Service not found in the clusterset, looking up peers in the cluster", "name", name, "err", err)
+		return ""
+	}
+	slog.Info("Found the service in the clusterset", "name", name)
+	return defaultClusterset
+}
+
+// clusterIDOrProperty returns -cluster-id, or else the id.k8s.io
+// ClusterProperty.
+func (o *options) clusterIDOrProperty(ctx context.Context) (string, error) {
+	if o.clusterID != "" {
+		return o.clusterID, nil
+	}
+	client, err := kube.InClusterDynamicClient()
+	if err != nil {
+		return "", err
+	}
+	return kube.ClusterID(ctx, client)
+}
+
+// orders maps the values of -order to peer orders.
+var orders = map[string]peerfinder.Order{
+	"name":     peerfinder.OrderName,
+	"priority": peerfinder.OrderPriority,
+	"domain":   peerfinder.OrderDomain,
+}
+
+// statefulSetReplicas returns the replicas of the StatefulSet of pod.
+func statefulSetReplicas(ctx context.Context, ns, pod string) (int, error) {
+	client, err := kube.InClusterClient()
+	if err != nil {
+		return 0, err
+	}
+	return kube.StatefulSetReplicas(ctx, client, ns, pod)
+}
+
+// addressNetworks maps address record types to their network.
+var addressNetworks = map[string]string{"a": "ip4", "aaaa": "ip6"}
+
+// podSelectorService is the service of the PeerFinder with -pod-selector if
+// -service is unset.
+const podSelectorService = "pods"
+
+// discoverer returns the discovery backend selected by -backend, or
+// -pod-selector.
+func (o *options) discoverer(ctx context.Context, ns, domainName string) (peerfinder.Discoverer, error) {
+	if o.podSelector != "" {
+		return o.podDiscoverer(ctx, ns)
+	}
+	name := o.service
+	if o.clusterset != "" {
+		// Fully qualified, not to be expanded with the search list.
+		name = o.service + "." + domainName + "."
+	}
+	backend := o.backend
+	if _, ok := addressNetworks[o.recordType]; ok && backend == "auto" {
+		backend = "dns"
+	}
+	switch backend {
+	case "dns":
+		return o.clustersetDiscoverer(name, domainName)
+	case "endpointslice", "auto":
+		client, err := kube.InClusterClient()
+		if err == nil && ns == "" {
+			err = errors.New("the namespace of this pod is unknown")
+		}
+		if err == nil {
+			var d *kube.EndpointSliceDiscoverer
+			newDiscoverer := kube.NewEndpointSliceDiscoverer
+			if o.clusterset != "" {
+				newDiscoverer = kube.NewServiceImportDiscoverer
+			}
+			if d, err = newDiscoverer(ctx, client, ns, o.service, domainName); err == nil {
+				o.configureEndpointSlices(ctx, d, client, o.clusterset == "")
+				return d, nil
+			}
+		}
+		if backend == "auto" {
+			slog.Info("Cannot watch EndpointSlices, polling DNS", "err", err)
+		} else {
+			slog.Warn("Cannot watch EndpointSlices, falling back to DNS", "err", err)
+		}
+		return o.clustersetDiscoverer(name, domainName)
+	default:
+		return nil, fmt.Errorf("unknown backend %q", o.backend)
+	}
+}
+
+// podDiscoverer returns the Discoverer watching the pods of -pod-selector.
+func (o *options) podDiscoverer(ctx context.Context, ns string) (peerfinder.Discoverer, error) {
+	selector, err := kube.ParseSelector(o.podSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -pod-selector: %v", err)
+	}
+	if ns == "" {
+		return nil, errors.New("-pod-selector requires -ns or the POD_NAMESPACE env var")
+	}
+	client, err := kube.InClusterClient()
+	if err != nil {
+		return nil, fmt.Errorf("-pod-selector requires the Kubernetes API: %v", err)
+	}
+	d, err := kube.NewPodDiscoverer(ctx, client, ns, selector)
+	if err != nil {
+		return nil, fmt.Errorf("cannot watch the pods of -pod-selector: %v", err)
+	}
+	d.PortName, d.IncludeNotReady = o.portName, o.notReady
+	d.Nodes = o.nodeTopology(ctx, client)
+	d.PodMetadata = o.podMetadata()
+	return d, nil
+}
+
+// podMetadata returns the PodMetadata of -peer-labels and -peer-annotations.
+func (o *options) podMetadata() kube.PodMetadata {
+	return kube.PodMetadata{Labels: o.peerLabels.split(), Annotations: o.peerAnnots.split()}
+}
+
+// configureEndpointSlices applies the flags of the Kubernetes backends to d,
+// whose cluster client is for. Pods are only watched for -peer-labels and
+// -peer-annotations if local, i.e. in that cluster.
+func (o *options) configureEndpointSlices(ctx context.Context, d *kube.EndpointSliceDiscoverer, client kubernetes.Interface, local bool) {
+	d.PortName, d.IncludeNotReady = o.portName, o.notReady
+	d.Nodes = o.nodeTopology(ctx, client)
+	d.PodMetadata = o.podMetadata()
+	if !local || len(d.PodMetadata.Labels)+len(d.PodMetadata.Annotations) == 0 {
+		return
+	}
+	if err := d.WatchPods(ctx, client); err != nil {
+		slog.Warn("Cannot watch pods, their labels and annotations are not reported", "err", err)
+	}
+}
+
+// nodeTopology returns the NodeTopology of the cluster of client with
+// -node-topology, nil otherwise or if the nodes cannot be watched.
+func (o *options) nodeTopology(ctx context.Context, client kubernetes.Interface) *kube.NodeTopology {
+	if !o.topology {
+		return nil
+	}
+	t, err := kube.NewNodeTopology(ctx, client)
+	if err != nil {
+		slog.Warn("Cannot watch nodes, the region of peers is unknown", "err", err)
+		return nil
+	}
+	return t
+}
+
+// clustersetDiscoverer returns the dnsDiscoverer for name, telling the
+// clusters of peers apart with -clusterset-domain.
+func (o *options) clustersetDiscoverer(name, domainName string) (peerfinder.Discoverer, error) {
+	d, err := o.dnsDiscoverer(name)
+	if err != nil || o.clusterset == "" {
+		return d, err
+	}
+	return &peerfinder.ClustersetDiscoverer{Discoverer: d, Service: o.service + "." + domainName}, nil
+}
+
+// dnsDiscoverer returns the Discoverer for -record-type, looking up name.
+func (o *options) dnsDiscoverer(name string) (peerfinder.Discoverer, error) {
+	resolver, err := o.resolver()
+	if err != nil {
+		return nil, err
+	}
+	resolver = instrument(resolver)
+	if network, ok := addressNetworks[o.recordType]; ok {
+		d := peerfinder.NewAddressDiscoverer(name, network)
+		d.Resolver = resolver
+		return d, nil
+	}
+	d := peerfinder.NewSRVDiscoverer(name)
+	d.PortName, d.Protocol = o.portName, o.portProto
+	d.Resolver = resolver
+	return d, nil
+}
+
+// dnsTransports maps the values of -dns-mode to DNSClient transports.
+var dnsTransports = map[string]string{"plain": "", "dot": "tls", "doh": "https"}
+
+// resolver returns the Resolver for -nameserver, -dns-tcp, -poll-ttl and
+// -dns-mode, nil for the system resolver.
+func (o *options) resolver() (peerfinder.Resolver, error) {
+	transport, ok := dnsTransports[o.dnsMode]
+	if !ok {
+		return nil, fmt.Errorf("unknown DNS mode %q", o.dnsMode)
+	}
+	if transport != "" && o.nameserver == "" {
+		return nil, fmt.Errorf("-dns-mode=%s requires -nameserver", o.dnsMode)
+	}
+	if o.nameserver == "" && !o.pollTTL {
+		if !o.dnsTCP {
+			return nil, nil
+		}
+		// The Go resolver frames queries for stream connections.
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "tcp", address)
+			},
+		}, nil
+	}
+	nameserver := o.nameserver
+	if _, _, err := net.SplitHostPort(nameserver); err != nil && nameserver != "" && transport != "https" {
+		port := "53"
+		if transport == "tls" {
+			port = "853"
+		}
+		nameserver = net.JoinHostPort(nameserver, port)
+	}
+	conf, err := peerfinder.ReadResolvConf(o.resolvConf)
+	if err != nil {
+		slog.Warn("Names will not be expanded with a search list", "err", err)
+	}
+	c := peerfinder.NewDNSClient(nameserver, conf)
+	c.TCP, c.Transport = o.dnsTCP, transport
+	if o.udpSize > math.MaxUint16 {
+		return nil, fmt.Errorf("-dns-udp-size must be at most %d", math.MaxUint16)
+	}
+	c.UDPSize = uint16(o.udpSize)
+	if o.dnsCA != "" {
+		pem, err := os.ReadFile(o.dnsCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", o.dnsCA)
+		}
+		c.TLSConfig = &tls.Config{RootCAs: pool}
+	}
+	return c, nil
+}
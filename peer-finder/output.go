@@ -0,0 +1,220 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// peerEvent is the JSON document describing a change of the peers.
+type peerEvent struct {
+	Peers     []string  `json:"peers"`
+	Members   []member  `json:"members"`
+	Added     []string  `json:"added"`
+	Removed   []string  `json:"removed"`
+	Self      string    `json:"self"`
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"`
+}
+
+// member describes a peer in a peerEvent.
+type member struct {
+	Name    string `json:"name"`
+	Port    int    `json:"port,omitempty"`
+	Cluster string `json:"cluster,omitempty"`
+	Domain  string `json:"domain,omitempty"`
+	// NotReady is only set with -include-not-ready.
+	NotReady bool   `json:"notReady,omitempty"`
+	Zone     string `json:"zone,omitempty"`
+	Region   string `json:"region,omitempty"`
+	// Unreachable is only set with -failure-detection=flag or
+	// -probe-unreachable=flag.
+	Unreachable bool `json:"unreachable,omitempty"`
+	// ProbeStatus is only set with -probe-type=grpc, e.g. SERVING.
+	ProbeStatus string `json:"probeStatus,omitempty"`
+	// Labels and Annotations are those of -peer-labels and -peer-annotations.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// members returns the members of the peers of u.
+func members(u peerfinder.Update) []member {
+	members := make([]member, 0, len(u.Peers))
+	for _, p := range u.Peers {
+		d := u.Details[p]
+		members = append(members, member{Name: p, Port: d.Port, Cluster: d.Cluster, Domain: d.Domain, NotReady: d.NotReady, Zone: d.Zone, Region: d.Region, Unreachable: d.Unreachable, ProbeStatus: d.ProbeStatus, Labels: d.Labels, Annotations: d.Annotations})
+	}
+	return members
+}
+
+// readiness splits the peers of u into the ready and not ready ones.
+func readiness(u peerfinder.Update) (ready, notReady []string) {
+	for _, p := range u.Peers {
+		if u.Details[p].NotReady {
+			notReady = append(notReady, p)
+		} else {
+			ready = append(ready, p)
+		}
+	}
+	return ready, notReady
+}
+
+// renderer renders an update for hooks and stdout.
+type renderer func(u peerfinder.Update) (string, error)
+
+// outputOptions are the flags controlling how peers are rendered.
+type outputOptions struct {
+	output   string
+	format   string
+	withPort bool
+
+	etcdScheme   string
+	etcdPeerPort int
+
+	zkQuorumPort   int
+	zkElectionPort int
+	zkIDOffset     int
+
+	seedCount int
+
+	mongoReplicaSet string
+	mongoPort       int
+
+	rabbitNodeName  string
+	rabbitNodeType  string
+	rabbitLongNames bool
+
+	esTransportPort int
+
+	kraftPort     int
+	kraftIDOffset int
+
+	ringVNodes int
+}
+
+func (o *outputOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "output", "text", "How peers are handed to scripts and printed, one of: text, a new line separated list of peers, or json, a document with the peers, those added and removed, self, a timestamp and the source they were found with.")
+	fs.BoolVar(&o.withPort, "with-port", false, "Whether the text output lists peers as host:port rather than host, if their port is known.")
+	fs.StringVar(&o.format, "format", "", "Renders the text output for an application instead of as a list of peers, one of: etcd, zookeeper, cassandra-seeds, mongodb, rabbitmq, elasticsearch, kraft, ring.")
+	fs.StringVar(&o.etcdScheme, "etcd-scheme", "http", "The scheme of the peer URLs of -format=etcd.")
+	fs.IntVar(&o.etcdPeerPort, "etcd-peer-port", 2380, "The port of the peer URLs of -format=etcd.")
+	fs.IntVar(&o.zkQuorumPort, "zookeeper-quorum-port", 2888, "The quorum port of -format=zookeeper.")
+	fs.IntVar(&o.zkElectionPort, "zookeeper-election-port", 3888, "The leader election port of -format=zookeeper.")
+	fs.IntVar(&o.zkIDOffset, "zookeeper-id-offset", 1, "Added to the ordinal of a peer to get its server id with -format=zookeeper. Server ids must be between 1 and 255.")
+	fs.IntVar(&o.seedCount, "seed-count", 2, "The number of seeds of -format=cassandra-seeds.")
+	fs.StringVar(&o.mongoReplicaSet, "mongodb-replica-set", "rs0", "The name of the replica set of -format=mongodb.")
+	fs.IntVar(&o.mongoPort, "mongodb-port", 27017, "The port of the members of -format=mongodb.")
+	fs.StringVar(&o.rabbitNodeName, "rabbitmq-node-name", "rabbit", "The name of the nodes of -format=rabbitmq, the part before the @.")
+	fs.StringVar(&o.rabbitNodeType, "rabbitmq-node-type", "disc", "The type of the nodes of -format=rabbitmq, disc or ram.")
+	fs.BoolVar(&o.rabbitLongNames, "rabbitmq-longnames", true, "Whether the nodes of -format=rabbitmq use fully qualified names, as with RABBITMQ_USE_LONGNAME=true, or hostnames.")
+	fs.IntVar(&o.esTransportPort, "elasticsearch-transport-port", 9300, "The transport port of the seed hosts of -format=elasticsearch.")
+	fs.IntVar(&o.kraftPort, "kraft-controller-port", 9093, "The controller port of the voters of -format=kraft.")
+	fs.IntVar(&o.kraftIDOffset, "kraft-id-offset", 0, "Added to the ordinal of a peer to get its node id with -format=kraft.")
+	fs.IntVar(&o.ringVNodes, "ring-vnodes", 128, "The count of tokens, or virtual nodes, of each peer on the consistent hash ring of -format=ring.")
+}
+
+// list returns whether the peers are rendered as a new line separated list,
+// one per line.
+func (o *outputOptions) list() bool {
+	return o.output == "text" && o.format == ""
+}
+
+// renderer returns the renderer selected by the flags.
+func (o *outputOptions) renderer() (renderer, error) {
+	switch o.output {
+	case "text":
+	case "json":
+		if o.format != "" {
+			return nil, fmt.Errorf("-format requires -output=text")
+		}
+		return renderJSON, nil
+	default:
+		return nil, fmt.Errorf("unknown output %q, must be text or json", o.output)
+	}
+	switch o.format {
+	case "":
+		if o.withPort {
+			return renderHostPorts, nil
+		}
+		return renderText, nil
+	case "etcd":
+		return o.renderEtcd, nil
+	case "zookeeper":
+		return o.renderZooKeeper, nil
+	case "cassandra-seeds":
+		if o.seedCount < 1 {
+			return nil, fmt.Errorf("-seed-count must be at least 1")
+		}
+		return o.renderCassandraSeeds, nil
+	case "mongodb":
+		return o.renderMongoDB, nil
+	case "rabbitmq":
+		if o.rabbitNodeType != "disc" && o.rabbitNodeType != "ram" {
+			return nil, fmt.Errorf("unknown -rabbitmq-node-type %q, must be disc or ram", o.rabbitNodeType)
+		}
+		return o.renderRabbitMQ, nil
+	case "elasticsearch":
+		return o.renderElasticsearch, nil
+	case "kraft":
+		return o.renderKRaft, nil
+	case "ring":
+		if o.ringVNodes < 1 {
+			return nil, fmt.Errorf("-ring-vnodes must be at least 1")
+		}
+		return o.renderRing, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", o.format)
+	}
+}
+
+func renderText(u peerfinder.Update) (string, error) {
+	return strings.Join(u.Peers, "\n"), nil
+}
+
+// renderHostPorts renders the peers as a new line separated list of
+// host:port.
+func renderHostPorts(u peerfinder.Update) (string, error) {
+	lines := make([]string, 0, len(u.Peers))
+	for _, p := range u.Peers {
+		if port := u.Details[p].Port; port != 0 {
+			p = net.JoinHostPort(p, strconv.Itoa(port))
+		}
+		lines = append(lines, p)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func renderJSON(u peerfinder.Update) (string, error) {
+	b, err := json.Marshal(peerEvent{
+		Peers:     u.Peers,
+		Members:   members(u),
+		Added:     u.Added,
+		Removed:   u.Removed,
+		Self:      u.Self,
+		Timestamp: u.Time,
+		Source:    u.Source,
+	})
+	return string(b), err
+}
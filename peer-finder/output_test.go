@@ -0,0 +1,151 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+var testUpdate = peerfinder.Update{
+	Peers:   []string{"web-0.nginx.default.svc.cluster.local", "web-1.nginx.default.svc.cluster.local"},
+	Added:   []string{"web-1.nginx.default.svc.cluster.local"},
+	Removed: []string{},
+	Details: map[string]peerfinder.Peer{
+		"web-0.nginx.default.svc.cluster.local": {Name: "web-0.nginx.default.svc.cluster.local", Port: 80},
+		"web-1.nginx.default.svc.cluster.local": {Name: "web-1.nginx.default.svc.cluster.local", Port: 80},
+	},
+	Self:   "web-0.nginx.default.svc.cluster.local",
+	Time:   time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+	Source: "dns:nginx",
+}
+
+func TestRenderer(t *testing.T) {
+	cases := []struct {
+		output   string
+		format   string
+		expected string
+	}{
+		{"text", "", "web-0.nginx.default.svc.cluster.local\nweb-1.nginx.default.svc.cluster.local"},
+		{"json", "", `{"peers":["web-0.nginx.default.svc.cluster.local","web-1.nginx.default.svc.cluster.local"],` +
+			`"members":[{"name":"web-0.nginx.default.svc.cluster.local","port":80},{"name":"web-1.nginx.default.svc.cluster.local","port":80}],` +
+			`"added":["web-1.nginx.default.svc.cluster.local"],"removed":[],` +
+			`"self":"web-0.nginx.default.svc.cluster.local","timestamp":"2017-01-02T03:04:05Z","source":"dns:nginx"}`},
+		{"text", "zookeeper", "server.1=web-0.nginx.default.svc.cluster.local:2888:3888\nserver.2=web-1.nginx.default.svc.cluster.local:2888:3888"},
+		{"text", "cassandra-seeds", "web-0.nginx.default.svc.cluster.local,web-1.nginx.default.svc.cluster.local"},
+		{"text", "mongodb", `{"_id":"rs0","members":[` +
+			`{"_id":0,"host":"web-0.nginx.default.svc.cluster.local:27017","priority":2},` +
+			`{"_id":1,"host":"web-1.nginx.default.svc.cluster.local:27017","priority":1}]}`},
+		{"text", "rabbitmq", "{['rabbit@web-0.nginx.default.svc.cluster.local', 'rabbit@web-1.nginx.default.svc.cluster.local'], disc}"},
+		{"text", "elasticsearch", "discovery.seed_hosts:\n" +
+			"  - web-0.nginx.default.svc.cluster.local:9300\n" +
+			"  - web-1.nginx.default.svc.cluster.local:9300\n" +
+			"cluster.initial_master_nodes:\n" +
+			"  - web-0\n" +
+			"  - web-1"},
+		{"text", "kraft", "0@web-0.nginx.default.svc.cluster.local:9093,1@web-1.nginx.default.svc.cluster.local:9093"},
+		{"text", "etcd", "web-0=http://web-0.nginx.default.svc.cluster.local:2380,web-1=http://web-1.nginx.default.svc.cluster.local:2380"},
+	}
+	for _, c := range cases {
+		var o outputOptions
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		o.addFlags(fs)
+		o.output, o.format = c.output, c.format
+		render, err := o.renderer()
+		if err != nil {
+			t.Errorf("%s/%s: unexpected error: %v", c.output, c.format, err)
+			continue
+		}
+		got, err := render(testUpdate)
+		if err != nil {
+			t.Errorf("%s/%s: unexpected error: %v", c.output, c.format, err)
+		} else if got != c.expected {
+			t.Errorf("%s/%s: expected\n%s\ngot\n%s", c.output, c.format, c.expected, got)
+		}
+	}
+}
+
+func TestRenderHostPorts(t *testing.T) {
+	u := testUpdate
+	u.Details = map[string]peerfinder.Peer{
+		"web-0.nginx.default.svc.cluster.local": {Name: "web-0.nginx.default.svc.cluster.local", Port: 80},
+	}
+	expected := "web-0.nginx.default.svc.cluster.local:80\nweb-1.nginx.default.svc.cluster.local"
+	got, err := renderHostPorts(u)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestMembers(t *testing.T) {
+	u := peerfinder.Update{
+		Peers: []string{"web-0.east.nginx.default.svc.clusterset.local", "web-0.west.nginx.default.svc.clusterset.local"},
+		Details: map[string]peerfinder.Peer{
+			"web-0.east.nginx.default.svc.clusterset.local": {Port: 80, Cluster: "east", Zone: "us-east-1a", Region: "us-east-1"},
+			"web-0.west.nginx.default.svc.clusterset.local": {Domain: "default.svc.clusterset.local"},
+		},
+	}
+	expected := []member{{Name: "web-0.east.nginx.default.svc.clusterset.local", Port: 80, Cluster: "east", Zone: "us-east-1a", Region: "us-east-1"}, {Name: "web-0.west.nginx.default.svc.clusterset.local", Domain: "default.svc.clusterset.local"}}
+	if m := members(u); !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+}
+
+func TestRenderRing(t *testing.T) {
+	o := outputOptions{ringVNodes: 4}
+	got, err := o.renderRing(testUpdate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ring hashRing
+	if err := json.Unmarshal([]byte(got), &ring); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ring.Hash != ringHash || ring.VNodes != 4 || len(ring.Ring) != 8 {
+		t.Fatalf("unexpected ring %s", got)
+	}
+	if !sort.SliceIsSorted(ring.Ring, func(i, j int) bool { return ring.Ring[i].Token < ring.Ring[j].Token }) {
+		t.Errorf("expected the tokens to be sorted, got %s", got)
+	}
+	expected := map[ringToken]bool{}
+	for _, p := range testUpdate.Peers {
+		for _, n := range []string{"0", "1", "2", "3"} {
+			expected[ringToken{ringTokenOf(p + "#" + n), p}] = true
+		}
+	}
+	for _, tk := range ring.Ring {
+		if !expected[tk] {
+			t.Errorf("unexpected token %v, expected the hashes of <peer>#<n>", tk)
+		}
+	}
+
+	// The ring does not depend on the order of the peers.
+	reversed := testUpdate
+	reversed.Peers = []string{testUpdate.Peers[1], testUpdate.Peers[0]}
+	if again, _ := o.renderRing(reversed); again != got {
+		t.Errorf("expected the same ring whatever the order of the peers, got\n%s\nand\n%s", got, again)
+	}
+}
@@ -18,137 +18,122 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net"
+	"log/slog"
 	"os"
-	"os/exec"
-	"regexp"
-	"sort"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
-
-	"k8s.io/apimachinery/pkg/util/sets"
 )
 
+// Exit codes of peer-finder.
 const (
-	pollPeriod = 1 * time.Second
+	// exitOK is returned when the command completed, or was stopped by SIGTERM or SIGINT.
+	exitOK = 0
+	// exitError is returned when the command failed.
+	exitError = 1
+	// exitUsage is returned when the command line is invalid.
+	exitUsage = 2
+	// exitStartupTimeout is returned when this pod wasn't found among the
+	// peers in time.
+	exitStartupTimeout = 3
 )
 
-var (
-	onChange  = flag.String("on-change", "", "Script to run on change, must accept a new line separated list of peers via stdin.")
-	onStart   = flag.String("on-start", "", "Script to run on start, must accept a new line separated list of peers via stdin.")
-	svc       = flag.String("service", "", "Governing service responsible for the DNS records of the domain this pod is in.")
-	namespace = flag.String("ns", "", "The namespace this pod is running in. If unspecified, the POD_NAMESPACE env var is used.")
-	domain    = flag.String("domain", "", "The Cluster Domain which is used by the Cluster, if not set tries to determine it from /etc/resolv.conf file.")
-)
+// exitCodeError is returned by commands that want the process to exit with
+// a specific code.
+type exitCodeError struct {
+	code int
+	err  error
+}
 
-func lookup(svcName string) (sets.String, error) {
-	endpoints := sets.NewString()
-	_, srvRecords, err := net.LookupSRV("", "", svcName)
-	if err != nil {
-		return endpoints, err
-	}
-	for _, srvRecord := range srvRecords {
-		// The SRV records ends in a "." for the root domain
-		ep := fmt.Sprintf("%v", srvRecord.Target[:len(srvRecord.Target)-1])
-		endpoints.Insert(ep)
-	}
-	return endpoints, nil
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
 }
 
-func shellOut(sendStdin, script string) {
-	log.Printf("execing: %v with stdin: %v", script, sendStdin)
-	// TODO: Switch to sending stdin from go
-	out, err := exec.Command("bash", "-c", fmt.Sprintf("echo -e '%v' | %v", sendStdin, script)).CombinedOutput()
-	if err != nil {
-		log.Fatalf("Failed to execute %v: %v, err: %v", script, string(out), err)
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+// command is a peer-finder subcommand.
+type command struct {
+	name  string
+	short string
+	run   func(ctx context.Context, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"watch", "Watch the peers and run hooks when they change (default).", runWatch},
+	{"once", "Wait for this pod to be among the peers, print or hand them to -on-start, then exit.", runOnce},
+	{"serve", "Watch the peers and expose them over HTTP.", runServe},
+	{"verify", "Check that peers, including this pod, can be discovered.", runVerify},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.short)
 	}
-	log.Print(string(out))
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
 }
 
 func main() {
-	flag.Parse()
-
-	ns := *namespace
-	if ns == "" {
-		ns = os.Getenv("POD_NAMESPACE")
+	// Without a command, flags are for watch, which was the only mode of
+	// operation before subcommands were introduced.
+	name, args := "watch", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Fatalf("Failed to get hostname: %s", err)
+	if name == "help" {
+		usage()
+		return
 	}
-	var domainName string
-
-	// If domain is not provided, try to get it from resolv.conf
-	if *domain == "" {
-		resolvConfBytes, err := ioutil.ReadFile("/etc/resolv.conf")
-		resolvConf := string(resolvConfBytes)
-		if err != nil {
-			log.Fatal("Unable to read /etc/resolv.conf")
-		}
-
-		var re *regexp.Regexp
-		if ns == "" {
-			// Looking for a domain that looks like with *.svc.**
-			re, err = regexp.Compile(`\A(.*\n)*search\s{1,}(.*\s{1,})*(?P<goal>[a-zA-Z0-9-]{1,63}.svc.([a-zA-Z0-9-]{1,63}\.)*[a-zA-Z0-9]{2,63})`)
-		} else {
-			// Looking for a domain that looks like svc.**
-			re, err = regexp.Compile(`\A(.*\n)*search\s{1,}(.*\s{1,})*(?P<goal>svc.([a-zA-Z0-9-]{1,63}\.)*[a-zA-Z0-9]{2,63})`)
-		}
-		if err != nil {
-			log.Fatalf("Failed to create regular expression: %v", err)
-		}
-
-		groupNames := re.SubexpNames()
-		result := re.FindStringSubmatch(resolvConf)
-		for k, v := range result {
-			if groupNames[k] == "goal" {
-				if ns == "" {
-					// Domain is complete if ns is empty
-					domainName = v
-				} else {
-					// Need to convert svc.** into ns.svc.**
-					domainName = ns + "." + v
-				}
-				break
-			}
+	for _, c := range commands {
+		if c.name != name {
+			continue
 		}
-		log.Printf("Determined Domain to be %s", domainName)
-
-	} else {
-		domainName = strings.Join([]string{ns, "svc", *domain}, ".")
-	}
-
-	if *svc == "" || domainName == "" || (*onChange == "" && *onStart == "") {
-		log.Fatalf("Incomplete args, require -on-change and/or -on-start, -service and -ns or an env var for POD_NAMESPACE.")
+		os.Exit(run(c, args))
 	}
+	usage()
+	os.Exit(exitUsage)
+}
 
-	myName := strings.Join([]string{hostname, *svc, domainName}, ".")
-	script := *onStart
-	if script == "" {
-		script = *onChange
-		log.Printf("No on-start supplied, on-change %v will be applied on start.", script)
+// run runs c and returns the exit code of the process. The context passed
+// to c is cancelled on SIGTERM or SIGINT, a second signal kills the process.
+func run(c command, args []string) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-sigs
+		slog.Info("Shutting down", "signal", sig.String())
+		signal.Reset(syscall.SIGTERM, os.Interrupt)
+		cancel()
+	}()
+
+	shutdown, err := setupTracing(ctx)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "err", err)
+		return exitError
 	}
-	for newPeers, peers := sets.NewString(), sets.NewString(); script != ""; time.Sleep(pollPeriod) {
-		newPeers, err = lookup(*svc)
-		if err != nil {
-			log.Printf("%v", err)
-			continue
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			slog.Warn("Failed to export spans", "err", err)
 		}
-		if newPeers.Equal(peers) || !newPeers.Has(myName) {
-			log.Printf("Have not found myself in list yet.\nMy Hostname: %s\nHosts in list: %s", myName, strings.Join(newPeers.List(), ", "))
-			continue
+	}()
+
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	if err := c.run(ctx, fs, args); err != nil {
+		slog.Error("Exiting", "err", err)
+		if e, ok := err.(*exitCodeError); ok {
+			return e.code
 		}
-		peerList := newPeers.List()
-		sort.Strings(peerList)
-		log.Printf("Peer list updated\nwas %v\nnow %v", peers.List(), newPeers.List())
-		shellOut(strings.Join(peerList, "\n"), script)
-		peers = newPeers
-		script = *onChange
+		return exitError
 	}
-	// TODO: Exit if there's no on-change?
-	log.Printf("Peer finder exiting")
+	return exitOK
 }
@@ -0,0 +1,176 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: pkg/api/peerfinder.proto
+
+package api
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	PeerFinder_ListPeers_FullMethodName  = "/peerfinder.v1.PeerFinder/ListPeers"
+	PeerFinder_WatchPeers_FullMethodName = "/peerfinder.v1.PeerFinder/WatchPeers"
+)
+
+// PeerFinderClient is the client API for PeerFinder service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PeerFinderClient interface {
+	ListPeers(ctx context.Context, in *ListPeersRequest, opts ...grpc.CallOption) (*Peers, error)
+	WatchPeers(ctx context.Context, in *WatchPeersRequest, opts ...grpc.CallOption) (PeerFinder_WatchPeersClient, error)
+}
+
+type peerFinderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPeerFinderClient(cc grpc.ClientConnInterface) PeerFinderClient {
+	return &peerFinderClient{cc}
+}
+
+func (c *peerFinderClient) ListPeers(ctx context.Context, in *ListPeersRequest, opts ...grpc.CallOption) (*Peers, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Peers)
+	err := c.cc.Invoke(ctx, PeerFinder_ListPeers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerFinderClient) WatchPeers(ctx context.Context, in *WatchPeersRequest, opts ...grpc.CallOption) (PeerFinder_WatchPeersClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PeerFinder_ServiceDesc.Streams[0], PeerFinder_WatchPeers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &peerFinderWatchPeersClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PeerFinder_WatchPeersClient interface {
+	Recv() (*PeersUpdate, error)
+	grpc.ClientStream
+}
+
+type peerFinderWatchPeersClient struct {
+	grpc.ClientStream
+}
+
+func (x *peerFinderWatchPeersClient) Recv() (*PeersUpdate, error) {
+	m := new(PeersUpdate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PeerFinderServer is the server API for PeerFinder service.
+// All implementations must embed UnimplementedPeerFinderServer
+// for forward compatibility
+type PeerFinderServer interface {
+	ListPeers(context.Context, *ListPeersRequest) (*Peers, error)
+	WatchPeers(*WatchPeersRequest, PeerFinder_WatchPeersServer) error
+	mustEmbedUnimplementedPeerFinderServer()
+}
+
+// UnimplementedPeerFinderServer must be embedded to have forward compatible implementations.
+type UnimplementedPeerFinderServer struct {
+}
+
+func (UnimplementedPeerFinderServer) ListPeers(context.Context, *ListPeersRequest) (*Peers, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPeers not implemented")
+}
+func (UnimplementedPeerFinderServer) WatchPeers(*WatchPeersRequest, PeerFinder_WatchPeersServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchPeers not implemented")
+}
+func (UnimplementedPeerFinderServer) mustEmbedUnimplementedPeerFinderServer() {}
+
+// UnsafePeerFinderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PeerFinderServer will
+// result in compilation errors.
+type UnsafePeerFinderServer interface {
+	mustEmbedUnimplementedPeerFinderServer()
+}
+
+func RegisterPeerFinderServer(s grpc.ServiceRegistrar, srv PeerFinderServer) {
+	s.RegisterService(&PeerFinder_ServiceDesc, srv)
+}
+
+func _PeerFinder_ListPeers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPeersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerFinderServer).ListPeers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PeerFinder_ListPeers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerFinderServer).ListPeers(ctx, req.(*ListPeersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerFinder_WatchPeers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchPeersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PeerFinderServer).WatchPeers(m, &peerFinderWatchPeersServer{ServerStream: stream})
+}
+
+type PeerFinder_WatchPeersServer interface {
+	Send(*PeersUpdate) error
+	grpc.ServerStream
+}
+
+type peerFinderWatchPeersServer struct {
+	grpc.ServerStream
+}
+
+func (x *peerFinderWatchPeersServer) Send(m *PeersUpdate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// PeerFinder_ServiceDesc is the grpc.ServiceDesc for PeerFinder service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PeerFinder_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "peerfinder.v1.PeerFinder",
+	HandlerType: (*PeerFinderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListPeers",
+			Handler:    _PeerFinder_ListPeers_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchPeers",
+			Handler:       _PeerFinder_WatchPeers_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pkg/api/peerfinder.proto",
+}
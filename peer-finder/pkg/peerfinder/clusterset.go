@@ -0,0 +1,79 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ClustersetDiscoverer sets the Cluster of the peers a Discoverer finds
+// across an MCS clusterset, e.g. through the DNS of Submariner Lighthouse,
+// which names them <hostname>.<cluster>.<Service>.
+type ClustersetDiscoverer struct {
+	Discoverer
+	// Service is the clusterset name of the service, without trailing dot,
+	// e.g. "nginx.default.svc.clusterset.local".
+	Service string
+}
+
+func (d *ClustersetDiscoverer) String() string {
+	return Source(d.Discoverer)
+}
+
+// Lookup implements Discoverer.
+func (d *ClustersetDiscoverer) Lookup(ctx context.Context) ([]Peer, error) {
+	peers, err := d.Discoverer.Lookup(ctx)
+	for i, p := range peers {
+		if p.Cluster == "" {
+			peers[i].Cluster = ClusterOf(p.Name, d.Service)
+		}
+	}
+	return peers, err
+}
+
+// TTL implements TTLer if the Discoverer does.
+func (d *ClustersetDiscoverer) TTL() time.Duration {
+	if t, ok := d.Discoverer.(TTLer); ok {
+		return t.TTL()
+	}
+	return 0
+}
+
+// Notify implements Notifier if the Discoverer does, the channel is nil
+// otherwise.
+func (d *ClustersetDiscoverer) Notify() <-chan struct{} {
+	if n, ok := d.Discoverer.(Notifier); ok {
+		return n.Notify()
+	}
+	return nil
+}
+
+// ClusterOf returns the cluster of the peer named name in the clusterset
+// service, i.e. <cluster> for <hostname>.<cluster>.<service>, or "".
+func ClusterOf(name, service string) string {
+	prefix, ok := strings.CutSuffix(name, "."+service)
+	if !ok {
+		return ""
+	}
+	labels := strings.Split(prefix, ".")
+	if len(labels) != 2 || labels[0] == "" {
+		return ""
+	}
+	return labels[1]
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestClusterOf(t *testing.T) {
+	service := "nginx.default.svc.clusterset.local"
+	cases := map[string]string{
+		"web-0.east.nginx.default.svc.clusterset.local": "east",
+		"web-0.nginx.default.svc.clusterset.local":      "",
+		"a.b.east.nginx.default.svc.clusterset.local":   "",
+		"web-0.east.nginx.default.svc.cluster.local":    "",
+		"10.0.0.1": "",
+	}
+	for name, expected := range cases {
+		if cluster := ClusterOf(name, service); cluster != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, cluster)
+		}
+	}
+}
+
+func TestClustersetDiscoverer(t *testing.T) {
+	d := &ClustersetDiscoverer{
+		Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) {
+			return []Peer{{Name: "web-0.east.nginx.default.svc.clusterset.local"}, {Name: "web-0.nginx.default.svc.clusterset.local", Cluster: "west"}}, nil
+		}),
+		Service: "nginx.default.svc.clusterset.local",
+	}
+	peers, err := d.Lookup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if clusters := []string{peers[0].Cluster, peers[1].Cluster}; !reflect.DeepEqual(clusters, []string{"east", "west"}) {
+		t.Errorf("expected the clusters east and west, got %v", clusters)
+	}
+	if d.Notify() != nil || d.TTL() != 0 {
+		t.Errorf("expected no notifications nor TTL")
+	}
+}
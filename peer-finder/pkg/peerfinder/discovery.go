@@ -0,0 +1,110 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Peer is a peer found by a Discoverer.
+type Peer struct {
+	// Name is the fully qualified name of the peer or, when found through A
+	// or AAAA records, its address.
+	Name string
+	// Port is the port of the peer, 0 if unknown.
+	Port int
+	// Priority and Weight are those of the SRV record of the peer. Lower
+	// priorities are preferred and, among equal priorities, higher weights.
+	Priority int
+	Weight   int
+	// Cluster is the ID of the cluster of the peer, when found across the
+	// clusters of an MCS clusterset.
+	Cluster string
+	// Domain is the domain the peer was found in, e.g.
+	// "default.svc.cluster2.local", when looked up across several.
+	Domain string
+	// DomainPriority is the priority of Domain, lower ones being listed
+	// first with OrderDomain.
+	DomainPriority int
+	// NotReady is set for the peers whose endpoint or pod is not ready, only
+	// reported by the Kubernetes backends when asked to.
+	NotReady bool
+	// Zone and Region are the topology of the node of the peer, "" if
+	// unknown, only reported by the Kubernetes backends.
+	Zone   string
+	Region string
+	// Unreachable is set for the peers a failure detector found dead, or
+	// failing their probe, when asked to report them rather than leave them
+	// out.
+	Unreachable bool
+	// ProbeStatus is the status reported by the probe of the peer, e.g. the
+	// serving status of the gRPC health service, "" if none.
+	ProbeStatus string
+	// Labels and Annotations are those of the pod of the peer the
+	// Kubernetes backends were asked to report, nil if none.
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// Discoverer is a source of peers.
+type Discoverer interface {
+	// Lookup returns the peers currently known to the source. A peer may be
+	// returned more than once, e.g. once per port, the first one wins.
+	Lookup(ctx context.Context) ([]Peer, error)
+}
+
+// Source describes d, using its String method if it has one, e.g. for the
+// Discoverers wrapping another to be described like it.
+func Source(d Discoverer) string {
+	if s, ok := d.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", d)
+}
+
+// DiscovererFunc adapts a function to the Discoverer interface.
+type DiscovererFunc func(ctx context.Context) ([]Peer, error)
+
+// Lookup calls f(ctx).
+func (f DiscovererFunc) Lookup(ctx context.Context) ([]Peer, error) {
+	return f(ctx)
+}
+
+// Notifier is implemented by Discoverers that know when their peers change,
+// such as those backed by a watch. The poll loop looks up peers as soon as a
+// notification is received instead of waiting for the next poll period.
+type Notifier interface {
+	Notify() <-chan struct{}
+}
+
+// TTLer is implemented by Discoverers, and Resolvers, that know for how long
+// the result of their last lookup is valid, such as those reading the TTL of
+// DNS records.
+type TTLer interface {
+	// TTL returns the time to live of the last lookup, 0 if unknown.
+	TTL() time.Duration
+}
+
+// resolverTTL returns the TTL of the last lookup of r, if known.
+func resolverTTL(r Resolver) time.Duration {
+	if t, ok := r.(TTLer); ok {
+		return t.TTL()
+	}
+	return 0
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SRVDiscoverer finds peers through the SRV records of a service.
+type SRVDiscoverer struct {
+	// Name is the name looked up, usually the bare service name which is
+	// expanded through the resolv.conf search path.
+	Name string
+	// PortName optionally restricts the lookup to the records of a named
+	// port of the service, i.e. to _<PortName>._<Protocol>.<Name>.
+	PortName string
+	// Protocol is the protocol of PortName, "tcp" if empty.
+	Protocol string
+	// Resolver is used for lookups, net.DefaultResolver if nil.
+	Resolver Resolver
+}
+
+// NewSRVDiscoverer returns a Discoverer looking up the SRV records of name.
+func NewSRVDiscoverer(name string) *SRVDiscoverer {
+	return &SRVDiscoverer{Name: name}
+}
+
+func (d *SRVDiscoverer) String() string {
+	return "dns:" + d.Name
+}
+
+// TTL implements TTLer if the Resolver does.
+func (d *SRVDiscoverer) TTL() time.Duration {
+	return resolverTTL(d.Resolver)
+}
+
+// Lookup implements Discoverer. Peers with several ports are reported with
+// their lowest one.
+func (d *SRVDiscoverer) Lookup(ctx context.Context) (_ []Peer, err error) {
+	ctx, span := tracer().Start(ctx, "LookupSRV", trace.WithAttributes(attribute.String("dns.name", d.Name)))
+	defer func() { endSpan(span, err) }()
+	var resolver Resolver = net.DefaultResolver
+	if d.Resolver != nil {
+		resolver = d.Resolver
+	}
+	var service, proto string
+	if d.PortName != "" {
+		service, proto = d.PortName, d.Protocol
+		if proto == "" {
+			proto = "tcp"
+		}
+	}
+	_, srvRecords, err := resolver.LookupSRV(ctx, service, proto, d.Name)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(srvRecords, func(i, j int) bool {
+		return srvRecords[i].Port < srvRecords[j].Port
+	})
+	span.SetAttributes(attribute.Int("dns.records", len(srvRecords)))
+	peers := make([]Peer, 0, len(srvRecords))
+	for _, srvRecord := range srvRecords {
+		// The SRV records ends in a "." for the root domain
+		peers = append(peers, Peer{
+			Name:     strings.TrimSuffix(srvRecord.Target, "."),
+			Port:     int(srvRecord.Port),
+			Priority: int(srvRecord.Priority),
+			Weight:   int(srvRecord.Weight),
+		})
+	}
+	return peers, nil
+}
+
+// AddressDiscoverer finds peers through the A or AAAA records of a headless
+// service. Peers are identified by their addresses.
+type AddressDiscoverer struct {
+	// Name is the name looked up, usually the bare service name which is
+	// expanded through the resolv.conf search path.
+	Name string
+	// Network is "ip4" to look up A records or "ip6" for AAAA records.
+	Network string
+	// Resolver is used for lookups, net.DefaultResolver if nil.
+	Resolver Resolver
+}
+
+// NewAddressDiscoverer returns a Discoverer looking up the A records of name
+// if network is "ip4", or its AAAA records if it is "ip6".
+func NewAddressDiscoverer(name, network string) *AddressDiscoverer {
+	return &AddressDiscoverer{Name: name, Network: network}
+}
+
+func (d *AddressDiscoverer) String() string {
+	if d.Network == "ip6" {
+		return "dns-aaaa:" + d.Name
+	}
+	return "dns-a:" + d.Name
+}
+
+// TTL implements TTLer if the Resolver does.
+func (d *AddressDiscoverer) TTL() time.Duration {
+	return resolverTTL(d.Resolver)
+}
+
+// Lookup implements Discoverer.
+func (d *AddressDiscoverer) Lookup(ctx context.Context) (_ []Peer, err error) {
+	ctx, span := tracer().Start(ctx, "LookupIP", trace.WithAttributes(attribute.String("dns.name", d.Name), attribute.String("dns.network", d.Network)))
+	defer func() { endSpan(span, err) }()
+	var resolver Resolver = net.DefaultResolver
+	if d.Resolver != nil {
+		resolver = d.Resolver
+	}
+	ips, err := resolver.LookupIP(ctx, d.Network, d.Name)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("dns.records", len(ips)))
+	peers := make([]Peer, 0, len(ips))
+	for _, ip := range ips {
+		peers = append(peers, Peer{Name: ip.String()})
+	}
+	return peers, nil
+}
+
+// SelfAddress returns the address this pod is published under in the A or
+// AAAA records of its service, that is the value of the POD_IP environment
+// variable if set, or else the address its hostname resolves to.
+func SelfAddress(ctx context.Context, hostname, network string) (string, error) {
+	if ip := os.Getenv("POD_IP"); ip != "" {
+		return ip, nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, hostname)
+	if err != nil {
+		return "", err
+	}
+	return ips[0].String(), nil
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Resolver looks up the DNS records peers are found through. It is
+// implemented by *net.Resolver and DNSClient.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// DNSClient is a Resolver querying a nameserver directly instead of going
+// through the system resolver.
+type DNSClient struct {
+	// Nameserver is the address of the server queried, as host:port, or its
+	// URL with DNS over HTTPS.
+	Nameserver string
+	// Transport is how queries are sent: "" for plain DNS, "tls" for DNS over
+	// TLS (RFC 7858) or "https" for DNS over HTTPS (RFC 8484).
+	Transport string
+	// TLSConfig is used with the tls and https transports.
+	TLSConfig *tls.Config
+	// Search is the list of domains names that are not fully qualified are
+	// looked up in.
+	Search []string
+	// Ndots is the number of dots a name needs to be looked up as is before
+	// being looked up in the search domains.
+	Ndots int
+	// TCP sends queries over TCP. Otherwise they are sent over UDP and
+	// retried over TCP if the response is truncated.
+	TCP bool
+	// UDPSize, if not 0, is the size of UDP responses advertised with EDNS0
+	// (RFC 6891), so that large responses don't need to be retried over TCP.
+	UDPSize uint16
+
+	mu   sync.Mutex
+	ttl  time.Duration
+	http *http.Client
+}
+
+// NewDNSClient returns a DNSClient querying nameserver with the search list
+// of conf, if not nil. If nameserver is empty, the first nameserver of conf
+// is queried.
+func NewDNSClient(nameserver string, conf *ResolvConf) *DNSClient {
+	c := &DNSClient{Nameserver: nameserver, Ndots: 1}
+	if conf != nil {
+		c.Search, c.Ndots = conf.Search, conf.Ndots
+		if nameserver == "" && len(conf.Nameservers) > 0 {
+			c.Nameserver = net.JoinHostPort(conf.Nameservers[0], "53")
+		}
+	}
+	if c.Nameserver == "" {
+		c.Nameserver = "127.0.0.1:53"
+	}
+	return c
+}
+
+// TTL implements TTLer, returning the lowest TTL of the records of the last
+// successful lookup.
+func (c *DNSClient) TTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl
+}
+
+func (c *DNSClient) setTTL(rrs []dns.RR) {
+	var ttl uint32
+	for i, rr := range rrs {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	c.mu.Lock()
+	c.ttl = time.Duration(ttl) * time.Second
+	c.mu.Unlock()
+}
+
+// names returns the fully qualified names name is looked up as, in order.
+func (c *DNSClient) names(name string) []string {
+	if dns.IsFqdn(name) {
+		return []string{name}
+	}
+	var names []string
+	for _, s := range c.Search {
+		names = append(names, dns.Fqdn(name+"."+s))
+	}
+	if strings.Count(name, ".") >= c.Ndots {
+		return append([]string{dns.Fqdn(name)}, names...)
+	}
+	return append(names, dns.Fqdn(name))
+}
+
+// lookup returns the records of type qtype of the first name name is
+// qualified to which has some.
+func (c *DNSClient) lookup(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	for _, n := range c.names(name) {
+		m := new(dns.Msg)
+		m.SetQuestion(n, qtype)
+		if c.UDPSize > 0 {
+			m.SetEdns0(c.UDPSize, false)
+		}
+		r, err := c.exchange(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		switch r.Rcode {
+		case dns.RcodeSuccess, dns.RcodeNameError:
+		default:
+			return nil, fmt.Errorf("lookup %s on %s: %s", n, c.Nameserver, dns.RcodeToString[r.Rcode])
+		}
+		var rrs []dns.RR
+		for _, rr := range r.Answer {
+			if rr.Header().Rrtype == qtype {
+				rrs = append(rrs, rr)
+			}
+		}
+		if len(rrs) > 0 {
+			return rrs, nil
+		}
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, Server: c.Nameserver, IsNotFound: true}
+}
+
+// exchange sends m to the nameserver, retrying over TCP if the response over
+// UDP is truncated, which happens with the SRV records of large services.
+func (c *DNSClient) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	switch c.Transport {
+	case "https":
+		return c.exchangeHTTPS(ctx, m)
+	case "tls":
+		r, _, err := (&dns.Client{Net: "tcp-tls", TLSConfig: c.TLSConfig}).ExchangeContext(ctx, m, c.Nameserver)
+		return r, err
+	}
+	if !c.TCP {
+		r, _, err := (&dns.Client{UDPSize: c.UDPSize}).ExchangeContext(ctx, m, c.Nameserver)
+		if err != nil || !r.Truncated {
+			return r, err
+		}
+	}
+	r, _, err := (&dns.Client{Net: "tcp"}).ExchangeContext(ctx, m, c.Nameserver)
+	return r, err
+}
+
+// exchangeHTTPS POSTs m to the nameserver URL.
+func (c *DNSClient) exchangeHTTPS(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	// The ID should be 0 for responses to be cacheable.
+	m.Id = 0
+	b, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Nameserver, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+
+	c.mu.Lock()
+	if c.http == nil {
+		c.http = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: c.TLSConfig}}
+	}
+	client := c.http
+	c.mu.Unlock()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lookup on %s: %s", c.Nameserver, resp.Status)
+	}
+	b, err = io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	r := new(dns.Msg)
+	if err := r.Unpack(b); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// dohMediaType is the media type of DNS messages sent over HTTPS.
+const dohMediaType = "application/dns-message"
+
+// LookupSRV implements Resolver. Unlike net.LookupSRV, records are returned
+// in the order they were received in.
+func (c *DNSClient) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if service != "" || proto != "" {
+		name = "_" + service + "._" + proto + "." + name
+	}
+	rrs, err := c.lookup(ctx, name, dns.TypeSRV)
+	if err != nil {
+		return "", nil, err
+	}
+	c.setTTL(rrs)
+	srvs := make([]*net.SRV, 0, len(rrs))
+	for _, rr := range rrs {
+		srv := rr.(*dns.SRV)
+		srvs = append(srvs, &net.SRV{Target: srv.Target, Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+	}
+	return rrs[0].Header().Name, srvs, nil
+}
+
+// LookupIP implements Resolver. network is "ip4" to look up A records, "ip6"
+// for AAAA records or "ip" for both.
+func (c *DNSClient) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	var qtypes []uint16
+	switch network {
+	case "ip4":
+		qtypes = []uint16{dns.TypeA}
+	case "ip6":
+		qtypes = []uint16{dns.TypeAAAA}
+	case "ip":
+		qtypes = []uint16{dns.TypeA, dns.TypeAAAA}
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	var ips []net.IP
+	var all []dns.RR
+	var err error
+	for _, qtype := range qtypes {
+		var rrs []dns.RR
+		if rrs, err = c.lookup(ctx, host, qtype); err != nil {
+			continue
+		}
+		all = append(all, rrs...)
+		for _, rr := range rrs {
+			switch rr := rr.(type) {
+			case *dns.A:
+				ips = append(ips, rr.A)
+			case *dns.AAAA:
+				ips = append(ips, rr.AAAA)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, err
+	}
+	c.setTTL(all)
+	return ips, nil
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// serveDNS serves the given records over UDP and TCP and returns the address
+// of the server and the count of queries received over TCP. Responses over
+// UDP are truncated to the size advertised by the client, 512 bytes without
+// EDNS0.
+func serveDNS(t *testing.T, records ...string) (string, *atomic.Int32) {
+	zone := map[string][]dns.RR{}
+	for _, r := range records {
+		rr, err := dns.NewRR(r)
+		if err != nil {
+			t.Fatalf("invalid record %q: %v", r, err)
+		}
+		zone[rr.Header().Name] = append(zone[rr.Header().Name], rr)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	tcpQueries := new(atomic.Int32)
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		q := req.Question[0]
+		for _, rr := range zone[q.Name] {
+			if rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		if _, ok := zone[q.Name]; !ok {
+			m.Rcode = dns.RcodeNameError
+		}
+		if _, ok := w.LocalAddr().(*net.UDPAddr); ok {
+			size := dns.MinMsgSize
+			if opt := req.IsEdns0(); opt != nil {
+				size = int(opt.UDPSize())
+			}
+			m.Truncate(size)
+		} else {
+			tcpQueries.Add(1)
+		}
+		w.WriteMsg(m)
+	})
+	for _, server := range []*dns.Server{{Listener: l, Handler: handler}, {PacketConn: pc, Handler: handler}} {
+		go server.ActivateAndServe()
+		t.Cleanup(func() { server.Shutdown() })
+	}
+	return l.Addr().String(), tcpQueries
+}
+
+func TestDNSClient(t *testing.T) {
+	addr, _ := serveDNS(t,
+		"nginx.default.svc.cluster.local. 30 IN SRV 0 50 80 web-0.nginx.default.svc.cluster.local.",
+		"nginx.default.svc.cluster.local. 30 IN SRV 0 50 80 web-1.nginx.default.svc.cluster.local.",
+		"nginx.default.svc.cluster.local. 30 IN A 10.0.0.1",
+	)
+	c := &DNSClient{Nameserver: addr, Search: []string{"default.svc.cluster.local", "svc.cluster.local"}, Ndots: 5}
+
+	peers, err := (&SRVDiscoverer{Name: "nginx", Resolver: c}).Lookup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Peer{
+		{Name: "web-0.nginx.default.svc.cluster.local", Port: 80, Weight: 50},
+		{Name: "web-1.nginx.default.svc.cluster.local", Port: 80, Weight: 50},
+	}
+	if !reflect.DeepEqual(peers, expected) {
+		t.Errorf("expected %v, got %v", expected, peers)
+	}
+
+	peers, err = (&AddressDiscoverer{Name: "nginx", Network: "ip4", Resolver: c}).Lookup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []Peer{{Name: "10.0.0.1"}}; !reflect.DeepEqual(peers, expected) {
+		t.Errorf("expected %v, got %v", expected, peers)
+	}
+
+	_, err = (&SRVDiscoverer{Name: "missing", Resolver: c}).Lookup(context.Background())
+	if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestDNSClientTruncated(t *testing.T) {
+	var records []string
+	var expected []Peer
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("web-%d.nginx.default.svc.cluster.local", i)
+		records = append(records, "nginx.default.svc.cluster.local. 30 IN SRV 0 50 80 "+name+".")
+		expected = append(expected, Peer{Name: name, Port: 80, Weight: 50})
+	}
+	addr, tcpQueries := serveDNS(t, records...)
+	cases := []struct {
+		tcp        bool
+		udpSize    uint16
+		tcpQueries int32
+	}{
+		{false, 0, 1},
+		{true, 0, 1},
+		{false, 4096, 0},
+	}
+	for _, c := range cases {
+		tcpQueries.Store(0)
+		client := &DNSClient{Nameserver: addr, TCP: c.tcp, UDPSize: c.udpSize}
+		peers, err := (&SRVDiscoverer{Name: "nginx.default.svc.cluster.local.", Resolver: client}).Lookup(context.Background())
+		if err != nil {
+			t.Fatalf("%+v: unexpected error: %v", c, err)
+		}
+		if !reflect.DeepEqual(peers, expected) {
+			t.Errorf("%+v: expected %d peers, got %d", c, len(expected), len(peers))
+		}
+		if n := tcpQueries.Load(); n != c.tcpQueries {
+			t.Errorf("%+v: expected %d queries over TCP, got %d", c, c.tcpQueries, n)
+		}
+	}
+}
+
+func TestDNSClientTTL(t *testing.T) {
+	addr, _ := serveDNS(t,
+		"nginx.default.svc.cluster.local. 30 IN SRV 0 50 80 web-0.nginx.default.svc.cluster.local.",
+		"nginx.default.svc.cluster.local. 5 IN SRV 0 50 80 web-1.nginx.default.svc.cluster.local.",
+	)
+	d := &SRVDiscoverer{Name: "nginx.default.svc.cluster.local.", Resolver: &DNSClient{Nameserver: addr}}
+	if _, err := d.Lookup(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ttl := d.TTL(); ttl != 5*time.Second {
+		t.Errorf("expected a TTL of 5s, got %v", ttl)
+	}
+}
+
+func TestDNSClientHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != dohMediaType {
+			http.Error(w, "unexpected content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetReply(req)
+		rr, _ := dns.NewRR("nginx.default.svc.cluster.local. 30 IN SRV 0 50 80 web-0.nginx.default.svc.cluster.local.")
+		m.Answer = append(m.Answer, rr)
+		b, _ = m.Pack()
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(b)
+	}))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	c := &DNSClient{Nameserver: server.URL, Transport: "https", TLSConfig: &tls.Config{RootCAs: pool}}
+	peers, err := (&SRVDiscoverer{Name: "nginx.default.svc.cluster.local.", Resolver: c}).Lookup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []Peer{{Name: "web-0.nginx.default.svc.cluster.local", Port: 80, Weight: 50}}; !reflect.DeepEqual(peers, expected) {
+		t.Errorf("expected %v, got %v", expected, peers)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"strings"
+)
+
+// Domain returns the domain of a pod in namespace ns. If clusterDomain is
+// empty it is determined from the search list of DefaultResolvConfPath.
+func Domain(ns, clusterDomain string) (string, error) {
+	return DomainFromResolvConf(ns, clusterDomain, DefaultResolvConfPath)
+}
+
+// DomainFromResolvConf is like Domain, determining the domain from the
+// resolver configuration at resolvConf.
+func DomainFromResolvConf(ns, clusterDomain, resolvConf string) (string, error) {
+	if clusterDomain != "" {
+		return strings.Join([]string{ns, "svc", clusterDomain}, "."), nil
+	}
+	conf, err := ReadResolvConf(resolvConf)
+	if err != nil {
+		return "", err
+	}
+	return conf.Domain(ns), nil
+}
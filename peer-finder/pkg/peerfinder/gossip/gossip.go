@@ -0,0 +1,303 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gossip implements a peer discovery backend where peer-finders
+// gossip their membership among themselves, with hashicorp/memberlist, and a
+// failure detector on top of other backends.
+package gossip
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// leaveTimeout bounds the time spent telling the others this pod leaves.
+const leaveTimeout = 5 * time.Second
+
+// joinRetry is how long a seed that could not be joined, or was found down,
+// is left alone before being joined again. It is shortened by the tests.
+var joinRetry = 30 * time.Second
+
+// member is this pod in the gossip of the peer-finders.
+type member struct {
+	list   *memberlist.Memberlist
+	seeds  peerfinder.Discoverer
+	port   int
+	notify chan struct{}
+	// pending holds the seeds waiting to be joined.
+	pending chan []peerfinder.Peer
+
+	mu sync.Mutex
+	// down holds when the members found dead or that left were, until they
+	// join again.
+	down map[string]time.Time
+}
+
+// start starts gossiping as the member named name, the name the others find
+// this pod under, on bindAddr, all addresses if empty, and port for both TCP
+// and UDP. The member leaves once ctx is cancelled.
+func start(ctx context.Context, name, bindAddr string, port int, seeds peerfinder.Discoverer) (*member, error) {
+	m := &member{seeds: seeds, port: port, notify: make(chan struct{}, 1), pending: make(chan []peerfinder.Peer, 1), down: map[string]time.Time{}}
+	config := memberlist.DefaultLANConfig()
+	config.Name = name
+	config.BindPort, config.AdvertisePort = port, port
+	if bindAddr != "" {
+		config.BindAddr = bindAddr
+	}
+	config.Events = m
+	config.Logger = slog.NewLogLogger(slog.Default().Handler(), slog.LevelDebug)
+	list, err := memberlist.Create(config)
+	if err != nil {
+		return nil, err
+	}
+	m.list = list
+	if n, ok := seeds.(peerfinder.Notifier); ok {
+		// New seeds are joined right away.
+		go m.forward(ctx, n.Notify())
+	}
+	go m.joinSeeds(ctx)
+	go func() {
+		<-ctx.Done()
+		if err := list.Leave(leaveTimeout); err != nil {
+			slog.Warn("Failed to leave the gossip", "err", err)
+		}
+		list.Shutdown()
+	}()
+	return m, nil
+}
+
+// join has the seeds joined in the background, so that lookups don't wait on
+// the seeds that don't gossip, e.g. because their peer-finder did not start
+// yet. Members joining notify.
+func (m *member) join(seeds []peerfinder.Peer) {
+	// Replace the seeds waiting to be joined, if any.
+	select {
+	case <-m.pending:
+	default:
+	}
+	m.pending <- seeds
+}
+
+// joinSeeds joins the pending seeds that are not members yet on the gossip
+// port, one at a time, until ctx is cancelled. A seed that could not be
+// joined or was found down is left alone for joinRetry, then joined again,
+// so that both sides of a partition outlasting the gossip of the dead merge
+// again once it heals.
+func (m *member) joinSeeds(ctx context.Context) {
+	failed := map[string]time.Time{}
+	for {
+		var seeds []peerfinder.Peer
+		select {
+		case seeds = <-m.pending:
+		case <-ctx.Done():
+			return
+		}
+		joined := map[string]bool{}
+		for _, n := range m.list.Members() {
+			joined[n.Name] = true
+		}
+		for _, p := range seeds {
+			if ctx.Err() != nil {
+				return
+			}
+			last := failed[p.Name]
+			if down := m.downAt(p.Name); down.After(last) {
+				last = down
+			}
+			if joined[p.Name] || time.Since(last) < joinRetry {
+				continue
+			}
+			joined[p.Name] = true
+			if _, err := m.list.Join([]string{net.JoinHostPort(p.Name, strconv.Itoa(m.port))}); err != nil {
+				slog.Debug("Failed to join a seed", "seed", p.Name, "err", err)
+				failed[p.Name] = time.Now()
+				continue
+			}
+			delete(failed, p.Name)
+		}
+	}
+}
+
+// forward notifies for each notification of ch until ctx is cancelled.
+func (m *member) forward(ctx context.Context, ch <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+			m.changed()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// isDown returns whether the member named name was found dead or left.
+func (m *member) isDown(name string) bool {
+	return !m.downAt(name).IsZero()
+}
+
+// downAt returns when the member named name was found dead or left, zero if
+// it was not.
+func (m *member) downAt(name string) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.down[name]
+}
+
+// Notify implements peerfinder.Notifier, members joining or leaving, and the
+// seeds changing, notifying right away.
+func (m *member) Notify() <-chan struct{} {
+	return m.notify
+}
+
+// TTL implements peerfinder.TTLer if the seeds do, for them to be looked up
+// again once their records expire.
+func (m *member) TTL() time.Duration {
+	if t, ok := m.seeds.(peerfinder.TTLer); ok {
+		return t.TTL()
+	}
+	return 0
+}
+
+func (m *member) changed() {
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+// NotifyJoin implements memberlist.EventDelegate.
+func (m *member) NotifyJoin(n *memberlist.Node) {
+	m.mu.Lock()
+	delete(m.down, n.Name)
+	m.mu.Unlock()
+	m.changed()
+}
+
+// NotifyLeave implements memberlist.EventDelegate.
+func (m *member) NotifyLeave(n *memberlist.Node) {
+	m.mu.Lock()
+	m.down[n.Name] = time.Now()
+	m.mu.Unlock()
+	m.changed()
+}
+
+// NotifyUpdate implements memberlist.EventDelegate.
+func (m *member) NotifyUpdate(*memberlist.Node) {}
+
+// Discoverer finds peers through the membership gossiped by their
+// peer-finders. The peers found by the seeds, e.g. through DNS, are joined on
+// the gossip port, after which members joining and failing are known within a
+// second of each other, however stale DNS is.
+type Discoverer struct {
+	*member
+}
+
+// New starts gossiping as the member named name on bindAddr and port, see
+// start. The peers of seeds are joined on the same port after each lookup.
+func New(ctx context.Context, name, bindAddr string, port int, seeds peerfinder.Discoverer) (*Discoverer, error) {
+	m, err := start(ctx, name, bindAddr, port, seeds)
+	if err != nil {
+		return nil, err
+	}
+	return &Discoverer{m}, nil
+}
+
+func (d *Discoverer) String() string {
+	return "gossip on port " + strconv.Itoa(d.port)
+}
+
+// Lookup implements peerfinder.Discoverer, having the seeds that are not
+// members yet joined and returning the members, with the details the seeds know of
+// them. Failing to look up the seeds only fails the lookup if no other member
+// is known.
+func (d *Discoverer) Lookup(ctx context.Context) ([]peerfinder.Peer, error) {
+	seeds, err := d.seeds.Lookup(ctx)
+	if err != nil && d.list.NumMembers() <= 1 {
+		return nil, err
+	}
+	d.join(seeds)
+	byName := make(map[string]peerfinder.Peer, len(seeds))
+	for _, p := range seeds {
+		if _, ok := byName[p.Name]; !ok {
+			byName[p.Name] = p
+		}
+	}
+	members := d.list.Members()
+	peers := make([]peerfinder.Peer, 0, len(members))
+	for _, n := range members {
+		p, ok := byName[n.Name]
+		if !ok {
+			p = peerfinder.Peer{Name: n.Name}
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// FailureDetector reports the peers of a Discoverer, the seeds, like it does,
+// except for those their peer-finders found dead through the gossip, e.g.
+// because their node failed while DNS still lists them. Peers that don't
+// gossip, e.g. because their peer-finder did not start yet, are reported.
+type FailureDetector struct {
+	*member
+	// Flag reports the dead peers as Unreachable instead of leaving them out.
+	Flag bool
+}
+
+// NewFailureDetector starts gossiping as the member named name on bindAddr
+// and port, see start.
+func NewFailureDetector(ctx context.Context, name, bindAddr string, port int, seeds peerfinder.Discoverer) (*FailureDetector, error) {
+	m, err := start(ctx, name, bindAddr, port, seeds)
+	if err != nil {
+		return nil, err
+	}
+	return &FailureDetector{member: m}, nil
+}
+
+func (d *FailureDetector) String() string {
+	return peerfinder.Source(d.seeds)
+}
+
+// Lookup implements peerfinder.Discoverer.
+func (d *FailureDetector) Lookup(ctx context.Context) ([]peerfinder.Peer, error) {
+	seeds, err := d.seeds.Lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.join(seeds)
+	peers := make([]peerfinder.Peer, 0, len(seeds))
+	for _, p := range seeds {
+		if d.isDown(p.Name) {
+			if !d.Flag {
+				continue
+			}
+			p.Unreachable = true
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
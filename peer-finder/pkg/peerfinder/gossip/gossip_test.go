@@ -0,0 +1,257 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gossip
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// freePort returns a port likely free on 127.0.0.1 and 127.0.0.2.
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func seeds(names ...string) peerfinder.Discoverer {
+	return peerfinder.DiscovererFunc(func(context.Context) ([]peerfinder.Peer, error) {
+		var peers []peerfinder.Peer
+		for _, n := range names {
+			peers = append(peers, peerfinder.Peer{Name: n, Port: 80})
+		}
+		return peers, nil
+	})
+}
+
+// waitMembers waits for m to count n members.
+func waitMembers(ctx context.Context, t *testing.T, m *member, n int) {
+	for m.list.NumMembers() < n {
+		select {
+		case <-m.Notify():
+		case <-ctx.Done():
+			t.Fatalf("expected %d members, got %d", n, m.list.NumMembers())
+		}
+	}
+}
+
+func TestDiscoverer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	port := freePort(t)
+	a, err := New(ctx, "127.0.0.1", "127.0.0.1", port, seeds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b only knows a from its seeds.
+	b, err := New(ctx, "127.0.0.2", "127.0.0.2", port, seeds("127.0.0.1"))
+	if err != nil {
+		t.Skipf("cannot bind 127.0.0.2: %v", err)
+	}
+	// Seeds are joined in the background.
+	if _, err := b.Lookup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitMembers(ctx, t, b.member, 2)
+	peers, err := b.Lookup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range peers {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	if expected := []string{"127.0.0.1", "127.0.0.2"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	// a learns about b through the gossip, not its seeds.
+	select {
+	case <-a.Notify():
+	case <-ctx.Done():
+		t.Fatal("expected a to be notified of b joining")
+	}
+	if peers, err = a.Lookup(ctx); err != nil || len(peers) != 2 {
+		t.Errorf("expected 2 peers, got %v, %v", peers, err)
+	}
+}
+
+func TestFailureDetector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	port := freePort(t)
+	both := seeds("127.0.0.1", "127.0.0.2")
+	a, err := NewFailureDetector(ctx, "127.0.0.1", "127.0.0.1", port, both)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bctx, stop := context.WithCancel(ctx)
+	b, err := NewFailureDetector(bctx, "127.0.0.2", "127.0.0.2", port, both)
+	if err != nil {
+		t.Skipf("cannot bind 127.0.0.2: %v", err)
+	}
+	if _, err := b.Lookup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitMembers(ctx, t, a.member, 2)
+	waitMembers(ctx, t, b.member, 2)
+	// b leaves, while still among the seeds.
+	stop()
+	for !a.isDown("127.0.0.2") {
+		select {
+		case <-a.Notify():
+		case <-ctx.Done():
+			t.Fatal("expected b to be found down")
+		}
+	}
+	cases := []struct {
+		flag     bool
+		expected []peerfinder.Peer
+	}{
+		{false, []peerfinder.Peer{{Name: "127.0.0.1", Port: 80}}},
+		{true, []peerfinder.Peer{{Name: "127.0.0.1", Port: 80}, {Name: "127.0.0.2", Port: 80, Unreachable: true}}},
+	}
+	for _, c := range cases {
+		a.Flag = c.flag
+		peers, err := a.Lookup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(peers, c.expected) {
+			t.Errorf("flag=%v: expected %v, got %v", c.flag, c.expected, peers)
+		}
+	}
+}
+
+func TestRejoin(t *testing.T) {
+	retry := joinRetry
+	joinRetry = 100 * time.Millisecond
+	defer func() { joinRetry = retry }()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	port := freePort(t)
+	a, err := New(ctx, "127.0.0.1", "127.0.0.1", port, seeds("127.0.0.2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bctx, stop := context.WithCancel(ctx)
+	b, err := New(bctx, "127.0.0.2", "127.0.0.2", port, seeds())
+	if err != nil {
+		t.Skipf("cannot bind 127.0.0.2: %v", err)
+	}
+	a.Lookup(ctx)
+	waitMembers(ctx, t, b.member, 2)
+	stop()
+	for !a.isDown("127.0.0.2") {
+		select {
+		case <-a.Notify():
+		case <-ctx.Done():
+			t.Fatal("expected b to be found down")
+		}
+	}
+	// b comes back without seeds, a joins it again although it found it
+	// down.
+	for {
+		if b, err = New(ctx, "127.0.0.2", "127.0.0.2", port, seeds()); err == nil {
+			break
+		}
+		// The port is freed once b left.
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatalf("cannot restart b: %v", err)
+		}
+	}
+	for b.list.NumMembers() < 2 {
+		a.Lookup(ctx)
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("expected the gossip to merge again")
+		}
+	}
+}
+
+func TestLookupDoesNotJoin(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 192.0.2.1 is a documentation address, whose connections usually hang.
+	d, err := New(ctx, "127.0.0.1", "127.0.0.1", freePort(t), seeds("192.0.2.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	peers, err := d.Lookup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the lookup not to wait on joining the seeds, took %v", elapsed)
+	}
+	if len(peers) != 1 {
+		t.Errorf("expected only this member, got %v", peers)
+	}
+}
+
+// ttlSeeds are seeds with a TTL and notifications.
+type ttlSeeds struct {
+	peerfinder.Discoverer
+	notify chan struct{}
+}
+
+func (s ttlSeeds) String() string          { return "seeds" }
+func (s ttlSeeds) TTL() time.Duration      { return time.Minute }
+func (s ttlSeeds) Notify() <-chan struct{} { return s.notify }
+
+func TestForwarding(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ds, fs := ttlSeeds{seeds(), make(chan struct{}, 1)}, ttlSeeds{seeds(), make(chan struct{}, 1)}
+	d, err := New(ctx, "127.0.0.1", "127.0.0.1", freePort(t), ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFailureDetector(ctx, "127.0.0.1", "127.0.0.1", freePort(t), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.TTL() != time.Minute || f.TTL() != time.Minute {
+		t.Errorf("expected the TTL of the seeds, got %v and %v", d.TTL(), f.TTL())
+	}
+	if got := f.String(); got != "seeds" {
+		t.Errorf("expected the failure detector to be described like its seeds, got %q", got)
+	}
+	ds.notify <- struct{}{}
+	fs.notify <- struct{}{}
+	for _, n := range []peerfinder.Notifier{d, f} {
+		select {
+		case <-n.Notify():
+		case <-ctx.Done():
+			t.Fatal("expected the notifications of the seeds to be forwarded")
+		}
+	}
+}
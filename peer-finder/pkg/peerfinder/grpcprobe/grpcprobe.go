@@ -0,0 +1,60 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package grpcprobe implements a peerfinder.Prober checking the standard gRPC
+// health service of the peers.
+package grpcprobe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// Prober asks the grpc.health.v1.Health service of the peers on Port for the
+// serving status of Service, over plaintext. Peers are reachable if it is
+// SERVING, the status being reported either way.
+type Prober struct {
+	Port int
+	// Service is the service whose status is checked, the server as a whole
+	// if empty.
+	Service string
+}
+
+// Probe implements peerfinder.Prober.
+func (pr Prober) Probe(ctx context.Context, p peerfinder.Peer) (string, error) {
+	conn, err := grpc.NewClient(net.JoinHostPort(p.Name, strconv.Itoa(pr.Port)), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: pr.Service})
+	if err != nil {
+		return "", err
+	}
+	status := resp.GetStatus()
+	if status != healthpb.HealthCheckResponse_SERVING {
+		return status.String(), fmt.Errorf("not serving: %s", status)
+	}
+	return status.String(), nil
+}
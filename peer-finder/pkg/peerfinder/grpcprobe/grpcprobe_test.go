@@ -0,0 +1,68 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcprobe
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestProber(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("db", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(l)
+	defer srv.Stop()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	cases := []struct {
+		name     string
+		peer     string
+		service  string
+		expected string
+		fails    bool
+	}{
+		{"serving", "127.0.0.1", "", "SERVING", false},
+		{"not serving", "127.0.0.1", "db", "NOT_SERVING", true},
+		{"unknown service", "127.0.0.1", "other", "", true},
+		{"unreachable", "127.0.0.2", "", "", true},
+	}
+	for _, c := range cases {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		status, err := Prober{Port: port, Service: c.service}.Probe(ctx, peerfinder.Peer{Name: c.peer})
+		cancel()
+		if status != c.expected {
+			t.Errorf("%s: expected status %q, got %q", c.name, c.expected, status)
+		}
+		if (err != nil) != c.fails {
+			t.Errorf("%s: expected failure %v, got %v", c.name, c.fails, err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// HandshakePath is the path HandshakeHandler is served on.
+const HandshakePath = "/handshake"
+
+// DefaultHandshakeTimeout bounds a handshake if HandshakeDiscoverer.Timeout
+// is not set.
+const DefaultHandshakeTimeout = 2 * time.Second
+
+// DefaultHandshakeConcurrency is how many handshakes are sent at once if
+// HandshakeDiscoverer.Concurrency is not set.
+const DefaultHandshakeConcurrency = 16
+
+// HandshakeDiscoverer only reports the peers of a Discoverer that answer a
+// handshake before being trusted: the HandshakeHandler of their peer-finder,
+// asked by this pod on Port, connects back to this pod on the same port. Both
+// pods can then reach each other, which DNS alone does not tell, e.g. when a
+// network policy blocks them. Self is always reported.
+type HandshakeDiscoverer struct {
+	Discoverer
+	// Self is the name this pod is found under by the others, set once
+	// known.
+	Self string
+	// Port is the port of the HandshakeHandler of the peers.
+	Port int
+	// Timeout bounds each handshake, DefaultHandshakeTimeout if 0.
+	Timeout time.Duration
+	// Concurrency is the count of workers shaking hands with the peers,
+	// bounding how many handshakes are sent at once,
+	// DefaultHandshakeConcurrency if 0.
+	Concurrency int
+	// Client sends the handshakes, http.DefaultClient if nil.
+	Client *http.Client
+	// OnFailure, if set, is called for each peer left out, with the error of
+	// its handshake. It may be called concurrently.
+	OnFailure func(p Peer, err error)
+}
+
+func (d *HandshakeDiscoverer) String() string {
+	return Source(d.Discoverer)
+}
+
+// Lookup implements Discoverer, shaking hands with the peers with at most
+// Concurrency workers. The peers not shaken hands with once ctx is done are
+// left out.
+func (d *HandshakeDiscoverer) Lookup(ctx context.Context) ([]Peer, error) {
+	peers, err := d.Discoverer.Lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ok := make([]bool, len(peers))
+	var others []int
+	for i, p := range peers {
+		if p.Name == d.Self {
+			ok[i] = true
+			continue
+		}
+		others = append(others, i)
+	}
+	concurrency := d.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultHandshakeConcurrency
+	}
+	forEach(ctx, concurrency, others, func(i int) {
+		if err := d.handshake(ctx, peers[i].Name); err != nil {
+			if d.OnFailure != nil {
+				d.OnFailure(peers[i], err)
+			}
+			return
+		}
+		ok[i] = true
+	})
+	var reachable []Peer
+	for i, p := range peers {
+		if ok[i] {
+			reachable = append(reachable, p)
+		}
+	}
+	return reachable, nil
+}
+
+// handshake asks the peer named peer to connect back to Self.
+func (d *HandshakeDiscoverer) handshake(ctx context.Context, peer string) error {
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	u := url.URL{
+		Scheme:   "http",
+		Host:     net.JoinHostPort(peer, strconv.Itoa(d.Port)),
+		Path:     HandshakePath,
+		RawQuery: url.Values{"from": {d.Self}}.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("handshake failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// TTL implements TTLer if the Discoverer does.
+func (d *HandshakeDiscoverer) TTL() time.Duration {
+	if t, ok := d.Discoverer.(TTLer); ok {
+		return t.TTL()
+	}
+	return 0
+}
+
+// Notify implements Notifier if the Discoverer does, the channel is nil
+// otherwise.
+func (d *HandshakeDiscoverer) Notify() <-chan struct{} {
+	if n, ok := d.Discoverer.(Notifier); ok {
+		return n.Notify()
+	}
+	return nil
+}
+
+// HandshakeHandler answers the handshakes of HandshakeDiscoverer: it connects
+// to the pod named by the from query parameter on the port the request was
+// received on, within timeout, and fails with 502 if it cannot. Only the
+// peers are ever connected to: from must resolve to an address of service,
+// the fully qualified name of the governing service, looked up with resolver
+// (net.DefaultResolver if nil), or the handshake is rejected with 403. That
+// address is the one connected to, and nothing is sent.
+func HandshakeHandler(timeout time.Duration, service string, resolver Resolver) http.Handler {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from := r.URL.Query().Get("from")
+		local, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+		if from == "" || !ok {
+			http.Error(w, "from is required", http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		ip, err := peerAddress(ctx, resolver, service, from)
+		if err != nil {
+			http.Error(w, "cannot resolve "+from, http.StatusBadGateway)
+			return
+		}
+		if ip == nil {
+			http.Error(w, from+" is not a peer", http.StatusForbidden)
+			return
+		}
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), strconv.Itoa(local.Port)))
+		if err != nil {
+			http.Error(w, "cannot reach "+from, http.StatusBadGateway)
+			return
+		}
+		conn.Close()
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// peerAddress returns the first address of the pod name that is also an
+// address of service, nil if there is none.
+func peerAddress(ctx context.Context, resolver Resolver, service, name string) (net.IP, error) {
+	ips, err := resolver.LookupIP(ctx, "ip", name)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := resolver.LookupIP(ctx, "ip", service)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if slices.ContainsFunc(peers, ip.Equal) {
+			return ip, nil
+		}
+	}
+	return nil, nil
+}
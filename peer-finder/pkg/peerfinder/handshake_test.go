@@ -0,0 +1,133 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHandshakeDiscoverer(t *testing.T) {
+	srv := httptest.NewServer(HandshakeHandler(DefaultHandshakeTimeout, "localhost", nil))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(port)
+	peers := []Peer{{Name: "127.0.0.1"}, {Name: "localhost"}, {Name: "127.0.0.2"}}
+	cases := []struct {
+		name     string
+		self     string
+		expected []string
+	}{
+		// localhost answers and reaches back to 127.0.0.1, 127.0.0.2 is not served.
+		{"reachable", "127.0.0.1", []string{"127.0.0.1", "localhost"}},
+		// 127.0.0.3 is not an address of the service, the peers do not
+		// connect back to it.
+		{"one way", "127.0.0.3", nil},
+	}
+	for _, c := range cases {
+		var mu sync.Mutex
+		var failed []string
+		d := &HandshakeDiscoverer{
+			Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) { return peers, nil }),
+			Self:       c.self,
+			Port:       n,
+			OnFailure: func(p Peer, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = append(failed, p.Name)
+			},
+		}
+		found, err := d.Lookup(context.Background())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		var names []string
+		for _, p := range found {
+			names = append(names, p.Name)
+		}
+		if !reflect.DeepEqual(names, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, names)
+		}
+		if len(failed)+len(names) != len(peers) {
+			t.Errorf("%s: expected the peers left out to be reported, got %v", c.name, failed)
+		}
+	}
+}
+
+// hostsResolver resolves the names of its map, failing for the others.
+type hostsResolver map[string][]net.IP
+
+func (r hostsResolver) LookupSRV(context.Context, string, string, string) (string, []*net.SRV, error) {
+	return "", nil, errors.New("no SRV records")
+}
+
+func (r hostsResolver) LookupIP(_ context.Context, _, host string) ([]net.IP, error) {
+	if ips, ok := r[host]; ok {
+		return ips, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestHandshakeHandler(t *testing.T) {
+	r := hostsResolver{
+		"svc":  {net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2")},
+		"a":    {net.ParseIP("127.0.0.1")},
+		"b":    {net.ParseIP("127.0.0.2")},
+		"evil": {net.ParseIP("192.0.2.1")},
+	}
+	srv := httptest.NewServer(HandshakeHandler(DefaultHandshakeTimeout, "svc", r))
+	defer srv.Close()
+	cases := []struct {
+		from     string
+		expected int
+	}{
+		{"a", http.StatusOK},
+		{"", http.StatusBadRequest},
+		// A peer nothing listens on.
+		{"b", http.StatusBadGateway},
+		{"missing", http.StatusBadGateway},
+		// Not a peer, whether or not it could be reached.
+		{"evil", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		resp, err := http.Get(srv.URL + HandshakePath + "?" + url.Values{"from": {c.from}}.Encode())
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", c.from, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.expected {
+			t.Errorf("%q: expected %d, got %d", c.from, c.expected, resp.StatusCode)
+		}
+		if strings.Contains(string(b), "refused") || strings.Contains(string(b), "no such host") {
+			t.Errorf("%q: expected the error not to be echoed, got %q", c.from, b)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AnnotatePod sets the annotation key of the pod named pod in namespace to
+// value with a merge patch, leaving its other annotations untouched.
+func AnnotatePod(ctx context.Context, client kubernetes.Interface, namespace, pod, key, value string) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": map[string]string{key: value}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().Pods(namespace).Patch(ctx, pod, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// SetPodCondition sets the condition conditionType of the status of the pod
+// named pod in namespace, e.g. that of a readiness gate, with a strategic
+// merge patch. This requires permission to patch pods/status.
+func SetPodCondition(ctx context.Context, client kubernetes.Interface, namespace, pod string, conditionType corev1.PodConditionType, status corev1.ConditionStatus, reason, message string) error {
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{"conditions": []corev1.PodCondition{{
+			Type:               conditionType,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: metav1.Now(),
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().Pods(namespace).Patch(ctx, pod, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// PeerAnnotations returns the annotation key of the pods of peers in
+// namespace, by peer. Peers are matched to pods by the first label of their
+// name, the hostname of StatefulSet pods, or by their address when found
+// through A or AAAA records. Peers without a pod, or whose pod lacks the
+// annotation, are left out.
+func PeerAnnotations(ctx context.Context, client kubernetes.Interface, namespace string, peers []string, key string) (map[string]string, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	byName, byIP := map[string]string{}, map[string]string{}
+	for _, p := range pods.Items {
+		v, ok := p.Annotations[key]
+		if !ok {
+			continue
+		}
+		byName[p.Name] = v
+		if p.Status.PodIP != "" {
+			byIP[p.Status.PodIP] = v
+		}
+	}
+	found := map[string]string{}
+	for _, peer := range peers {
+		var v string
+		var ok bool
+		if net.ParseIP(peer) != nil {
+			v, ok = byIP[peer]
+		} else {
+			host, _, _ := strings.Cut(peer, ".")
+			v, ok = byName[host]
+		}
+		if ok {
+			found[peer] = v
+		}
+	}
+	return found, nil
+}
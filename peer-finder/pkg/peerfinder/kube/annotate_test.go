@@ -0,0 +1,94 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAnnotatePod(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "web-0",
+		Namespace:   "default",
+		Annotations: map[string]string{"other": "kept"},
+	}})
+	for _, value := range []string{"a", "b"} {
+		if err := AnnotatePod(ctx, client, "default", "web-0", "peer-finder.io/peers-hash", value); err != nil {
+			t.Fatal(err)
+		}
+		p, err := client.CoreV1().Pods("default").Get(ctx, "web-0", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Annotations["peer-finder.io/peers-hash"] != value || p.Annotations["other"] != "kept" {
+			t.Errorf("unexpected annotations %v", p.Annotations)
+		}
+	}
+	if err := AnnotatePod(ctx, client, "default", "web-1", "peer-finder.io/peers-hash", "a"); err == nil {
+		t.Errorf("expected an error for a missing pod")
+	}
+}
+
+func TestSetPodCondition(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"},
+		Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}},
+	})
+	if err := SetPodCondition(ctx, client, "default", "web-0", "peer-finder.io/clustered", corev1.ConditionTrue, "Clustered", "joined"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := client.CoreV1().Pods("default").Get(ctx, "web-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[corev1.PodConditionType]corev1.ConditionStatus{}
+	for _, c := range p.Status.Conditions {
+		statuses[c.Type] = c.Status
+	}
+	if statuses["peer-finder.io/clustered"] != corev1.ConditionTrue || statuses[corev1.PodReady] != corev1.ConditionFalse {
+		t.Errorf("unexpected conditions %v", p.Status.Conditions)
+	}
+}
+
+func TestPeerAnnotations(t *testing.T) {
+	key := "peer-finder.io/seen-peers-hash"
+	client := fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", Annotations: map[string]string{key: "a"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-x7k2p", Namespace: "default", Annotations: map[string]string{key: "b"}},
+			Status:     corev1.PodStatus{PodIP: "10.0.0.3"},
+		},
+	)
+	peers := []string{"web-0.nginx.default.svc.cluster.local", "web-1.nginx.default.svc.cluster.local", "web-2.nginx.default.svc.cluster.local", "10.0.0.3"}
+	got, err := PeerAnnotations(context.Background(), client, "default", peers, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"web-0.nginx.default.svc.cluster.local": "a", "10.0.0.3": "b"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
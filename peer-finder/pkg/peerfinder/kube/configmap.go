@@ -0,0 +1,63 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// ConfigMapWriter writes the data of a ConfigMap, creating it if missing.
+type ConfigMapWriter struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapWriter returns a ConfigMapWriter for the ConfigMap named name in
+// namespace.
+func NewConfigMapWriter(client kubernetes.Interface, namespace, name string) *ConfigMapWriter {
+	return &ConfigMapWriter{client: client, namespace: namespace, name: name}
+}
+
+// Write replaces the data of the ConfigMap, which is left untouched if it
+// already holds data. Conflicting updates are retried.
+func (w *ConfigMapWriter) Write(ctx context.Context, data map[string]string) error {
+	configMaps := w.client.CoreV1().ConfigMaps(w.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, w.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: w.name, Namespace: w.namespace},
+				Data:       data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil || reflect.DeepEqual(cm.Data, data) {
+			return err
+		}
+		cm.Data = data
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapWriter(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	w := NewConfigMapWriter(client, "default", "nginx-peers")
+	for _, data := range []map[string]string{
+		{"peers": "web-0"},
+		{"peers": "web-0\nweb-1"},
+		{"peers": "web-0\nweb-1"},
+	} {
+		if err := w.Write(ctx, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cm, err := client.CoreV1().ConfigMaps("default").Get(ctx, "nginx-peers", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(cm.Data, data) {
+			t.Errorf("expected %v, got %v", data, cm.Data)
+		}
+	}
+	// The unchanged data isn't written again.
+	var updates int
+	for _, a := range client.Actions() {
+		if a.GetVerb() == "update" {
+			updates++
+		}
+	}
+	if updates != 1 {
+		t.Errorf("expected 1 update, got %d", updates)
+	}
+}
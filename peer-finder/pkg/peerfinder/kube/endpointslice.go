@@ -0,0 +1,301 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kube implements peer discovery backends on top of the Kubernetes API.
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// EndpointSliceDiscoverer finds peers through the EndpointSlices of a service,
+// keeping them up to date with an informer.
+type EndpointSliceDiscoverer struct {
+	namespace string
+	service   string
+	domain    string
+	selector  labels.Selector
+	lister    discoverylisters.EndpointSliceLister
+	notify    chan struct{}
+	// imported is set for the EndpointSlices of a ServiceImport, whose peers
+	// are named after their source cluster as well.
+	imported bool
+
+	// PortName selects the port reported for peers by name. If empty, the
+	// lowest port is reported.
+	PortName string
+	// IncludeNotReady reports not ready endpoints too, as NotReady peers.
+	IncludeNotReady bool
+	// Nodes, if set, gives the region of peers, and their zone if the
+	// EndpointSlice has none. Unused for imported EndpointSlices, whose nodes
+	// are in other clusters.
+	Nodes *NodeTopology
+	// PodMetadata selects the labels and annotations of the pods of peers
+	// reported once WatchPods is called.
+	PodMetadata PodMetadata
+
+	pods corelisters.PodLister
+}
+
+// InClusterClient returns a clientset using the service account of the pod.
+func InClusterClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// ClientFromKubeconfig returns a clientset for the current context of the
+// kubeconfig file at path, e.g. to reach another cluster.
+func ClientFromKubeconfig(path string) (kubernetes.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", path)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// NewEndpointSliceDiscoverer starts watching the EndpointSlices of service in
+// namespace and waits for the initial list. Peer names are built like their
+// DNS counterparts, i.e. <hostname>.<service>.<domain>. The informer runs
+// until ctx is cancelled.
+//
+// An error is returned if the EndpointSlices cannot be listed, e.g. because
+// the service account lacks the RBAC permissions to do so.
+func NewEndpointSliceDiscoverer(ctx context.Context, client kubernetes.Interface, namespace, service, domain string) (*EndpointSliceDiscoverer, error) {
+	d := &EndpointSliceDiscoverer{
+		namespace: namespace,
+		service:   service,
+		domain:    domain,
+		selector:  labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service}),
+	}
+	if err := d.start(ctx, client); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// start starts the informer of the EndpointSlices matching d.selector and
+// waits for the initial list.
+func (d *EndpointSliceDiscoverer) start(ctx context.Context, client kubernetes.Interface) error {
+	selector := d.selector.String()
+	// Check access up front, the informer would otherwise retry forever.
+	if _, err := client.DiscoveryV1().EndpointSlices(d.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector, Limit: 1}); err != nil {
+		return err
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(d.namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = selector
+		}))
+	informer := factory.Discovery().V1().EndpointSlices()
+	d.lister = informer.Lister()
+	d.notify = make(chan struct{}, 1)
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { d.changed() },
+		UpdateFunc: func(interface{}, interface{}) { d.changed() },
+		DeleteFunc: func(interface{}) { d.changed() },
+	})
+	factory.Start(ctx.Done())
+	for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync %v informer", typ)
+		}
+	}
+	return nil
+}
+
+// WatchPods starts watching the pods selected by the service, for the
+// PodMetadata of peers, and waits for the initial list. Changes of the
+// selected labels and annotations of peers notify too. The informer runs
+// until ctx is cancelled.
+//
+// An error is returned if the service cannot be read or selects no pods, e.g.
+// because it is managed without a selector.
+func (d *EndpointSliceDiscoverer) WatchPods(ctx context.Context, client kubernetes.Interface) error {
+	svc, err := client.CoreV1().Services(d.namespace).Get(ctx, d.service, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return fmt.Errorf("service %s/%s has no selector", d.namespace, d.service)
+	}
+	selector := labels.SelectorFromSet(svc.Spec.Selector).String()
+	// Check access up front, the informer would otherwise retry forever.
+	if _, err := client.CoreV1().Pods(d.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector, Limit: 1}); err != nil {
+		return err
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(d.namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = selector
+		}))
+	informer := factory.Core().V1().Pods()
+	pods := informer.Lister()
+	meta := d.PodMetadata
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, new interface{}) {
+			o, _ := old.(*corev1.Pod)
+			n, _ := new.(*corev1.Pod)
+			if o != nil && n != nil && meta.changed(o, n) && d.isPeer(n.Name) {
+				d.changed()
+			}
+		},
+	})
+	factory.Start(ctx.Done())
+	for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync %v informer", typ)
+		}
+	}
+	d.pods = pods
+	return nil
+}
+
+func (d *EndpointSliceDiscoverer) String() string {
+	if d.imported {
+		return "serviceimport:" + d.namespace + "/" + d.service
+	}
+	return "endpointslice:" + d.namespace + "/" + d.service
+}
+
+// isPeer returns whether the pod named pod is an endpoint of the service.
+func (d *EndpointSliceDiscoverer) isPeer(pod string) bool {
+	slices, err := d.lister.EndpointSlices(d.namespace).List(d.selector)
+	if err != nil {
+		return false
+	}
+	for _, slice := range slices {
+		for _, ep := range slice.Endpoints {
+			if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" && ep.TargetRef.Name == pod {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *EndpointSliceDiscoverer) changed() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Notify implements peerfinder.Notifier.
+func (d *EndpointSliceDiscoverer) Notify() <-chan struct{} {
+	return d.notify
+}
+
+// Lookup implements peerfinder.Discoverer. Only ready endpoints are returned
+// unless IncludeNotReady is set, which matches what is published in DNS:
+// endpoints of a service that publishes not ready addresses are always
+// reported as ready. Terminating endpoints are never returned, unlike in DNS,
+// so that peers shutting down aren't added.
+func (d *EndpointSliceDiscoverer) Lookup(ctx context.Context) ([]peerfinder.Peer, error) {
+	slices, err := d.lister.EndpointSlices(d.namespace).List(d.selector)
+	if err != nil {
+		return nil, err
+	}
+	var peers []peerfinder.Peer
+	for _, slice := range slices {
+		port := d.port(slice)
+		cluster := slice.Labels[SourceClusterLabel]
+		if d.imported && cluster == "" {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			notReady := ep.Conditions.Ready != nil && !*ep.Conditions.Ready
+			if notReady && !d.IncludeNotReady || ep.Conditions.Terminating != nil && *ep.Conditions.Terminating {
+				continue
+			}
+			name := d.hostname(ep)
+			if name == "" {
+				continue
+			}
+			labels := []string{name, d.service, d.domain}
+			if d.imported {
+				labels = []string{name, cluster, d.service, d.domain}
+			}
+			p := peerfinder.Peer{Name: strings.Join(labels, "."), Port: port, Cluster: cluster, NotReady: notReady}
+			if ep.Zone != nil {
+				p.Zone = *ep.Zone
+			}
+			if ep.NodeName != nil && !d.imported {
+				zone, region := d.Nodes.Topology(*ep.NodeName)
+				if p.Zone == "" {
+					p.Zone = zone
+				}
+				p.Region = region
+			}
+			if d.pods != nil && ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+				if pod, err := d.pods.Pods(d.namespace).Get(ep.TargetRef.Name); err == nil {
+					d.PodMetadata.set(&p, pod)
+				}
+			}
+			peers = append(peers, p)
+		}
+	}
+	return peers, nil
+}
+
+// port returns the port of the endpoints of slice, 0 if unknown.
+func (d *EndpointSliceDiscoverer) port(slice *discoveryv1.EndpointSlice) int {
+	port := 0
+	for _, p := range slice.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if d.PortName != "" {
+			if p.Name != nil && *p.Name == d.PortName {
+				return int(*p.Port)
+			}
+			continue
+		}
+		if port == 0 || int(*p.Port) < port {
+			port = int(*p.Port)
+		}
+	}
+	return port
+}
+
+func (d *EndpointSliceDiscoverer) hostname(ep discoveryv1.Endpoint) string {
+	if ep.Hostname != nil {
+		return *ep.Hostname
+	}
+	if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+		return ep.TargetRef.Name
+	}
+	return ""
+}
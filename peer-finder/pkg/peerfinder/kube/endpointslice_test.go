@@ -0,0 +1,82 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// endpoint returns an endpoint of hostname with the given conditions, nil
+// for unset.
+func endpoint(hostname string, ready, terminating *bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{Hostname: &hostname, Conditions: discoveryv1.EndpointConditions{Ready: ready, Terminating: terminating}}
+}
+
+func TestEndpointSliceReadiness(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	yes, no := true, false
+	client := fake.NewSimpleClientset(&discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Labels: map[string]string{discoveryv1.LabelServiceName: "nginx"}},
+		Endpoints: []discoveryv1.Endpoint{
+			endpoint("web-0", &yes, &no),
+			endpoint("web-1", nil, nil),
+			endpoint("web-2", &no, &no),
+			// Ready although terminating, as with publishNotReadyAddresses.
+			endpoint("web-3", &yes, &yes),
+			endpoint("web-4", &no, &yes),
+		},
+	})
+	d, err := NewEndpointSliceDiscoverer(ctx, client, "default", "nginx", "default.svc.cluster.local")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		includeNotReady bool
+		expected        []peerfinder.Peer
+	}{
+		{false, []peerfinder.Peer{
+			{Name: "web-0.nginx.default.svc.cluster.local"},
+			{Name: "web-1.nginx.default.svc.cluster.local"},
+		}},
+		{true, []peerfinder.Peer{
+			{Name: "web-0.nginx.default.svc.cluster.local"},
+			{Name: "web-1.nginx.default.svc.cluster.local"},
+			{Name: "web-2.nginx.default.svc.cluster.local", NotReady: true},
+		}},
+	}
+	for _, c := range cases {
+		d.IncludeNotReady = c.includeNotReady
+		peers, err := d.Lookup(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+		if !reflect.DeepEqual(peers, c.expected) {
+			t.Errorf("not ready %v: expected %v, got %v", c.includeNotReady, c.expected, peers)
+		}
+	}
+}
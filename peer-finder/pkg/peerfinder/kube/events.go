@@ -0,0 +1,75 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventComponent is the source of the events posted by EventRecorder.
+const eventComponent = "peer-finder"
+
+// EventRecorder posts Events about a pod, shown by `kubectl describe pod`.
+type EventRecorder struct {
+	client kubernetes.Interface
+	pod    corev1.ObjectReference
+}
+
+// NewPodEventRecorder returns an EventRecorder for the pod named pod in
+// namespace, which is read to get its UID. An error is returned if it cannot
+// be, e.g. because the service account lacks the permission to get pods.
+func NewPodEventRecorder(ctx context.Context, client kubernetes.Interface, namespace, pod string) (*EventRecorder, error) {
+	p, err := client.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &EventRecorder{
+		client: client,
+		pod: corev1.ObjectReference{
+			Kind:            "Pod",
+			APIVersion:      "v1",
+			Namespace:       p.Namespace,
+			Name:            p.Name,
+			UID:             p.UID,
+			ResourceVersion: p.ResourceVersion,
+		},
+	}, nil
+}
+
+// Event posts an event of type eventType, corev1.EventTypeNormal or
+// corev1.EventTypeWarning.
+func (r *EventRecorder) Event(ctx context.Context, eventType, reason, message string) error {
+	now := metav1.Now()
+	_, err := r.client.CoreV1().Events(r.pod.Namespace).Create(ctx, &corev1.Event{
+		ObjectMeta:          metav1.ObjectMeta{GenerateName: r.pod.Name + ".", Namespace: r.pod.Namespace},
+		InvolvedObject:      r.pod,
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Source:              corev1.EventSource{Component: eventComponent},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: eventComponent,
+		ReportingInstance:   r.pod.Name,
+	}, metav1.CreateOptions{})
+	return err
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEventRecorder(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", UID: "1234"}})
+	r, err := NewPodEventRecorder(context.Background(), client, "default", "web-0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Event(context.Background(), corev1.EventTypeNormal, "PeersChanged", "web-1 joined"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, err := client.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events.Items))
+	}
+	e := events.Items[0]
+	if e.InvolvedObject.UID != "1234" || e.Reason != "PeersChanged" || e.Message != "web-1 joined" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	if _, err := NewPodEventRecorder(context.Background(), client, "default", "missing"); err == nil {
+		t.Errorf("expected an error for a missing pod")
+	}
+}
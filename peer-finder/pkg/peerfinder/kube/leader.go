@@ -0,0 +1,88 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Timings of the leader election, those of the Kubernetes controllers.
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// LeaseElector elects one leader among the pods sharing a Lease.
+type LeaseElector struct {
+	elector *leaderelection.LeaderElector
+}
+
+// NewLeaseElector returns a LeaseElector campaigning for the Lease named name
+// in namespace as identity, e.g. the name of the pod, once Run is called.
+func NewLeaseElector(client kubernetes.Interface, namespace, name, identity string) (*LeaseElector, error) {
+	e, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		// Let another pod take over right away when this one exits.
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) { slog.Info("Started leading", "lease", name) },
+			OnStoppedLeading: func() { slog.Info("Stopped leading", "lease", name) },
+			OnNewLeader:      func(leader string) { slog.Info("New leader", "lease", name, "leader", leader) },
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &LeaseElector{e}, nil
+}
+
+// Run campaigns for the Lease until ctx is cancelled, campaigning again
+// whenever leadership is lost.
+func (e *LeaseElector) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		e.elector.Run(ctx)
+	}
+}
+
+// Leading returns whether this pod is the leader.
+func (e *LeaseElector) Leading() bool {
+	return e.elector.IsLeader()
+}
+
+// WaitForLeader waits until a leader is known, this pod or another.
+func (e *LeaseElector) WaitForLeader(ctx context.Context) error {
+	return wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(context.Context) (bool, error) {
+		return e.elector.GetLeader() != "", nil
+	})
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaseElector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := fake.NewSimpleClientset()
+	var electors []*LeaseElector
+	for _, pod := range []string{"web-0", "web-1"} {
+		e, err := NewLeaseElector(client, "default", "web-leader", pod)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		go e.Run(ctx)
+		electors = append(electors, e)
+	}
+	for _, e := range electors {
+		if err := e.WaitForLeader(ctx); err != nil {
+			t.Fatalf("expected a leader: %v", err)
+		}
+	}
+	// The leader knows it leads shortly after it is known.
+	for {
+		leaders := 0
+		for _, e := range electors {
+			if e.Leading() {
+				leaders++
+			}
+		}
+		if leaders == 1 {
+			break
+		}
+		if leaders > 1 || ctx.Err() != nil {
+			t.Fatalf("expected one leader, got %d", leaders)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Labels of the EndpointSlices imported by Multi-Cluster Services (MCS, KEP-1645)
+// implementations for a ServiceImport.
+const (
+	// ServiceNameLabel is the name of the ServiceImport.
+	ServiceNameLabel = "multicluster.kubernetes.io/service-name"
+	// SourceClusterLabel is the ID of the cluster the endpoints are exported
+	// from.
+	SourceClusterLabel = "multicluster.kubernetes.io/source-cluster"
+)
+
+// clusterProperties is the resource of the ClusterProperties of KEP-2149.
+var clusterProperties = schema.GroupVersionResource{Group: "about.k8s.io", Version: "v1alpha1", Resource: "clusterproperties"}
+
+// InClusterDynamicClient returns a dynamic client using the service account
+// of the pod.
+func InClusterDynamicClient() (dynamic.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
+// ClusterID returns the ID of the cluster within its clusterset, the value of
+// its id.k8s.io ClusterProperty.
+func ClusterID(ctx context.Context, client dynamic.Interface) (string, error) {
+	p, err := client.Resource(clusterProperties).Get(ctx, "id.k8s.io", metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	id, _, err := unstructured.NestedString(p.Object, "spec", "value")
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", fmt.Errorf("empty id.k8s.io ClusterProperty")
+	}
+	return id, nil
+}
+
+// NewServiceImportDiscoverer is like NewEndpointSliceDiscoverer for the
+// EndpointSlices an MCS implementation imports for the ServiceImport of
+// service, which hold the endpoints of all the clusters of the clusterset.
+// Peer names are built like their clusterset DNS counterparts, i.e.
+// <hostname>.<cluster>.<service>.<domain>, domain being e.g.
+// "default.svc.clusterset.local".
+func NewServiceImportDiscoverer(ctx context.Context, client kubernetes.Interface, namespace, service, domain string) (*EndpointSliceDiscoverer, error) {
+	d := &EndpointSliceDiscoverer{
+		namespace: namespace,
+		service:   service,
+		domain:    domain,
+		selector:  labels.SelectorFromSet(labels.Set{ServiceNameLabel: service}),
+		imported:  true,
+	}
+	if err := d.start(ctx, client); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
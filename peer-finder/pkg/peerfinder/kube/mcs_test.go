@@ -0,0 +1,103 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// importedSlice returns an EndpointSlice imported from cluster with an
+// endpoint per hostname.
+func importedSlice(name, cluster string, hostnames ...string) *discoveryv1.EndpointSlice {
+	port := int32(80)
+	s := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{ServiceNameLabel: "nginx"}},
+		Ports:      []discoveryv1.EndpointPort{{Port: &port}},
+	}
+	if cluster != "" {
+		s.Labels[SourceClusterLabel] = cluster
+	}
+	for _, h := range hostnames {
+		h := h
+		s.Endpoints = append(s.Endpoints, discoveryv1.Endpoint{Hostname: &h})
+	}
+	return s
+}
+
+func TestServiceImportDiscoverer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset(
+		importedSlice("east", "east", "web-0", "web-1"),
+		importedSlice("west", "west", "web-0"),
+		importedSlice("unknown", "", "web-9"),
+	)
+	d, err := NewServiceImportDiscoverer(ctx, client, "default", "nginx", "default.svc.clusterset.local")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	peers, err := d.Lookup(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := map[string]peerfinder.Peer{}
+	for _, p := range peers {
+		names[p.Name] = p
+	}
+	expected := map[string]peerfinder.Peer{
+		"web-0.east.nginx.default.svc.clusterset.local": {Name: "web-0.east.nginx.default.svc.clusterset.local", Port: 80, Cluster: "east"},
+		"web-1.east.nginx.default.svc.clusterset.local": {Name: "web-1.east.nginx.default.svc.clusterset.local", Port: 80, Cluster: "east"},
+		"web-0.west.nginx.default.svc.clusterset.local": {Name: "web-0.west.nginx.default.svc.clusterset.local", Port: 80, Cluster: "west"},
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestClusterID(t *testing.T) {
+	property := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "about.k8s.io/v1alpha1",
+		"kind":       "ClusterProperty",
+		"metadata":   map[string]interface{}{"name": "id.k8s.io"},
+		"spec":       map[string]interface{}{"value": "east"},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{clusterProperties: "ClusterPropertyList"}, property)
+	id, err := ClusterID(context.Background(), client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "east" {
+		t.Errorf("expected east, got %q", id)
+	}
+	if _, err := ClusterID(context.Background(), dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{clusterProperties: "ClusterPropertyList"})); err == nil {
+		t.Errorf("expected an error without ClusterProperty")
+	}
+}
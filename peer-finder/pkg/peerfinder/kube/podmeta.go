@@ -0,0 +1,59 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// PodMetadata selects the labels and annotations of pods reported with their
+// peers.
+type PodMetadata struct {
+	Labels      []string
+	Annotations []string
+}
+
+// set sets the selected labels and annotations of pod on p.
+func (m PodMetadata) set(p *peerfinder.Peer, pod *corev1.Pod) {
+	p.Labels = selected(pod.Labels, m.Labels)
+	p.Annotations = selected(pod.Annotations, m.Annotations)
+}
+
+// changed returns whether the labels and annotations selected of a pod differ
+// between old and new.
+func (m PodMetadata) changed(old, new *corev1.Pod) bool {
+	return !maps.Equal(selected(old.Labels, m.Labels), selected(new.Labels, m.Labels)) ||
+		!maps.Equal(selected(old.Annotations, m.Annotations), selected(new.Annotations, m.Annotations))
+}
+
+// selected returns the entries of m with keys, nil if there are none.
+func selected(m map[string]string, keys []string) map[string]string {
+	var s map[string]string
+	for _, k := range keys {
+		if v, ok := m[k]; ok {
+			if s == nil {
+				s = map[string]string{}
+			}
+			s[k] = v
+		}
+	}
+	return s
+}
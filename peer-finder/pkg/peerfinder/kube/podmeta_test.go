@@ -0,0 +1,144 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestPodMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primary, replica := pod("web-0", "web", "10.0.0.1", true), pod("web-1", "web", "10.0.0.2", true)
+	primary.Labels["role"], primary.Annotations = "primary", map[string]string{"version": "2.1", "other": "x"}
+	hostnames := []string{"web-0", "web-1"}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Labels: map[string]string{discoveryv1.LabelServiceName: "nginx"}},
+		Endpoints: []discoveryv1.Endpoint{
+			{Hostname: &hostnames[0], TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "web-0"}},
+			{Hostname: &hostnames[1], TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "web-1"}},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	}
+	// Another app of the namespace, not selected by the service.
+	other := pod("db-0", "db", "10.0.0.3", true)
+	client := fake.NewSimpleClientset(primary, replica, slice, svc, other)
+	meta := PodMetadata{Labels: []string{"role"}, Annotations: []string{"version"}}
+	expected := []struct {
+		labels, annotations map[string]string
+	}{
+		{map[string]string{"role": "primary"}, map[string]string{"version": "2.1"}},
+		{nil, nil},
+	}
+
+	d, err := NewEndpointSliceDiscoverer(ctx, client, "default", "nginx", "default.svc.cluster.local")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.PodMetadata = meta
+	if err := d.WatchPods(ctx, client); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if watched, _ := d.pods.List(labels.Everything()); len(watched) != 2 {
+		t.Errorf("expected the 2 pods of the service to be watched, got %d", len(watched))
+	}
+	pods, err := NewPodDiscoverer(ctx, client, "default", labels.SelectorFromSet(labels.Set{"app": "web"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pods.PodMetadata = meta
+
+	for name, disc := range map[string]peerfinder.Discoverer{"endpointslice": d, "pods": pods} {
+		peers, err := disc.Lookup(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+		if len(peers) != len(expected) {
+			t.Fatalf("%s: expected %d peers, got %v", name, len(expected), peers)
+		}
+		for i, e := range expected {
+			if !reflect.DeepEqual(peers[i].Labels, e.labels) || !reflect.DeepEqual(peers[i].Annotations, e.annotations) {
+				t.Errorf("%s: expected %v and %v for %s, got %v and %v", name, e.labels, e.annotations, peers[i].Name, peers[i].Labels, peers[i].Annotations)
+			}
+		}
+	}
+}
+
+func TestPodMetadataNotify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	web := pod("web-0", "web", "10.0.0.1", true)
+	hostname := "web-0"
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Labels: map[string]string{discoveryv1.LabelServiceName: "nginx"}},
+		Endpoints:  []discoveryv1.Endpoint{{Hostname: &hostname, TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "web-0"}}},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	}
+	client := fake.NewSimpleClientset(web, slice, svc)
+	d, err := NewEndpointSliceDiscoverer(ctx, client, "default", "nginx", "default.svc.cluster.local")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.PodMetadata = PodMetadata{Labels: []string{"role"}}
+	if err := d.WatchPods(ctx, client); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Drain the notification of the initial list.
+	select {
+	case <-d.Notify():
+	default:
+	}
+	update := func(f func(p *corev1.Pod)) {
+		f(web)
+		if _, err := client.CoreV1().Pods("default").Update(ctx, web, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The status of the pod is not reported.
+	update(func(p *corev1.Pod) { p.Status.PodIP = "10.0.0.9" })
+	select {
+	case <-d.Notify():
+		t.Errorf("expected no notification for a change of status")
+	case <-time.After(100 * time.Millisecond):
+	}
+	update(func(p *corev1.Pod) { p.Labels["role"] = "primary" })
+	select {
+	case <-d.Notify():
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected a notification for a change of a selected label")
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// PodDiscoverer finds peers among the pods matching a label selector, for
+// workloads without a governing service such as DaemonSets. Peers are named
+// after their IP, keeping them up to date with an informer.
+type PodDiscoverer struct {
+	namespace string
+	selector  labels.Selector
+	lister    corelisters.PodLister
+	notify    chan struct{}
+
+	// PortName selects the container port reported for peers by name. If
+	// empty, the lowest port is reported.
+	PortName string
+	// IncludeNotReady reports not ready pods too, as NotReady peers.
+	IncludeNotReady bool
+	// Nodes, if set, gives the zone and region of peers.
+	Nodes *NodeTopology
+	// PodMetadata selects the labels and annotations of pods reported with
+	// their peers.
+	PodMetadata PodMetadata
+}
+
+// ParseSelector parses a label selector, e.g. app=web,tier!=cache, for
+// NewPodDiscoverer.
+func ParseSelector(s string) (labels.Selector, error) {
+	return labels.Parse(s)
+}
+
+// NewPodDiscoverer starts watching the pods matching selector in namespace
+// and waits for the initial list. The informer runs until ctx is cancelled.
+//
+// An error is returned if the pods cannot be listed, e.g. because the
+// service account lacks the RBAC permissions to do so.
+func NewPodDiscoverer(ctx context.Context, client kubernetes.Interface, namespace string, selector labels.Selector) (*PodDiscoverer, error) {
+	d := &PodDiscoverer{namespace: namespace, selector: selector, notify: make(chan struct{}, 1)}
+	// Check access up front, the informer would otherwise retry forever.
+	if _, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String(), Limit: 1}); err != nil {
+		return nil, err
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = selector.String()
+		}))
+	informer := factory.Core().V1().Pods()
+	d.lister = informer.Lister()
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { d.changed() },
+		UpdateFunc: func(interface{}, interface{}) { d.changed() },
+		DeleteFunc: func(interface{}) { d.changed() },
+	})
+	factory.Start(ctx.Done())
+	for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("failed to sync %v informer", typ)
+		}
+	}
+	return d, nil
+}
+
+func (d *PodDiscoverer) String() string {
+	return "pods:" + d.namespace + "/" + d.selector.String()
+}
+
+func (d *PodDiscoverer) changed() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Notify implements peerfinder.Notifier.
+func (d *PodDiscoverer) Notify() <-chan struct{} {
+	return d.notify
+}
+
+// Lookup implements peerfinder.Discoverer. Only running pods with an IP that
+// are not being deleted are returned, and only ready ones unless
+// IncludeNotReady is set.
+func (d *PodDiscoverer) Lookup(ctx context.Context) ([]peerfinder.Peer, error) {
+	pods, err := d.lister.Pods(d.namespace).List(d.selector)
+	if err != nil {
+		return nil, err
+	}
+	var peers []peerfinder.Peer
+	for _, pod := range pods {
+		if pod.Status.PodIP == "" || pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		notReady := !podReady(pod)
+		if notReady && !d.IncludeNotReady {
+			continue
+		}
+		zone, region := d.Nodes.Topology(pod.Spec.NodeName)
+		p := peerfinder.Peer{Name: pod.Status.PodIP, Port: d.port(pod), NotReady: notReady, Zone: zone, Region: region}
+		d.PodMetadata.set(&p, pod)
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// port returns the port of the containers of pod, 0 if unknown.
+func (d *PodDiscoverer) port(pod *corev1.Pod) int {
+	port := 0
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if d.PortName != "" {
+				if p.Name == d.PortName {
+					return int(p.ContainerPort)
+				}
+				continue
+			}
+			if port == 0 || int(p.ContainerPort) < port {
+				port = int(p.ContainerPort)
+			}
+		}
+	}
+	return port
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// pod returns a running pod of the app label with ip, ready if ready is set.
+func pod(name, app, ip string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": app}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "app",
+			Ports: []corev1.ContainerPort{{Name: "gossip", ContainerPort: 7946}, {Name: "http", ContainerPort: 80}},
+		}}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			PodIP:      ip,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+// terminating marks p as being deleted.
+func terminating(p *corev1.Pod) *corev1.Pod {
+	now := metav1.Now()
+	p.DeletionTimestamp = &now
+	return p
+}
+
+func TestPodDiscoverer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset(
+		pod("agent-a", "agent", "10.0.0.1", true),
+		pod("agent-b", "agent", "10.0.0.2", true),
+		pod("agent-c", "agent", "10.0.0.3", false),
+		pod("agent-d", "agent", "", true),
+		pod("web", "web", "10.0.0.4", true),
+		terminating(pod("agent-e", "agent", "10.0.0.5", true)),
+	)
+	cases := []struct {
+		portName        string
+		includeNotReady bool
+		expected        []peerfinder.Peer
+	}{
+		{"", false, []peerfinder.Peer{{Name: "10.0.0.1", Port: 80}, {Name: "10.0.0.2", Port: 80}}},
+		{"gossip", false, []peerfinder.Peer{{Name: "10.0.0.1", Port: 7946}, {Name: "10.0.0.2", Port: 7946}}},
+		{"", true, []peerfinder.Peer{{Name: "10.0.0.1", Port: 80}, {Name: "10.0.0.2", Port: 80}, {Name: "10.0.0.3", Port: 80, NotReady: true}}},
+	}
+	d, err := NewPodDiscoverer(ctx, client, "default", labels.SelectorFromSet(labels.Set{"app": "agent"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range cases {
+		d.PortName, d.IncludeNotReady = c.portName, c.includeNotReady
+		peers, err := d.Lookup(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+		if !reflect.DeepEqual(peers, c.expected) {
+			t.Errorf("port name %q, not ready %v: expected %v, got %v", c.portName, c.includeNotReady, c.expected, peers)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// StatefulSetReplicas returns the desired count of replicas of the
+// StatefulSet owning the pod named pod in namespace.
+func StatefulSetReplicas(ctx context.Context, client kubernetes.Interface, namespace, pod string) (int, error) {
+	name, err := statefulSetOf(ctx, client, namespace, pod)
+	if err != nil {
+		return 0, err
+	}
+	sts, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return replicas(sts), nil
+}
+
+// WatchStatefulSetReplicas starts watching the StatefulSet owning the pod
+// named pod in namespace and returns a channel receiving its desired count of
+// replicas, first the current one then each time it changes. Only the latest
+// count is kept if the channel is not read meanwhile. The informer runs until
+// ctx is cancelled.
+func WatchStatefulSetReplicas(ctx context.Context, client kubernetes.Interface, namespace, pod string) (<-chan int, error) {
+	name, err := statefulSetOf(ctx, client, namespace, pod)
+	if err != nil {
+		return nil, err
+	}
+	// Check access up front, the informer would otherwise retry forever.
+	if _, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	ch := make(chan int, 1)
+	last := -1
+	changed := func(obj interface{}) {
+		sts, ok := obj.(*appsv1.StatefulSet)
+		if !ok || sts.Name != name || replicas(sts) == last {
+			return
+		}
+		last = replicas(sts)
+		// Replace the count waiting to be read, if any.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- last
+	}
+	factory.Apps().V1().StatefulSets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    changed,
+		UpdateFunc: func(_, obj interface{}) { changed(obj) },
+	})
+	factory.Start(ctx.Done())
+	for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("failed to sync %v informer", typ)
+		}
+	}
+	return ch, nil
+}
+
+// statefulSetOf returns the name of the StatefulSet owning the pod named pod
+// in namespace.
+func statefulSetOf(ctx context.Context, client kubernetes.Interface, namespace, pod string) (string, error) {
+	p, err := client.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	owner := metav1.GetControllerOf(p)
+	if owner == nil || owner.Kind != "StatefulSet" {
+		return "", fmt.Errorf("pod %s/%s is not owned by a StatefulSet", namespace, pod)
+	}
+	return owner.Name, nil
+}
+
+// replicas returns the desired count of replicas of sts.
+func replicas(sts *appsv1.StatefulSet) int {
+	if sts.Spec.Replicas == nil {
+		// Defaulted by the API server, but be safe.
+		return 1
+	}
+	return int(*sts.Spec.Replicas)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStatefulSetReplicas(t *testing.T) {
+	replicas := int32(3)
+	controller := true
+	client := fake.NewSimpleClientset(
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-0",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "web", Controller: &controller}},
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "standalone", Namespace: "default"}},
+	)
+	n, err := StatefulSetReplicas(context.Background(), client, "default", "web-0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 replicas, got %d", n)
+	}
+	if _, err := StatefulSetReplicas(context.Background(), client, "default", "standalone"); err == nil {
+		t.Errorf("expected an error for a pod without StatefulSet")
+	}
+}
+
+func TestWatchStatefulSetReplicas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	replicas := int32(3)
+	controller := true
+	client := fake.NewSimpleClientset(
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-2",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "web", Controller: &controller}},
+		}},
+	)
+	ch, err := WatchStatefulSetReplicas(ctx, client, "default", "web-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	next := func() int {
+		select {
+		case n := <-ch:
+			return n
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected a count of replicas")
+			return 0
+		}
+	}
+	if n := next(); n != 3 {
+		t.Errorf("expected 3 replicas, got %d", n)
+	}
+	replicas = 2
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+	if _, err := client.AppsV1().StatefulSets("default").Update(ctx, sts, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := next(); n != 2 {
+		t.Errorf("expected 2 replicas, got %d", n)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+// NodeTopology tracks the zone and region of the nodes of a cluster, from
+// their well-known topology labels.
+type NodeTopology struct {
+	lister corelisters.NodeLister
+}
+
+// NewNodeTopology starts watching the nodes of the cluster and waits for the
+// initial list. The informer runs until ctx is cancelled.
+//
+// An error is returned if the nodes cannot be listed, e.g. because the
+// service account lacks the RBAC permissions to do so.
+func NewNodeTopology(ctx context.Context, client kubernetes.Interface) (*NodeTopology, error) {
+	// Check access up front, the informer would otherwise retry forever.
+	if _, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		return nil, err
+	}
+	factory := informers.NewSharedInformerFactory(client, 0)
+	t := &NodeTopology{lister: factory.Core().V1().Nodes().Lister()}
+	factory.Start(ctx.Done())
+	for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("failed to sync %v informer", typ)
+		}
+	}
+	return t, nil
+}
+
+// Topology returns the zone and region of node, "" if unknown. A nil
+// NodeTopology knows none.
+func (t *NodeTopology) Topology(node string) (zone, region string) {
+	if t == nil || node == "" {
+		return "", ""
+	}
+	n, err := t.lister.Get(node)
+	if err != nil {
+		return "", ""
+	}
+	return n.Labels[corev1.LabelTopologyZone], n.Labels[corev1.LabelTopologyRegion]
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func node(name, zone, region string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+		corev1.LabelTopologyZone:   zone,
+		corev1.LabelTopologyRegion: region,
+	}}}
+}
+
+func TestTopology(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hostnames, nodes, zone := []string{"web-0", "web-1", "web-2"}, []string{"node-a", "node-b"}, "eu-west-1c"
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", Labels: map[string]string{discoveryv1.LabelServiceName: "nginx"}},
+		Endpoints: []discoveryv1.Endpoint{
+			{Hostname: &hostnames[0], NodeName: &nodes[0]},
+			{Hostname: &hostnames[1], NodeName: &nodes[1], Zone: &zone},
+			{Hostname: &hostnames[2]},
+		},
+	}
+	p := pod("web-0", "web", "10.0.0.1", true)
+	p.Spec.NodeName = "node-a"
+	client := fake.NewSimpleClientset(
+		node("node-a", "eu-west-1a", "eu-west-1"),
+		node("node-b", "eu-west-1b", "eu-west-1"),
+		slice, p,
+	)
+	nodeTopology, err := NewNodeTopology(ctx, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d, err := NewEndpointSliceDiscoverer(ctx, client, "default", "nginx", "default.svc.cluster.local")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Nodes = nodeTopology
+	peers, err := d.Lookup(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+	expected := []peerfinder.Peer{
+		{Name: "web-0.nginx.default.svc.cluster.local", Zone: "eu-west-1a", Region: "eu-west-1"},
+		{Name: "web-1.nginx.default.svc.cluster.local", Zone: "eu-west-1c", Region: "eu-west-1"},
+		{Name: "web-2.nginx.default.svc.cluster.local"},
+	}
+	if !reflect.DeepEqual(peers, expected) {
+		t.Errorf("expected %v, got %v", expected, peers)
+	}
+
+	pods, err := NewPodDiscoverer(ctx, client, "default", labels.SelectorFromSet(p.Labels))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pods.Nodes = nodeTopology
+	if peers, err = pods.Lookup(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []peerfinder.Peer{{Name: "10.0.0.1", Port: 80, Zone: "eu-west-1a", Region: "eu-west-1"}}; !reflect.DeepEqual(peers, expected) {
+		t.Errorf("expected %v, got %v", expected, peers)
+	}
+}
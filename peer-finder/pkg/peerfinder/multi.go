@@ -0,0 +1,215 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FailurePolicy is how a MultiDiscoverer handles some of its Discoverers
+// failing.
+type FailurePolicy int
+
+const (
+	// FailurePolicyFail fails the lookup if any Discoverer fails.
+	FailurePolicyFail FailurePolicy = iota
+	// FailurePolicyContinue leaves out the peers of the failing Discoverers.
+	FailurePolicyContinue
+	// FailurePolicyStale keeps the peers last found by the failing
+	// Discoverers, for up to the StaleTTL of the MultiDiscoverer, leaving
+	// them out if they never succeeded.
+	FailurePolicyStale
+)
+
+// MultiDiscoverer merges the peers of several Discoverers, e.g. one per
+// cluster a StatefulSet spans. A peer found by several of them is reported
+// as found by the first one.
+type MultiDiscoverer struct {
+	// Policy is how lookups handle some of the Discoverers failing. Lookups
+	// fail whatever the policy if all of them do.
+	Policy FailurePolicy
+	// OnError, if set, is called with the errors of the Discoverers a lookup
+	// tolerated.
+	OnError func(d Discoverer, err error)
+	// StaleTTL is how long FailurePolicyStale keeps the peers of a failing
+	// Discoverer since it last succeeded, forever if 0.
+	StaleTTL time.Duration
+
+	discoverers []Discoverer
+
+	mu sync.Mutex
+	// last holds the peers last found by each Discoverer, nil if it never
+	// succeeded, and lastFound when.
+	last      [][]Peer
+	lastFound []time.Time
+
+	once   sync.Once
+	notify chan struct{}
+}
+
+// NewMultiDiscoverer returns a MultiDiscoverer merging the peers of ds.
+func NewMultiDiscoverer(ds ...Discoverer) *MultiDiscoverer {
+	return &MultiDiscoverer{discoverers: ds, last: make([][]Peer, len(ds)), lastFound: make([]time.Time, len(ds))}
+}
+
+func (d *MultiDiscoverer) String() string {
+	sources := make([]string, 0, len(d.discoverers))
+	for _, d := range d.discoverers {
+		sources = append(sources, Source(d))
+	}
+	return strings.Join(sources, ",")
+}
+
+// Lookup implements Discoverer, looking the Discoverers up concurrently.
+func (d *MultiDiscoverer) Lookup(ctx context.Context) ([]Peer, error) {
+	type result struct {
+		peers []Peer
+		err   error
+	}
+	results := make([]result, len(d.discoverers))
+	var wg sync.WaitGroup
+	for i, disc := range d.discoverers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			peers, err := disc.Lookup(ctx)
+			results[i] = result{peers, err}
+		}()
+	}
+	wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	var errs []error
+	for i, r := range results {
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", Source(d.discoverers[i]), r.err))
+			continue
+		}
+		d.last[i], d.lastFound[i] = r.peers, now
+		if r.peers == nil {
+			d.last[i] = []Peer{}
+		}
+	}
+	if len(errs) > 0 && (d.Policy == FailurePolicyFail || len(errs) == len(results)) {
+		return nil, errors.Join(errs...)
+	}
+	var peers []Peer
+	for i, r := range results {
+		if r.err == nil {
+			peers = append(peers, r.peers...)
+			continue
+		}
+		if d.OnError != nil {
+			d.OnError(d.discoverers[i], r.err)
+		}
+		if d.Policy == FailurePolicyStale && (d.StaleTTL == 0 || now.Sub(d.lastFound[i]) < d.StaleTTL) {
+			peers = append(peers, d.last[i]...)
+		}
+	}
+	return peers, nil
+}
+
+// TTL implements TTLer, returning the lowest known TTL of the Discoverers.
+func (d *MultiDiscoverer) TTL() time.Duration {
+	var ttl time.Duration
+	for _, d := range d.discoverers {
+		if t, ok := d.(TTLer); ok {
+			if v := t.TTL(); v > 0 && (ttl == 0 || v < ttl) {
+				ttl = v
+			}
+		}
+	}
+	return ttl
+}
+
+// Notify implements Notifier, notifying when any of the Discoverers does.
+func (d *MultiDiscoverer) Notify() <-chan struct{} {
+	d.once.Do(func() {
+		d.notify = make(chan struct{}, 1)
+		for _, n := range d.discoverers {
+			n, ok := n.(Notifier)
+			if !ok {
+				continue
+			}
+			// Wrappers such as DomainDiscoverer are Notifiers whose channel
+			// is nil unless the Discoverer they wrap notifies.
+			ch := n.Notify()
+			if ch == nil {
+				continue
+			}
+			go func() {
+				for range ch {
+					select {
+					case d.notify <- struct{}{}:
+					default:
+					}
+				}
+			}()
+		}
+	})
+	return d.notify
+}
+
+// DomainDiscoverer sets the Domain of the peers a Discoverer finds, so that
+// those merged by a MultiDiscoverer can be told apart.
+type DomainDiscoverer struct {
+	Discoverer
+	// Domain is the domain of the service the Discoverer looks up, without
+	// trailing dot, e.g. "default.svc.cluster2.local".
+	Domain string
+	// Priority is the DomainPriority of the peers.
+	Priority int
+}
+
+func (d *DomainDiscoverer) String() string {
+	return Source(d.Discoverer)
+}
+
+// Lookup implements Discoverer.
+func (d *DomainDiscoverer) Lookup(ctx context.Context) ([]Peer, error) {
+	peers, err := d.Discoverer.Lookup(ctx)
+	for i, p := range peers {
+		if p.Domain == "" {
+			peers[i].Domain, peers[i].DomainPriority = d.Domain, d.Priority
+		}
+	}
+	return peers, err
+}
+
+// TTL implements TTLer if the Discoverer does.
+func (d *DomainDiscoverer) TTL() time.Duration {
+	if t, ok := d.Discoverer.(TTLer); ok {
+		return t.TTL()
+	}
+	return 0
+}
+
+// Notify implements Notifier if the Discoverer does, the channel is nil
+// otherwise.
+func (d *DomainDiscoverer) Notify() <-chan struct{} {
+	if n, ok := d.Discoverer.(Notifier); ok {
+		return n.Notify()
+	}
+	return nil
+}
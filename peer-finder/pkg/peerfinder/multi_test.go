@@ -0,0 +1,147 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// staticDiscoverer returns its peers or err, with a TTL and notifications.
+type staticDiscoverer struct {
+	peers  []Peer
+	err    error
+	ttl    time.Duration
+	notify chan struct{}
+}
+
+func (d *staticDiscoverer) Lookup(context.Context) ([]Peer, error) { return d.peers, d.err }
+func (d *staticDiscoverer) TTL() time.Duration                     { return d.ttl }
+func (d *staticDiscoverer) Notify() <-chan struct{}                { return d.notify }
+
+func TestMultiDiscoverer(t *testing.T) {
+	local := &staticDiscoverer{peers: []Peer{{Name: "web-0.nginx.default.svc.cluster.local"}}, ttl: 30 * time.Second, notify: make(chan struct{})}
+	remote := &staticDiscoverer{peers: []Peer{{Name: "web-0.nginx.default.svc.cluster2.local"}}, ttl: 5 * time.Second}
+	d := NewMultiDiscoverer(local, remote)
+	peers, err := d.Lookup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := append(local.peers, remote.peers...); !reflect.DeepEqual(peers, expected) {
+		t.Errorf("expected %v, got %v", expected, peers)
+	}
+	if ttl := d.TTL(); ttl != 5*time.Second {
+		t.Errorf("expected the lowest TTL, got %v", ttl)
+	}
+	// Only local notifies, nothing is left waiting on the nil channel of
+	// remote.
+	before := runtime.NumGoroutine()
+	notify := d.Notify()
+	if n := runtime.NumGoroutine() - before; n > 1 {
+		t.Errorf("expected 1 goroutine forwarding notifications, got %d", n)
+	}
+	local.notify <- struct{}{}
+	select {
+	case <-notify:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected a notification")
+	}
+
+	remote.err = errors.New("unreachable")
+	if _, err := d.Lookup(context.Background()); !errors.Is(err, remote.err) {
+		t.Errorf("expected the error of the failing discoverer, got %v", err)
+	}
+}
+
+func TestMultiDiscovererPolicy(t *testing.T) {
+	unreachable := errors.New("unreachable")
+	localPeer := Peer{Name: "web-0.nginx.default.svc.cluster.local"}
+	remotePeer := Peer{Name: "web-0.nginx.default.svc.cluster2.local"}
+	cases := []struct {
+		policy   FailurePolicy
+		staleTTL time.Duration
+		// neverFound is whether the remote discoverer failed since the start.
+		neverFound bool
+		expected   []Peer
+		valid      bool
+	}{
+		{FailurePolicyFail, 0, false, nil, false},
+		{FailurePolicyContinue, 0, false, []Peer{localPeer}, true},
+		{FailurePolicyStale, 0, false, []Peer{localPeer, remotePeer}, true},
+		{FailurePolicyStale, time.Hour, false, []Peer{localPeer, remotePeer}, true},
+		{FailurePolicyStale, time.Nanosecond, false, []Peer{localPeer}, true},
+		{FailurePolicyStale, 0, true, []Peer{localPeer}, true},
+	}
+	for _, c := range cases {
+		local := &staticDiscoverer{peers: []Peer{localPeer}}
+		remote := &staticDiscoverer{peers: []Peer{remotePeer}}
+		d := NewMultiDiscoverer(local, remote)
+		d.Policy, d.StaleTTL = c.policy, c.staleTTL
+		var tolerated []error
+		d.OnError = func(_ Discoverer, err error) { tolerated = append(tolerated, err) }
+		if c.neverFound {
+			remote.err = unreachable
+		} else if _, err := d.Lookup(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		remote.err = unreachable
+
+		peers, err := d.Lookup(context.Background())
+		if (err == nil) != c.valid {
+			t.Errorf("policy %v: expected valid %v, got %v", c.policy, c.valid, err)
+			continue
+		}
+		if !reflect.DeepEqual(peers, c.expected) {
+			t.Errorf("policy %v: expected %v, got %v", c.policy, c.expected, peers)
+		}
+		if c.valid && (len(tolerated) != 1 || !errors.Is(tolerated[0], unreachable)) {
+			t.Errorf("policy %v: expected the error to be reported, got %v", c.policy, tolerated)
+		}
+
+		// All failing fails whatever the policy.
+		local.err = unreachable
+		if _, err := d.Lookup(context.Background()); err == nil {
+			t.Errorf("policy %v: expected an error when all discoverers fail", c.policy)
+		}
+	}
+}
+
+func TestDomainDiscoverer(t *testing.T) {
+	d := &DomainDiscoverer{
+		Discoverer: &staticDiscoverer{peers: []Peer{
+			{Name: "web-0.nginx.default.svc.cluster2.local"},
+			{Name: "web-1.nginx.default.svc.cluster2.local", Domain: "default.svc.cluster3.local"},
+		}},
+		Domain:   "default.svc.cluster2.local",
+		Priority: 1,
+	}
+	peers, err := d.Lookup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Peer{
+		{Name: "web-0.nginx.default.svc.cluster2.local", Domain: "default.svc.cluster2.local", DomainPriority: 1},
+		{Name: "web-1.nginx.default.svc.cluster2.local", Domain: "default.svc.cluster3.local"},
+	}
+	if !reflect.DeepEqual(peers, expected) {
+		t.Errorf("expected %v, got %v", expected, peers)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Hostname returns the first label of a peer name, e.g. web-0 for
+// web-0.nginx.default.svc.cluster.local.
+func Hostname(peer string) string {
+	if i := strings.Index(peer, "."); i >= 0 {
+		return peer[:i]
+	}
+	return peer
+}
+
+// Ordinal returns the ordinal of a StatefulSet pod from its name or
+// hostname, e.g. 1 for web-1.nginx.default.svc.cluster.local. It returns
+// false if the name does not end with an ordinal.
+func Ordinal(peer string) (int, bool) {
+	host := Hostname(peer)
+	i := strings.LastIndex(host, "-")
+	if i < 0 {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(host[i+1:])
+	if err != nil || ordinal < 0 {
+		return 0, false
+	}
+	return ordinal, true
+}
+
+// SortByOrdinal sorts peers by their ordinal, so that web-2 comes before
+// web-10. Peers without an ordinal come last, sorted by name.
+func SortByOrdinal(peers []string) {
+	sort.SliceStable(peers, func(i, j int) bool {
+		oi, iok := Ordinal(peers[i])
+		oj, jok := Ordinal(peers[j])
+		switch {
+		case iok && jok && oi != oj:
+			return oi < oj
+		case iok != jok:
+			return iok
+		}
+		return peers[i] < peers[j]
+	})
+}
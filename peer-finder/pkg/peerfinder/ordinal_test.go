@@ -0,0 +1,56 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrdinal(t *testing.T) {
+	cases := []struct {
+		peer     string
+		hostname string
+		ordinal  int
+		ok       bool
+	}{
+		{"web-1.nginx.default.svc.cluster.local", "web-1", 1, true},
+		{"my-db-12.db.default.svc.cluster.local", "my-db-12", 12, true},
+		{"zk-0", "zk-0", 0, true},
+		{"web.nginx.default.svc.cluster.local", "web", 0, false},
+		{"web-a.nginx.default.svc.cluster.local", "web-a", 0, false},
+		{"web-", "web-", 0, false},
+	}
+	for _, c := range cases {
+		if got := Hostname(c.peer); got != c.hostname {
+			t.Errorf("%s: expected hostname %q, got %q", c.peer, c.hostname, got)
+		}
+		ordinal, ok := Ordinal(c.peer)
+		if ordinal != c.ordinal || ok != c.ok {
+			t.Errorf("%s: expected ordinal %d (%v), got %d (%v)", c.peer, c.ordinal, c.ok, ordinal, ok)
+		}
+	}
+}
+
+func TestSortByOrdinal(t *testing.T) {
+	peers := []string{"web-10.nginx", "other.nginx", "web-2.nginx", "db-2.nginx", "web-0.nginx"}
+	SortByOrdinal(peers)
+	expected := []string{"web-0.nginx", "db-2.nginx", "web-2.nginx", "web-10.nginx", "other.nginx"}
+	if !reflect.DeepEqual(peers, expected) {
+		t.Errorf("expected %v, got %v", expected, peers)
+	}
+}
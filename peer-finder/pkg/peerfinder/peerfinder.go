@@ -0,0 +1,514 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package peerfinder watches the endpoints of a governing service and reports
+// changes to the set of peers.
+package peerfinder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"k8s.io/contrib/peer-finder/pkg/sets"
+)
+
+// DefaultPollPeriod is the interval between lookups if none is configured.
+const DefaultPollPeriod = 1 * time.Second
+
+// Order is the order of the peers of an Update.
+type Order int
+
+const (
+	// OrderName sorts peers by name.
+	OrderName Order = iota
+	// OrderPriority sorts peers by SRV priority, then by decreasing weight,
+	// then by name.
+	OrderPriority
+	// OrderDomain sorts peers by the priority of the domain they were found
+	// in, e.g. listing those of the local cluster first, then by name.
+	OrderDomain
+)
+
+// Config holds the parameters of a PeerFinder.
+type Config struct {
+	// Service is the governing service responsible for the DNS records of the domain.
+	Service string
+	// Domain is the domain the pod lives in, e.g. "default.svc.cluster.local".
+	Domain string
+	// Hostname is the hostname of this pod.
+	Hostname string
+	// Self is the name this pod is expected to be found under. Defaults to
+	// <Hostname>.<Service>.<Domain>, as published in SRV records.
+	Self string
+	// SelfOptional sends updates even if Self is not among the peers, e.g.
+	// for pods that are only published once ready. Otherwise no update is
+	// sent until Self is found.
+	SelfOptional bool
+	// MinPeers holds the initial update back until at least that many peers
+	// are found, e.g. for a quorum not to be bootstrapped with only part of
+	// its members. Later updates are sent whatever the count of peers.
+	MinPeers int
+	// PollPeriod is the interval between two lookups. Defaults to DefaultPollPeriod.
+	PollPeriod time.Duration
+	// InitialDelay is how long the poll loop waits before the first lookup,
+	// leaving time for the records of a new pod to be published.
+	InitialDelay time.Duration
+	// LookupTimeout bounds the duration of a lookup, if positive.
+	LookupTimeout time.Duration
+	// PollTTL schedules the next lookup once the result of the previous one
+	// expires rather than after PollPeriod, if the Discoverer is a TTLer that
+	// knows. The interval is kept between MinPollPeriod and MaxPollPeriod,
+	// when set.
+	PollTTL bool
+	// AdaptivePoll doubles the interval between lookups, from MinPollPeriod
+	// or else PollPeriod up to MaxPollPeriod, each time the peers are found
+	// unchanged. It is reset as soon as they change or this pod is missing.
+	AdaptivePoll  bool
+	MinPollPeriod time.Duration
+	MaxPollPeriod time.Duration
+	// MaxBackoff, if positive, makes the interval after failed lookups grow
+	// exponentially from PollPeriod up to MaxBackoff, with jitter so that
+	// peers don't retry in lockstep. It is reset by a successful lookup.
+	MaxBackoff time.Duration
+	// Stabilize, if positive, delays reporting a change of the peers after
+	// the initial update until the new set has been found unchanged for that
+	// long, so that the intermediate states of a rolling update are skipped.
+	Stabilize time.Duration
+	// RemovalQuorum holds back a change removing peers unless a majority of
+	// the peers before it are still found, so that a DNS outage listing few
+	// or none of them is not taken for their departure. With QuorumTimeout,
+	// a change held back is applied once it has been found for that long,
+	// e.g. for a legitimate scale-down by more than half.
+	RemovalQuorum bool
+	QuorumTimeout time.Duration
+	// Discoverer is the source of peers. Defaults to an SRVDiscoverer for Service.
+	Discoverer Discoverer
+	// Order is the order of the peers of updates. Defaults to OrderName.
+	Order Order
+	// OnLookup, if set, is called by the poll loop after each lookup with
+	// its error, e.g. to report that the loop is alive. It must not block.
+	OnLookup func(err error)
+	// Logger is where the poll loop logs. Defaults to slog.Default().
+	// Finding the peers unchanged is logged at the debug level.
+	Logger *slog.Logger
+}
+
+// Update is sent each time the set of peers changes.
+type Update struct {
+	// Peers is the list of all known peers, sorted as configured by Config.Order.
+	Peers []string
+	// Added is the list of peers that were not present in the previous update.
+	Added []string
+	// Removed is the list of peers that were present in the previous update.
+	Removed []string
+	// Details holds the known peers by name.
+	Details map[string]Peer
+	// Self is the fully qualified name of this pod.
+	Self string
+	// Initial is true for the first update, the one sent once self has been
+	// found, or after the first lookup if Config.SelfOptional is set, and at
+	// least Config.MinPeers peers are.
+	Initial bool
+	// Time is when the peers were looked up.
+	Time time.Time
+	// Source describes the Discoverer the peers were found with.
+	Source string
+}
+
+// PeerFinder periodically looks up the peers of a service.
+type PeerFinder struct {
+	cfg     Config
+	self    string
+	updates chan Update
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	active time.Time
+}
+
+// New creates a PeerFinder from the given config.
+func New(cfg Config) (*PeerFinder, error) {
+	if cfg.Service == "" || cfg.Domain == "" || cfg.Hostname == "" {
+		return nil, fmt.Errorf("service, domain and hostname are required")
+	}
+	if cfg.PollPeriod <= 0 {
+		cfg.PollPeriod = DefaultPollPeriod
+	}
+	if cfg.Discoverer == nil {
+		cfg.Discoverer = NewSRVDiscoverer(cfg.Service)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	self := cfg.Self
+	if self == "" {
+		self = strings.Join([]string{cfg.Hostname, cfg.Service, cfg.Domain}, ".")
+	}
+	return &PeerFinder{
+		cfg:     cfg,
+		self:    self,
+		updates: make(chan Update),
+	}, nil
+}
+
+// Self returns the fully qualified name this PeerFinder expects to find itself under.
+func (pf *PeerFinder) Self() string {
+	return pf.self
+}
+
+// Domain returns the domain the peers are looked up in.
+func (pf *PeerFinder) Domain() string {
+	return pf.cfg.Domain
+}
+
+// Service returns the fully qualified name of the governing service.
+func (pf *PeerFinder) Service() string {
+	return pf.cfg.Service + "." + pf.cfg.Domain
+}
+
+// Lookup performs a single lookup. All peers of the returned Update are
+// reported as added.
+func (pf *PeerFinder) Lookup(ctx context.Context) (Update, error) {
+	peers, err := pf.lookup(ctx)
+	if err != nil {
+		return Update{}, err
+	}
+	return pf.update(nil, byName(peers), true), nil
+}
+
+// lookup looks up the peers within the configured timeout.
+func (pf *PeerFinder) lookup(ctx context.Context) ([]Peer, error) {
+	if pf.cfg.LookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pf.cfg.LookupTimeout)
+		defer cancel()
+	}
+	return pf.cfg.Discoverer.Lookup(ctx)
+}
+
+// byName indexes peers by name, keeping the first peer of each name.
+func byName(peers []Peer) map[string]Peer {
+	m := make(map[string]Peer, len(peers))
+	for _, p := range peers {
+		if _, ok := m[p.Name]; !ok {
+			m[p.Name] = p
+		}
+	}
+	return m
+}
+
+// names returns the set of names of peers.
+func names(peers map[string]Peer) sets.String {
+	s := sets.NewString()
+	for name := range peers {
+		s.Insert(name)
+	}
+	return s
+}
+
+// update builds the Update going from the old to the new set of peers.
+func (pf *PeerFinder) update(old, new map[string]Peer, initial bool) Update {
+	newNames := names(new)
+	added, removed := sets.Diff(names(old), newNames)
+	peers := newNames.List()
+	if pf.cfg.Order == OrderPriority {
+		sortByPriority(peers, new)
+		sortByPriority(added, new)
+		sortByPriority(removed, old)
+	} else if pf.cfg.Order == OrderDomain {
+		sortByDomain(peers, new)
+		sortByDomain(added, new)
+		sortByDomain(removed, old)
+	}
+	return Update{
+		Peers:   peers,
+		Added:   added,
+		Removed: removed,
+		Details: new,
+		Self:    pf.self,
+		Initial: initial,
+		Time:    time.Now(),
+		Source:  Source(pf.cfg.Discoverer),
+	}
+}
+
+// keepsQuorum returns whether a majority of the peers of old are among those
+// of new, or all of them.
+func keepsQuorum(old, new map[string]Peer) bool {
+	kept := 0
+	for name := range old {
+		if _, ok := new[name]; ok {
+			kept++
+		}
+	}
+	return kept == len(old) || kept > len(old)/2
+}
+
+// sortByPriority sorts the names of peers, which must be sorted by name, by
+// SRV priority and weight.
+func sortByPriority(names []string, peers map[string]Peer) {
+	sort.SliceStable(names, func(i, j int) bool {
+		a, b := peers[names[i]], peers[names[j]]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.Weight > b.Weight
+	})
+}
+
+// sortByDomain sorts the names of peers, which must be sorted by name, by
+// domain priority.
+func sortByDomain(names []string, peers map[string]Peer) {
+	sort.SliceStable(names, func(i, j int) bool {
+		return peers[names[i]].DomainPriority < peers[names[j]].DomainPriority
+	})
+}
+
+// Updates returns the channel on which peer set changes are delivered. The
+// channel is closed once the PeerFinder stops.
+//
+// Lookups go on while an update waits to be received. If the peers change
+// again meanwhile, the waiting update is replaced by one going from the
+// peers of the last received update to the latest ones, so that a slow
+// receiver only gets the latest changes.
+func (pf *PeerFinder) Updates() <-chan Update {
+	return pf.updates
+}
+
+// Start launches the poll loop in the background. It runs until ctx is
+// cancelled or Stop is called.
+func (pf *PeerFinder) Start(ctx context.Context) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	if pf.done != nil {
+		return
+	}
+	ctx, pf.cancel = context.WithCancel(ctx)
+	pf.done = make(chan struct{})
+	pf.active = time.Now()
+	go func() {
+		defer close(pf.done)
+		defer close(pf.updates)
+		pf.run(ctx)
+	}()
+}
+
+// Stop stops the poll loop and waits for it to exit.
+func (pf *PeerFinder) Stop() {
+	pf.mu.Lock()
+	cancel, done := pf.cancel, pf.done
+	pf.mu.Unlock()
+	if done == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// LastActive returns when the poll loop last looked up the peers, or when it
+// was started if it hasn't yet. It is the zero time if the loop isn't
+// running.
+func (pf *PeerFinder) LastActive() time.Time {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	if pf.done == nil {
+		return time.Time{}
+	}
+	select {
+	case <-pf.done:
+		return time.Time{}
+	default:
+		return pf.active
+	}
+}
+
+// nextPoll returns the interval until the next lookup following a
+// successful one, the peers having been found unchanged steady times in a
+// row.
+func (pf *PeerFinder) nextPoll(steady int) time.Duration {
+	var period time.Duration
+	if t, ok := pf.cfg.Discoverer.(TTLer); pf.cfg.PollTTL && ok && t.TTL() > 0 {
+		period = t.TTL()
+	} else if pf.cfg.AdaptivePoll && pf.cfg.MaxPollPeriod > 0 {
+		period = pf.cfg.PollPeriod
+		if pf.cfg.MinPollPeriod > 0 {
+			period = pf.cfg.MinPollPeriod
+		}
+		for i := 0; i < steady && period < pf.cfg.MaxPollPeriod; i++ {
+			period *= 2
+		}
+	} else {
+		return pf.cfg.PollPeriod
+	}
+	if pf.cfg.MinPollPeriod > 0 && period < pf.cfg.MinPollPeriod {
+		period = pf.cfg.MinPollPeriod
+	}
+	if pf.cfg.MaxPollPeriod > 0 && period > pf.cfg.MaxPollPeriod {
+		period = pf.cfg.MaxPollPeriod
+	}
+	return period
+}
+
+// backoff returns the interval until the next lookup after the given count
+// of consecutive failures.
+func (pf *PeerFinder) backoff(failures int) time.Duration {
+	if pf.cfg.MaxBackoff <= 0 {
+		return pf.cfg.PollPeriod
+	}
+	d := pf.cfg.PollPeriod
+	for i := 1; i < failures && d < pf.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, pf.cfg.MaxBackoff)
+	// Keep at least half of the interval, a random part of the rest.
+	return d/2 + rand.N(d/2+1)
+}
+
+func (pf *PeerFinder) run(ctx context.Context) {
+	peers := map[string]Peer{}
+	initial := true
+	failures := 0
+	// steady counts the lookups in a row that found the peers unchanged.
+	steady := 0
+	// pending is the changed set of peers waiting to be stable since settling.
+	var pending map[string]Peer
+	var settling time.Time
+	// holding is when the change held back for lack of a quorum was first
+	// found, zero if none is.
+	var holding time.Time
+	// next is the update waiting to be received, out being nil if there is
+	// none, and delivered the peers of the last received update.
+	var next Update
+	var out chan Update
+	var delivered map[string]Peer
+	sent := false
+	var notify <-chan struct{}
+	if n, ok := pf.cfg.Discoverer.(Notifier); ok {
+		notify = n.Notify()
+	}
+	if pf.cfg.InitialDelay > 0 {
+		select {
+		case <-time.After(pf.cfg.InitialDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+	for {
+		pctx, span := tracer().Start(ctx, "Poll", trace.WithAttributes(attribute.String("peerfinder.source", Source(pf.cfg.Discoverer))))
+		found, err := pf.lookup(pctx)
+		pf.mu.Lock()
+		pf.active = time.Now()
+		pf.mu.Unlock()
+		if pf.cfg.OnLookup != nil {
+			pf.cfg.OnLookup(err)
+		}
+		newPeers := byName(found)
+		_, selfOK := newPeers[pf.self]
+		selfOK = selfOK || pf.cfg.SelfOptional
+		if err == nil && selfOK && reflect.DeepEqual(newPeers, peers) {
+			steady++
+		} else {
+			steady = 0
+		}
+		span.SetAttributes(attribute.Int("peerfinder.peers", len(newPeers)), attribute.Bool("peerfinder.self_found", selfOK))
+		// Only a lookup keeping the quorum ends the hold, not a failed one,
+		// for a flapping backend not to restart QuorumTimeout.
+		lost := false
+		if err == nil && selfOK && !initial && pf.cfg.RemovalQuorum {
+			lost = !keepsQuorum(peers, newPeers)
+			if !lost {
+				holding = time.Time{}
+			} else if holding.IsZero() {
+				holding = time.Now()
+			}
+		}
+		if lost && pf.cfg.QuorumTimeout > 0 && time.Since(holding) >= pf.cfg.QuorumTimeout {
+			lost = false
+		}
+		logger := pf.cfg.Logger
+		if err != nil {
+			failures++
+			logger.Warn("Failed to look up peers", "err", err, "failures", failures)
+		} else if !selfOK {
+			pending = nil
+			logger.Info("Have not found myself among the peers yet", "self", pf.self, "peers", names(newPeers).List())
+		} else if !initial && reflect.DeepEqual(newPeers, peers) {
+			pending = nil
+			logger.Debug("Peers unchanged", "peers", names(newPeers).List())
+		} else if lost {
+			pending = nil
+			logger.Warn("Most peers are gone, holding back their removal", "was", names(peers).List(), "now", names(newPeers).List())
+		} else if initial && len(newPeers) < pf.cfg.MinPeers {
+			logger.Info("Waiting for more peers", "min", pf.cfg.MinPeers, "found", len(newPeers), "peers", names(newPeers).List())
+		} else if stabilize := !initial && pf.cfg.Stabilize > 0; stabilize && !reflect.DeepEqual(newPeers, pending) {
+			logger.Info("Peers changed, waiting for them to be stable", "stabilize", pf.cfg.Stabilize, "peers", names(newPeers).List())
+			pending, settling = newPeers, time.Now()
+		} else if stabilize && time.Since(settling) < pf.cfg.Stabilize {
+			// Still settling.
+		} else {
+			pending = nil
+			logger.Info("Peers updated", "was", names(peers).List(), "now", names(newPeers).List())
+			span.AddEvent("update")
+			if out != nil {
+				logger.Debug("Previous update not handled yet, replacing it")
+			}
+			if sent && reflect.DeepEqual(newPeers, delivered) {
+				out = nil
+			} else {
+				next, out = pf.update(delivered, newPeers, !sent), pf.updates
+			}
+			peers = newPeers
+			initial = false
+		}
+		endSpan(span, err)
+		period := pf.backoff(failures)
+		if err == nil {
+			failures = 0
+			period = pf.nextPoll(steady)
+		}
+		if err == nil && pending != nil {
+			// Failed lookups back off, even once the change settled.
+			period = min(period, pf.cfg.Stabilize-time.Since(settling))
+		}
+		timer := time.NewTimer(period)
+	wait:
+		for {
+			select {
+			case out <- next:
+				out, delivered, sent = nil, next.Details, true
+			case <-timer.C:
+				break wait
+			case <-notify:
+				timer.Stop()
+				break wait
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}
+}
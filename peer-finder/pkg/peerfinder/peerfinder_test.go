@@ -0,0 +1,440 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupOrder(t *testing.T) {
+	found := []Peer{
+		{Name: "a", Priority: 10, Weight: 5, DomainPriority: 1},
+		{Name: "b", Priority: 0, Weight: 1},
+		{Name: "c", Priority: 0, Weight: 5},
+		{Name: "d", Priority: 10, Weight: 5, DomainPriority: 2},
+	}
+	cases := []struct {
+		order    Order
+		expected []string
+	}{
+		{OrderName, []string{"a", "b", "c", "d"}},
+		{OrderPriority, []string{"c", "b", "a", "d"}},
+		{OrderDomain, []string{"b", "c", "a", "d"}},
+	}
+	for _, c := range cases {
+		pf, err := New(Config{
+			Service:    "svc",
+			Domain:     "default.svc.cluster.local",
+			Hostname:   "a",
+			Order:      c.order,
+			Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) { return found, nil }),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		u, err := pf.Lookup(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(u.Peers, c.expected) {
+			t.Errorf("order %v: expected peers %v, got %v", c.order, c.expected, u.Peers)
+		}
+		if !reflect.DeepEqual(u.Added, c.expected) {
+			t.Errorf("order %v: expected added %v, got %v", c.order, c.expected, u.Added)
+		}
+	}
+}
+
+func TestLookupTimeout(t *testing.T) {
+	pf, err := New(Config{
+		Service:       "svc",
+		Domain:        "default.svc.cluster.local",
+		Hostname:      "a",
+		LookupTimeout: 10 * time.Millisecond,
+		Discoverer: DiscovererFunc(func(ctx context.Context) ([]Peer, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := pf.Lookup(context.Background()); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	pf, err := New(Config{
+		Service:    "svc",
+		Domain:     "default.svc.cluster.local",
+		Hostname:   "a",
+		PollPeriod: time.Second,
+		MaxBackoff: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		failures int
+		max      time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 10; i++ {
+			if d := pf.backoff(c.failures); d < c.max/2 || d > c.max {
+				t.Errorf("%d failures: expected a backoff between %v and %v, got %v", c.failures, c.max/2, c.max, d)
+			}
+		}
+	}
+}
+
+func TestStabilize(t *testing.T) {
+	lookups := [][]Peer{
+		{{Name: "a"}},
+		{{Name: "a"}, {Name: "b"}},
+		{{Name: "a"}, {Name: "c"}},
+	}
+	var i int
+	pf, err := New(Config{
+		Service:    "svc",
+		Domain:     "default.svc.cluster.local",
+		Hostname:   "a",
+		Self:       "a",
+		PollPeriod: time.Millisecond,
+		Stabilize:  50 * time.Millisecond,
+		Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) {
+			peers := lookups[min(i, len(lookups)-1)]
+			i++
+			return peers, nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pf.Start(ctx)
+	defer pf.Stop()
+	for _, expected := range [][]string{{"a"}, {"a", "c"}} {
+		select {
+		case u := <-pf.Updates():
+			if !reflect.DeepEqual(u.Peers, expected) {
+				t.Errorf("expected peers %v, got %v", expected, u.Peers)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %v", expected)
+		}
+	}
+}
+
+func TestStabilizeBackoff(t *testing.T) {
+	var lookups atomic.Int32
+	pf, err := New(Config{
+		Service:    "svc",
+		Domain:     "default.svc.cluster.local",
+		Hostname:   "a",
+		Self:       "a",
+		PollPeriod: time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		Stabilize:  10 * time.Millisecond,
+		Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) {
+			// The second lookup finds a change, those after fail while it
+			// settles.
+			switch lookups.Add(1) {
+			case 1:
+				return []Peer{{Name: "a"}}, nil
+			case 2:
+				return []Peer{{Name: "a"}, {Name: "b"}}, nil
+			}
+			return nil, errors.New("lookup failed")
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pf.Start(ctx)
+	defer pf.Stop()
+	<-pf.Updates()
+	time.Sleep(300 * time.Millisecond)
+	// Backing off from 1ms up to 50ms takes a couple dozen lookups at most.
+	if n := lookups.Load(); n > 40 {
+		t.Errorf("expected failed lookups to back off while a change settles, got %d lookups", n)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	lookups := [][]Peer{
+		{{Name: "a"}},
+		{{Name: "a"}, {Name: "b"}},
+		{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+	}
+	var i atomic.Int32
+	pf, err := New(Config{
+		Service:    "svc",
+		Domain:     "default.svc.cluster.local",
+		Hostname:   "a",
+		Self:       "a",
+		PollPeriod: time.Millisecond,
+		Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) {
+			return lookups[min(int(i.Add(1))-1, len(lookups)-1)], nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pf.Start(ctx)
+	defer pf.Stop()
+	if u := <-pf.Updates(); !reflect.DeepEqual(u.Peers, []string{"a"}) {
+		t.Errorf("expected peers [a], got %v", u.Peers)
+	}
+	// Both changes are found before the next update is received.
+	for i.Load() <= int32(len(lookups)) {
+		time.Sleep(time.Millisecond)
+	}
+	u := <-pf.Updates()
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(u.Peers, expected) {
+		t.Errorf("expected peers %v, got %v", expected, u.Peers)
+	}
+	if expected := []string{"b", "c"}; !reflect.DeepEqual(u.Added, expected) {
+		t.Errorf("expected added %v, got %v", expected, u.Added)
+	}
+}
+
+func TestAdaptivePoll(t *testing.T) {
+	pf, err := New(Config{
+		Service:       "svc",
+		Domain:        "default.svc.cluster.local",
+		Hostname:      "a",
+		AdaptivePoll:  true,
+		MinPollPeriod: time.Second,
+		MaxPollPeriod: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for steady, expected := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		if d := pf.nextPoll(steady); d != expected*time.Second {
+			t.Errorf("steady %d: expected %v, got %v", steady, expected*time.Second, d)
+		}
+	}
+}
+
+func TestSelfOptional(t *testing.T) {
+	for _, found := range [][]Peer{nil, {{Name: "b"}}} {
+		pf, err := New(Config{
+			Service:      "svc",
+			Domain:       "default.svc.cluster.local",
+			Hostname:     "a",
+			SelfOptional: true,
+			Discoverer:   DiscovererFunc(func(context.Context) ([]Peer, error) { return found, nil }),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		pf.Start(ctx)
+		select {
+		case u := <-pf.Updates():
+			if !u.Initial || len(u.Peers) != len(found) {
+				t.Errorf("%v: unexpected update %+v", found, u)
+			}
+		case <-ctx.Done():
+			t.Errorf("%v: timed out waiting for an update", found)
+		}
+		pf.Stop()
+		cancel()
+	}
+}
+
+func TestOnLookup(t *testing.T) {
+	lookups := make(chan error, 1)
+	pf, err := New(Config{
+		Service:    "svc",
+		Domain:     "default.svc.cluster.local",
+		Hostname:   "a",
+		Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) { return nil, errors.New("timeout") }),
+		OnLookup: func(err error) {
+			select {
+			case lookups <- err:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pf.Start(context.Background())
+	defer pf.Stop()
+	select {
+	case err := <-lookups:
+		if err == nil {
+			t.Errorf("expected the error of the lookup")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for a lookup")
+	}
+}
+
+func TestMinPeers(t *testing.T) {
+	lookups := [][]Peer{
+		{{Name: "a"}},
+		{{Name: "a"}, {Name: "b"}},
+		{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+	}
+	var i int
+	pf, err := New(Config{
+		Service:    "svc",
+		Domain:     "default.svc.cluster.local",
+		Hostname:   "a",
+		Self:       "a",
+		PollPeriod: time.Millisecond,
+		MinPeers:   3,
+		Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) {
+			peers := lookups[min(i, len(lookups)-1)]
+			i++
+			return peers, nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pf.Start(ctx)
+	defer pf.Stop()
+	select {
+	case u := <-pf.Updates():
+		if expected := []string{"a", "b", "c"}; !u.Initial || !reflect.DeepEqual(u.Peers, expected) {
+			t.Errorf("expected an initial update with peers %v, got %+v", expected, u)
+		}
+	case <-ctx.Done():
+		t.Fatalf("timed out waiting for an update")
+	}
+}
+
+func TestRemovalQuorum(t *testing.T) {
+	all := []Peer{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}
+	cases := []struct {
+		name     string
+		timeout  time.Duration
+		lookups  [][]Peer
+		expected [][]string
+	}{
+		{
+			name:     "outage",
+			lookups:  [][]Peer{all, {{Name: "a"}}, {{Name: "a"}}, {{Name: "a"}, {Name: "b"}, {Name: "c"}}},
+			expected: [][]string{{"a", "b", "c", "d"}, {"a", "b", "c"}},
+		},
+		{
+			name:     "timeout",
+			timeout:  20 * time.Millisecond,
+			lookups:  [][]Peer{all, {{Name: "a"}}},
+			expected: [][]string{{"a", "b", "c", "d"}, {"a"}},
+		},
+	}
+	for _, c := range cases {
+		var i int
+		pf, err := New(Config{
+			Service:       "svc",
+			Domain:        "default.svc.cluster.local",
+			Hostname:      "a",
+			Self:          "a",
+			PollPeriod:    time.Millisecond,
+			RemovalQuorum: true,
+			QuorumTimeout: c.timeout,
+			Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) {
+				peers := c.lookups[min(i, len(c.lookups)-1)]
+				i++
+				return peers, nil
+			}),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		pf.Start(ctx)
+		for _, expected := range c.expected {
+			select {
+			case u := <-pf.Updates():
+				if !reflect.DeepEqual(u.Peers, expected) {
+					t.Errorf("%s: expected peers %v, got %v", c.name, expected, u.Peers)
+				}
+			case <-ctx.Done():
+				t.Fatalf("%s: timed out waiting for %v", c.name, expected)
+			}
+		}
+		pf.Stop()
+		cancel()
+	}
+}
+
+func TestRemovalQuorumFlapping(t *testing.T) {
+	var lookups atomic.Int32
+	pf, err := New(Config{
+		Service:       "svc",
+		Domain:        "default.svc.cluster.local",
+		Hostname:      "a",
+		Self:          "a",
+		PollPeriod:    time.Millisecond,
+		RemovalQuorum: true,
+		QuorumTimeout: 20 * time.Millisecond,
+		Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) {
+			switch n := lookups.Add(1); {
+			case n == 1:
+				return []Peer{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}, nil
+			case n%2 == 0:
+				return []Peer{{Name: "a"}}, nil
+			default:
+				return nil, errors.New("timeout")
+			}
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pf.Start(ctx)
+	defer pf.Stop()
+	// The failed lookups in between don't hold the removal back forever.
+	for _, expected := range [][]string{{"a", "b", "c", "d"}, {"a"}} {
+		select {
+		case u := <-pf.Updates():
+			if !reflect.DeepEqual(u.Peers, expected) {
+				t.Errorf("expected peers %v, got %v", expected, u.Peers)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %v", expected)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultProbeTimeout bounds a probe if ProbeDiscoverer.Timeout is not set.
+const DefaultProbeTimeout = time.Second
+
+// ProbeUnknown is the ProbeStatus of the peers reported before their first
+// probe completed, the lookup being done first.
+const ProbeUnknown = "UNKNOWN"
+
+// DefaultProbeConcurrency is how many peers are probed at once if
+// ProbeDiscoverer.Concurrency is not set.
+const DefaultProbeConcurrency = 16
+
+// Prober checks whether a peer is reachable.
+type Prober interface {
+	// Probe returns an error if p is unreachable, and the status it
+	// reported, e.g. the serving status of the gRPC health service, "" if
+	// none.
+	Probe(ctx context.Context, p Peer) (status string, err error)
+}
+
+// TCPProber probes peers by connecting to Port, the connection being closed
+// right away.
+type TCPProber struct {
+	Port int
+}
+
+// Probe implements Prober, with no status.
+func (t TCPProber) Probe(ctx context.Context, p Peer) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(p.Name, strconv.Itoa(t.Port)))
+	if err != nil {
+		return "", err
+	}
+	return "", conn.Close()
+}
+
+// ProbeDiscoverer probes the peers of a Discoverer before reporting them,
+// leaving out those failing, or reporting them as Unreachable with Flag,
+// along with the ProbeStatus of each peer probed.
+// DNS lists the peers of a failed node until the node is found gone, which
+// a probe tells sooner. Self is always reported, without a probe.
+type ProbeDiscoverer struct {
+	Discoverer
+	Prober Prober
+	// Self is the name this pod is found under, set once known.
+	Self string
+	// Timeout bounds each probe, DefaultProbeTimeout if 0.
+	Timeout time.Duration
+	// Concurrency is the count of workers probing the peers, bounding how
+	// many are probed at once, DefaultProbeConcurrency if 0.
+	Concurrency int
+	// Interval is how long the result of the probe of a peer is reused for
+	// before probing it again, e.g. for lookups notified often not to probe
+	// every peer each time. Peers are probed at each lookup if 0.
+	Interval time.Duration
+	// Flag reports the peers failing their probe as Unreachable instead of
+	// leaving them out.
+	Flag bool
+	// OnFailure, if set, is called for each probe failing, with the peer and
+	// its error, not for the results reused. It may be called concurrently.
+	OnFailure func(p Peer, err error)
+
+	mu sync.Mutex
+	// results are the last results of the probes, by peer.
+	results map[string]probeResult
+}
+
+func (d *ProbeDiscoverer) String() string {
+	return Source(d.Discoverer)
+}
+
+// probeResult is the result of the probe of a peer, at being zero if it was
+// never probed.
+type probeResult struct {
+	status string
+	err    error
+	at     time.Time
+}
+
+// Lookup implements Discoverer, probing the peers concurrently. The peers
+// not probed again once ctx is done keep the result of their last probe, or
+// are reported with ProbeUnknown if they were never probed, the others
+// being probed first by the next lookup.
+func (d *ProbeDiscoverer) Lookup(ctx context.Context) ([]Peer, error) {
+	peers, err := d.Discoverer.Lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	results := make([]probeResult, len(peers))
+	var due []int
+	d.mu.Lock()
+	for i, p := range peers {
+		if p.Name == d.Self {
+			continue
+		}
+		r, ok := d.results[p.Name]
+		results[i] = r
+		if !ok || d.Interval == 0 || now.Sub(r.at) >= d.Interval {
+			due = append(due, i)
+		}
+	}
+	d.mu.Unlock()
+	// The peers probed the longest ago go first, so that all of them are
+	// probed in turn when a lookup cannot probe them all.
+	sort.SliceStable(due, func(a, b int) bool {
+		return results[due[a]].at.Before(results[due[b]].at)
+	})
+	d.probe(ctx, peers, due, results)
+	d.mu.Lock()
+	d.results = make(map[string]probeResult, len(peers))
+	for i, p := range peers {
+		if !results[i].at.IsZero() {
+			d.results[p.Name] = results[i]
+		}
+	}
+	d.mu.Unlock()
+
+	var reported []Peer
+	for i, p := range peers {
+		r := results[i]
+		switch {
+		case p.Name == d.Self:
+		case r.at.IsZero():
+			p.ProbeStatus = ProbeUnknown
+		case r.err == nil:
+			p.ProbeStatus = r.status
+		case d.Flag:
+			p.ProbeStatus = r.status
+			p.Unreachable = true
+		default:
+			continue
+		}
+		reported = append(reported, p)
+	}
+	return reported, nil
+}
+
+// probe probes the peers of due, indexes of peers, with at most Concurrency
+// workers until ctx is done, storing their results in results.
+func (d *ProbeDiscoverer) probe(ctx context.Context, peers []Peer, due []int, results []probeResult) {
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+	concurrency := d.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultProbeConcurrency
+	}
+	forEach(ctx, concurrency, due, func(i int) {
+		pctx, cancel := context.WithTimeout(ctx, timeout)
+		status, err := d.Prober.Probe(pctx, peers[i])
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			// Cut short by the lookup, the last result stands.
+			return
+		}
+		results[i] = probeResult{status, err, time.Now()}
+		if err != nil && d.OnFailure != nil {
+			d.OnFailure(peers[i], err)
+		}
+	})
+}
+
+// forEach calls f with each of indexes from at most concurrency workers,
+// no longer handing them out once ctx is done.
+func forEach(ctx context.Context, concurrency int, indexes []int, f func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(indexes)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() == nil {
+					f(i)
+				}
+			}
+		}()
+	}
+feed:
+	for _, i := range indexes {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// TTL implements TTLer if the Discoverer does.
+func (d *ProbeDiscoverer) TTL() time.Duration {
+	if t, ok := d.Discoverer.(TTLer); ok {
+		return t.TTL()
+	}
+	return 0
+}
+
+// Notify implements Notifier if the Discoverer does, the channel is nil
+// otherwise.
+func (d *ProbeDiscoverer) Notify() <-chan struct{} {
+	if n, ok := d.Discoverer.(Notifier); ok {
+		return n.Notify()
+	}
+	return nil
+}
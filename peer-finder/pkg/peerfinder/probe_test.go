@@ -0,0 +1,232 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbeDiscoverer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := l.Addr().(*net.TCPAddr).Port
+	// Nothing listens on 127.0.0.2, and self is never probed.
+	peers := []Peer{{Name: "127.0.0.1"}, {Name: "127.0.0.2"}, {Name: "self.invalid"}}
+	cases := []struct {
+		name     string
+		flag     bool
+		expected []Peer
+	}{
+		{"remove", false, []Peer{{Name: "127.0.0.1"}, {Name: "self.invalid"}}},
+		{"flag", true, []Peer{{Name: "127.0.0.1"}, {Name: "127.0.0.2", Unreachable: true}, {Name: "self.invalid"}}},
+	}
+	for _, c := range cases {
+		var mu sync.Mutex
+		var failed []string
+		d := &ProbeDiscoverer{
+			Discoverer:  DiscovererFunc(func(context.Context) ([]Peer, error) { return peers, nil }),
+			Prober:      TCPProber{Port: port},
+			Self:        "self.invalid",
+			Concurrency: 1,
+			Flag:        c.flag,
+			OnFailure: func(p Peer, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = append(failed, p.Name)
+			},
+		}
+		found, err := d.Lookup(context.Background())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(found, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, found)
+		}
+		if !reflect.DeepEqual(failed, []string{"127.0.0.2"}) {
+			t.Errorf("%s: expected 127.0.0.2 to be reported failing, got %v", c.name, failed)
+		}
+	}
+}
+
+func TestTCPProber(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	if _, err := (TCPProber{Port: port}).Probe(context.Background(), Peer{Name: "127.0.0.1"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	l.Close()
+	if _, err := (TCPProber{Port: port}).Probe(context.Background(), Peer{Name: "127.0.0.1"}); err == nil {
+		t.Errorf("expected the probe of a closed port to fail")
+	}
+}
+
+// statusProber reports the status of each peer, failing unless SERVING.
+type statusProber map[string]string
+
+func (s statusProber) Probe(_ context.Context, p Peer) (string, error) {
+	if s[p.Name] != "SERVING" {
+		return s[p.Name], errors.New("not serving")
+	}
+	return s[p.Name], nil
+}
+
+func TestProbeDiscovererStatus(t *testing.T) {
+	d := &ProbeDiscoverer{
+		Discoverer: DiscovererFunc(func(context.Context) ([]Peer, error) { return []Peer{{Name: "a"}, {Name: "b"}}, nil }),
+		Prober:     statusProber{"a": "SERVING", "b": "NOT_SERVING"},
+		Flag:       true,
+	}
+	found, err := d.Lookup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Peer{{Name: "a", ProbeStatus: "SERVING"}, {Name: "b", ProbeStatus: "NOT_SERVING", Unreachable: true}}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+}
+
+// countingProber counts the probes, and the most running at once.
+type countingProber struct {
+	probes, running, most atomic.Int32
+}
+
+func (c *countingProber) Probe(context.Context, Peer) (string, error) {
+	c.probes.Add(1)
+	n := c.running.Add(1)
+	defer c.running.Add(-1)
+	for {
+		m := c.most.Load()
+		if n <= m || c.most.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return "", nil
+}
+
+func TestProbeDiscovererPool(t *testing.T) {
+	peers := make([]Peer, 50)
+	for i := range peers {
+		peers[i] = Peer{Name: strconv.Itoa(i)}
+	}
+	prober := &countingProber{}
+	d := &ProbeDiscoverer{
+		Discoverer:  DiscovererFunc(func(context.Context) ([]Peer, error) { return peers, nil }),
+		Prober:      prober,
+		Concurrency: 4,
+		Interval:    time.Hour,
+	}
+	for range 2 {
+		found, err := d.Lookup(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(found) != len(peers) {
+			t.Errorf("expected %d peers, got %d", len(peers), len(found))
+		}
+	}
+	if n := prober.most.Load(); n > 4 {
+		t.Errorf("expected at most 4 probes at once, got %d", n)
+	}
+	if n := prober.probes.Load(); n != int32(len(peers)) {
+		t.Errorf("expected the results to be reused within the interval, got %d probes", n)
+	}
+}
+
+// slowProber probes the peers, the blocked ones until the probe is done.
+type slowProber struct {
+	mu      sync.Mutex
+	blocked map[string]bool
+	probed  []string
+}
+
+func (s *slowProber) Probe(ctx context.Context, p Peer) (string, error) {
+	s.mu.Lock()
+	blocked := s.blocked[p.Name]
+	s.mu.Unlock()
+	if blocked {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probed = append(s.probed, p.Name)
+	return "", nil
+}
+
+func TestProbeDiscovererDeadline(t *testing.T) {
+	peers := []Peer{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	prober := &slowProber{blocked: map[string]bool{"b": true}}
+	d := &ProbeDiscoverer{
+		Discoverer:  DiscovererFunc(func(context.Context) ([]Peer, error) { return peers, nil }),
+		Prober:      prober,
+		Timeout:     time.Minute,
+		Concurrency: 1,
+		Interval:    time.Hour,
+		OnFailure:   func(p Peer, err error) { t.Errorf("unexpected failure of %s: %v", p.Name, err) },
+	}
+	// The lookup is done while b is probed, c not being probed.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	found, err := d.Lookup(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Peer{{Name: "a"}, {Name: "b", ProbeStatus: ProbeUnknown}, {Name: "c", ProbeStatus: ProbeUnknown}}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+
+	// The next lookup probes those it could not, the result of a being kept.
+	prober.mu.Lock()
+	prober.blocked = nil
+	prober.mu.Unlock()
+	found, err = d.Lookup(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(found, peers) {
+		t.Errorf("expected %v, got %v", peers, found)
+	}
+	if !reflect.DeepEqual(prober.probed, []string{"a", "b", "c"}) {
+		t.Errorf("expected each peer to be probed once, got %v", prober.probed)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultResolvConfPath is where the resolver configuration usually is.
+const DefaultResolvConfPath = "/etc/resolv.conf"
+
+// maxNdots is the highest ndots option honored by resolvers.
+const maxNdots = 15
+
+// ResolvConf is a resolver configuration, as described in resolv.conf(5).
+type ResolvConf struct {
+	// Nameservers are the addresses of the nameservers, without port.
+	Nameservers []string
+	// Search is the search list of domains, set by the last search or
+	// domain line.
+	Search []string
+	// Ndots is the number of dots a name needs to be looked up as is first.
+	Ndots int
+	// Options are the options other than ndots, e.g. "timeout:2" or "rotate".
+	Options []string
+}
+
+// ReadResolvConf reads and parses the resolver configuration at path.
+func ReadResolvConf(path string) (*ResolvConf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	defer f.Close()
+	return ParseResolvConf(f)
+}
+
+// ParseResolvConf parses a resolver configuration. Unknown keywords are
+// ignored, as resolvers do.
+func ParseResolvConf(r io.Reader) (*ResolvConf, error) {
+	conf := &ResolvConf{Ndots: 1}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			if len(fields) > 1 {
+				conf.Nameservers = append(conf.Nameservers, fields[1])
+			}
+		case "search", "domain":
+			conf.Search = append([]string(nil), fields[1:]...)
+			for i, s := range conf.Search {
+				conf.Search[i] = strings.TrimSuffix(s, ".")
+			}
+		case "options":
+			for _, o := range fields[1:] {
+				if v, ok := strings.CutPrefix(o, "ndots:"); ok {
+					if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+						conf.Ndots = min(n, maxNdots)
+					}
+					continue
+				}
+				conf.Options = append(conf.Options, o)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// Domain returns the domain of a pod in namespace ns according to the
+// search list, e.g. "default.svc.cluster.local", or "" if the search list
+// doesn't contain a cluster domain. If ns is empty, the namespace is taken
+// from the search list as well.
+func (c *ResolvConf) Domain(ns string) string {
+	for _, s := range c.Search {
+		if ns != "" && strings.HasPrefix(s, "svc.") {
+			return ns + "." + s
+		}
+		labels := strings.SplitN(s, ".", 3)
+		if len(labels) == 3 && labels[0] != "" && labels[1] == "svc" && labels[2] != "" {
+			if ns == "" {
+				return s
+			}
+			return ns + ".svc." + labels[2]
+		}
+	}
+	return ""
+}
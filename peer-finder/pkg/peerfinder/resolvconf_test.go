@@ -0,0 +1,67 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peerfinder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseResolvConf(t *testing.T) {
+	conf, err := ParseResolvConf(strings.NewReader(`# generated by the kubelet
+domain example.com
+nameserver 10.96.0.10
+nameserver 10.96.0.11 ; secondary
+search default.svc.cluster.local svc.cluster.local cluster.local.
+options ndots:5 timeout:2
+options rotate
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &ResolvConf{
+		Nameservers: []string{"10.96.0.10", "10.96.0.11"},
+		Search:      []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"},
+		Ndots:       5,
+		Options:     []string{"timeout:2", "rotate"},
+	}
+	if !reflect.DeepEqual(conf, expected) {
+		t.Errorf("expected %+v, got %+v", expected, conf)
+	}
+}
+
+func TestResolvConfDomain(t *testing.T) {
+	cases := []struct {
+		search   []string
+		ns       string
+		expected string
+	}{
+		{[]string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"}, "", "default.svc.cluster.local"},
+		{[]string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"}, "db", "db.svc.cluster.local"},
+		{[]string{"example.com", "svc.k8s.example.com"}, "db", "db.svc.k8s.example.com"},
+		{[]string{"example.com", "svc.k8s.example.com"}, "", ""},
+		{[]string{"example.com"}, "db", ""},
+		{nil, "", ""},
+	}
+	for _, c := range cases {
+		conf := &ResolvConf{Search: c.search}
+		if got := conf.Domain(c.ns); got != c.expected {
+			t.Errorf("%v with namespace %q: expected %q, got %q", c.search, c.ns, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sets implements a small generic set type.
+package sets
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Set is a set of ordered values.
+type Set[T cmp.Ordered] map[T]struct{}
+
+// String is a set of strings.
+type String = Set[string]
+
+// New creates a Set from a list of values.
+func New[T cmp.Ordered](items ...T) Set[T] {
+	s := make(Set[T], len(items))
+	s.Insert(items...)
+	return s
+}
+
+// NewString creates a String set from a list of values.
+func NewString(items ...string) String {
+	return New(items...)
+}
+
+// Insert adds items to the set.
+func (s Set[T]) Insert(items ...T) Set[T] {
+	for _, item := range items {
+		s[item] = struct{}{}
+	}
+	return s
+}
+
+// Delete removes items from the set.
+func (s Set[T]) Delete(items ...T) Set[T] {
+	for _, item := range items {
+		delete(s, item)
+	}
+	return s
+}
+
+// Has returns true if item is contained in the set.
+func (s Set[T]) Has(item T) bool {
+	_, ok := s[item]
+	return ok
+}
+
+// Len returns the size of the set.
+func (s Set[T]) Len() int {
+	return len(s)
+}
+
+// Equal returns true if s and s2 contain the same items.
+func (s Set[T]) Equal(s2 Set[T]) bool {
+	if len(s) != len(s2) {
+		return false
+	}
+	for item := range s {
+		if !s2.Has(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// Difference returns the items of s that are not in s2.
+func (s Set[T]) Difference(s2 Set[T]) Set[T] {
+	result := New[T]()
+	for item := range s {
+		if !s2.Has(item) {
+			result.Insert(item)
+		}
+	}
+	return result
+}
+
+// Union returns the items that are in s or s2.
+func (s Set[T]) Union(s2 Set[T]) Set[T] {
+	result := New[T]()
+	for item := range s {
+		result.Insert(item)
+	}
+	for item := range s2 {
+		result.Insert(item)
+	}
+	return result
+}
+
+// Intersection returns the items that are in both s and s2.
+func (s Set[T]) Intersection(s2 Set[T]) Set[T] {
+	result := New[T]()
+	for item := range s {
+		if s2.Has(item) {
+			result.Insert(item)
+		}
+	}
+	return result
+}
+
+// List returns the items of the set as a sorted slice.
+func (s Set[T]) List() []T {
+	list := make([]T, 0, len(s))
+	for item := range s {
+		list = append(list, item)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// Diff returns the sorted items that were added to and removed from old to
+// get to new.
+func Diff[T cmp.Ordered](old, new Set[T]) (added, removed []T) {
+	return new.Difference(old).List(), old.Difference(new).List()
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sets
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	s := NewString("b", "a")
+	s.Insert("c", "a")
+	if s.Len() != 3 || !s.Has("c") {
+		t.Errorf("unexpected set %v", s.List())
+	}
+	s.Delete("b")
+	if s.Has("b") {
+		t.Errorf("expected b to be deleted from %v", s.List())
+	}
+	if !s.Equal(NewString("c", "a")) || s.Equal(NewString("a")) || s.Equal(NewString("a", "b")) {
+		t.Errorf("unexpected equality of %v", s.List())
+	}
+	if got := s.List(); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("expected sorted list, got %v", got)
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	a, b := New(1, 2, 3), New(3, 4)
+	cases := []struct {
+		name     string
+		got      Set[int]
+		expected []int
+	}{
+		{"difference", a.Difference(b), []int{1, 2}},
+		{"union", a.Union(b), []int{1, 2, 3, 4}},
+		{"intersection", a.Intersection(b), []int{3}},
+	}
+	for _, c := range cases {
+		if got := c.got.List(); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	added, removed := Diff(NewString("a", "b"), NewString("b", "c", "d"))
+	if !reflect.DeepEqual(added, []string{"c", "d"}) {
+		t.Errorf("expected c and d to be added, got %v", added)
+	}
+	if !reflect.DeepEqual(removed, []string{"a"}) {
+		t.Errorf("expected a to be removed, got %v", removed)
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/pprof"
+)
+
+// pprofOptions are the flags of the profiling endpoint.
+type pprofOptions struct {
+	addr string
+}
+
+func (o *pprofOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.addr, "pprof-addr", "", "The address to serve the net/http/pprof profiles on under /debug/pprof/, e.g. localhost:6060. Disabled if empty.")
+}
+
+// serve serves the profiles, if enabled, until ctx is cancelled.
+func (o *pprofOptions) serve(ctx context.Context) error {
+	if o.addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return serveHTTP(ctx, "pprof", o.addr, mux)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+// readinessGate sets a condition of this pod, listed in its readinessGates,
+// to True once it has clustered: the hook applying the peers succeeded and
+// this pod is among them.
+type readinessGate struct {
+	client    kubernetes.Interface
+	namespace string
+	pod       string
+	condition corev1.PodConditionType
+	set       bool
+}
+
+// clustered returns whether this pod is among the peers of u, err being the
+// error of the hook applying them.
+func clustered(u peerfinder.Update, err error) bool {
+	return err == nil && slices.Contains(u.Peers, u.Self)
+}
+
+// applied sets the condition in the background once u has been applied, err
+// being the error of its hook. It is only set once, the pod staying ready if
+// the peers change later.
+func (g *readinessGate) applied(ctx context.Context, u peerfinder.Update, err error) {
+	if g == nil || g.set || !clustered(u, err) {
+		return
+	}
+	g.set = true
+	go func() {
+		for {
+			pctx, cancel := context.WithTimeout(ctx, configMapTimeout)
+			err := kube.SetPodCondition(pctx, g.client, g.namespace, g.pod, g.condition, corev1.ConditionTrue, "Clustered", "Found among the peers after applying them")
+			cancel()
+			if err == nil {
+				slog.Info("Set the readiness gate", "condition", g.condition)
+				return
+			}
+			slog.Warn("Failed to set the readiness gate, retrying", "condition", g.condition, "in", configMapRetry, "err", err)
+			select {
+			case <-time.After(configMapRetry):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestClustered(t *testing.T) {
+	alone := testUpdate
+	alone.Peers = []string{"web-1.nginx.default.svc.cluster.local"}
+	cases := []struct {
+		name     string
+		u        peerfinder.Update
+		err      error
+		expected bool
+	}{
+		{"found", testUpdate, nil, true},
+		{"hook failed", testUpdate, errors.New("exit status 1"), false},
+		{"not found", alone, nil, false},
+	}
+	for _, c := range cases {
+		if got := clustered(c.u, c.err); got != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestReadinessGate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"}})
+	g := &readinessGate{client: client, namespace: "default", pod: "web-0", condition: "peer-finder.io/clustered"}
+
+	g.applied(ctx, testUpdate, errors.New("exit status 1"))
+	if g.set {
+		t.Fatalf("expected the gate not to be set after a failed hook")
+	}
+	g.applied(ctx, testUpdate, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p, err := client.CoreV1().Pods("default").Get(ctx, "web-0", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Status.Conditions) == 1 && p.Status.Conditions[0].Status == corev1.ConditionTrue {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the condition to be set, got %v", p.Status.Conditions)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// A nil gate, without -readiness-gate, does nothing.
+	var none *readinessGate
+	none.applied(ctx, testUpdate, nil)
+}
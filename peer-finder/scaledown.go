@@ -0,0 +1,82 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+)
+
+// scaleDown tells when the StatefulSet of this pod is scaled down below it,
+// i.e. to as many replicas as its ordinal or fewer, for on-scale-down to run
+// before the pod is deleted.
+type scaleDown struct {
+	ordinal int
+	// replicas receives the desired count of replicas of the StatefulSet,
+	// nil without on-scale-down so that it never does.
+	replicas <-chan int
+	// removed is set once on-scale-down ran, until scaled up again.
+	removed bool
+}
+
+// newScaleDown starts watching the replicas of the StatefulSet owning the pod
+// named pod in ns.
+func newScaleDown(ctx context.Context, ns, pod string) (*scaleDown, error) {
+	n, ok := peerfinder.Ordinal(pod)
+	if !ok {
+		return nil, fmt.Errorf("-on-scale-down requires a StatefulSet pod, %s has no ordinal", pod)
+	}
+	client, err := kube.InClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	ch, err := kube.WatchStatefulSetReplicas(ctx, client, ns, pod)
+	if err != nil {
+		return nil, fmt.Errorf("cannot watch the StatefulSet of pod %s/%s: %v", ns, pod, err)
+	}
+	return &scaleDown{ordinal: n, replicas: ch}, nil
+}
+
+// scaled returns whether on-scale-down must run now that the StatefulSet
+// wants replicas pods: this pod is beyond them and it did not run yet.
+func (s *scaleDown) scaled(replicas int) bool {
+	if s.ordinal < replicas {
+		s.removed = false
+		return false
+	}
+	if s.removed {
+		return false
+	}
+	s.removed = true
+	slog.Info("StatefulSet scaled down below this pod", "replicas", replicas, "ordinal", s.ordinal)
+	return true
+}
+
+// scaleDownEnv returns the environment of on-scale-down, that of the hooks for
+// last, the last update applied if not nil, with the new count of replicas.
+func scaleDownEnv(last *peerfinder.Update, service string, replicas int) []string {
+	var env []string
+	if last != nil {
+		env = hookEnv(*last, service)
+	}
+	return append(env, "REPLICAS="+strconv.Itoa(replicas))
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScaleDown(t *testing.T) {
+	s := &scaleDown{ordinal: 2}
+	for _, c := range []struct {
+		replicas int
+		expected bool
+	}{
+		{3, false},
+		{2, true},
+		// It only runs once for a scale-down.
+		{1, false},
+		{3, false},
+		{2, true},
+	} {
+		if got := s.scaled(c.replicas); got != c.expected {
+			t.Errorf("%d replicas: expected %v, got %v", c.replicas, c.expected, got)
+		}
+	}
+}
+
+func TestScaleDownEnv(t *testing.T) {
+	if env := scaleDownEnv(nil, "nginx.default.svc.cluster.local", 2); !slices.Equal(env, []string{"REPLICAS=2"}) {
+		t.Errorf("unexpected environment %v", env)
+	}
+	env := scaleDownEnv(&testUpdate, "nginx.default.svc.cluster.local", 1)
+	if !slices.Contains(env, "REPLICAS=1") || !slices.Contains(env, "SELF_NAME="+testUpdate.Self) {
+		t.Errorf("unexpected environment %v", env)
+	}
+}
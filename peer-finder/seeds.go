@@ -0,0 +1,53 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"slices"
+	"strconv"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// seedsOf returns u with only its n lowest ordinal peers, the seeds, in
+// ordinal order, its added and removed peers being relative to the seeds of
+// base, the last update applied, nil if none was.
+func seedsOf(u peerfinder.Update, n int, base *peerfinder.Update) peerfinder.Update {
+	seeds := byOrdinal(u.Peers)
+	if len(seeds) > n {
+		seeds = seeds[:n]
+	}
+	u.Peers = seeds
+	return rebase(u, base)
+}
+
+// seedsChanged returns whether the seeds of u differ from those of base, the
+// last update applied, nil if none was.
+func seedsChanged(u peerfinder.Update, base *peerfinder.Update) bool {
+	return base == nil || !slices.Equal(u.Peers, base.Peers)
+}
+
+// seedEnv returns env with IS_SEED with -seeds=n, whether this pod is among
+// the seeds of last, the last update applied, false if none was. env is
+// returned as is if n is 0.
+func seedEnv(env []string, last *peerfinder.Update, n int) []string {
+	if n == 0 {
+		return env
+	}
+	seed := last != nil && slices.Contains(last.Peers, last.Self)
+	return append(env, "IS_SEED="+strconv.FormatBool(seed))
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestSeedsOf(t *testing.T) {
+	base := &peerfinder.Update{Peers: []string{"web-0", "web-1"}, Self: "web-2"}
+	for _, tc := range []struct {
+		name     string
+		peers    []string
+		base     *peerfinder.Update
+		expected peerfinder.Update
+		changed  bool
+	}{
+		{
+			name:     "initial",
+			peers:    []string{"web-10", "web-2", "web-1"},
+			expected: peerfinder.Update{Peers: []string{"web-1", "web-2"}, Added: []string{"web-1", "web-2"}, Initial: true},
+			changed:  true,
+		},
+		{
+			name:     "fewer peers than seeds",
+			peers:    []string{"web-0"},
+			base:     base,
+			expected: peerfinder.Update{Peers: []string{"web-0"}, Removed: []string{"web-1"}},
+			changed:  true,
+		},
+		{
+			name:     "seed replaced",
+			peers:    []string{"web-0", "web-2", "web-3"},
+			base:     base,
+			expected: peerfinder.Update{Peers: []string{"web-0", "web-2"}, Added: []string{"web-2"}, Removed: []string{"web-1"}},
+			changed:  true,
+		},
+		{
+			name:     "other peers changed",
+			peers:    []string{"web-3", "web-1", "web-0"},
+			base:     base,
+			expected: peerfinder.Update{Peers: []string{"web-0", "web-1"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := seedsOf(peerfinder.Update{Peers: tc.peers, Added: tc.peers, Initial: tc.base == nil}, 2, tc.base)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, got)
+			}
+			if changed := seedsChanged(got, tc.base); changed != tc.changed {
+				t.Errorf("expected changed %v, got %v", tc.changed, changed)
+			}
+		})
+	}
+}
+
+func TestSeedEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		last     *peerfinder.Update
+		n        int
+		expected []string
+	}{
+		{"disabled", &peerfinder.Update{Peers: []string{"web-0"}, Self: "web-0"}, 0, []string{"A=1"}},
+		{"seed", &peerfinder.Update{Peers: []string{"web-0"}, Self: "web-0"}, 1, []string{"A=1", "IS_SEED=true"}},
+		{"not a seed", &peerfinder.Update{Peers: []string{"web-0"}, Self: "web-1"}, 1, []string{"A=1", "IS_SEED=false"}},
+		{"nothing applied", nil, 1, []string{"A=1", "IS_SEED=false"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := seedEnv([]string{"A=1"}, tc.last, tc.n); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
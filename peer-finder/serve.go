@@ -0,0 +1,254 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/sets"
+)
+
+// peerList is the document served on /peers.
+type peerList struct {
+	Self    string   `json:"self"`
+	Peers   []string `json:"peers"`
+	Members []member `json:"members"`
+	// Updated is when the peers were last looked up and found changed, null
+	// until they are first found.
+	Updated *time.Time `json:"updated"`
+	Source  string     `json:"source"`
+	// Domains are the domains the peers are looked up in.
+	Domains []string `json:"domains"`
+}
+
+// peerStore holds the latest peers, served on GET /peers.
+type peerStore struct {
+	mu      sync.Mutex
+	current peerList
+	update  *peerfinder.Update
+	// changed is closed when the peers change.
+	changed chan struct{}
+}
+
+func newPeerStore(pf *peerfinder.PeerFinder) *peerStore {
+	return &peerStore{
+		current: peerList{
+			Self:    pf.Self(),
+			Peers:   []string{},
+			Members: []member{},
+			Domains: []string{pf.Domain()},
+		},
+		changed: make(chan struct{}),
+	}
+}
+
+// set makes u the latest peers.
+func (s *peerStore) set(u peerfinder.Update) {
+	m := members(u)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current.Peers, s.current.Members = u.Peers, m
+	s.current.Updated, s.current.Source = &u.Time, u.Source
+	s.update = &u
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// latest returns the latest peers and update, nil until the peers are
+// found, and a channel closed once they change.
+func (s *peerStore) latest() (peerList, *peerfinder.Update, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current, s.update, s.changed
+}
+
+func (s *peerStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	current, _, _ := s.latest()
+	b, err := json.Marshal(current)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// peerAddress returns the address of the peer named name, resolved with r,
+// or net.DefaultResolver if nil, unless it is an address already.
+func peerAddress(ctx context.Context, r peerfinder.Resolver, name string) (net.IP, error) {
+	if ip := net.ParseIP(name); ip != nil {
+		return ip, nil
+	}
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	ips, err := r.LookupIP(ctx, "ip", name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return ips[0], nil
+}
+
+// sseKeepAlive is the interval between the comments sent on idle /watch
+// streams, so that proxies don't close them.
+const sseKeepAlive = 30 * time.Second
+
+// serveWatch streams the peers as Server-Sent Events, a change event with
+// the JSON document of the -output=json format being sent once they are
+// found, then for each change of them.
+func (s *peerStore) serveWatch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	var sent []string
+	for {
+		_, u, changed := s.latest()
+		if u != nil {
+			e := *u
+			e.Added, e.Removed = sets.Diff(sets.NewString(sent...), sets.NewString(u.Peers...))
+			data, err := renderJSON(e)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: change\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+			sent = u.Peers
+		}
+	wait:
+		for {
+			select {
+			case <-changed:
+				break wait
+			case <-keepAlive.C:
+				if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+func runServe(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	var o options
+	o.addFlags(fs)
+	addr := fs.String("address", ":9376", "The address to serve the peer list, /watch, /healthz and /readyz on, host:port or unix:<path> for a Unix socket.")
+	grpcAddr := fs.String("grpc-address", "", "The address to serve the gRPC API on, host:port or unix:<path> for a Unix socket. Disabled if empty.")
+	var eds edsOptions
+	eds.addFlags(fs)
+	var dnsOpts dnsServerOptions
+	dnsOpts.addFlags(fs)
+	var auth apiAuth
+	auth.addFlags(fs)
+	var probes health
+	probes.addFlags(fs)
+	var profiling pprofOptions
+	profiling.addFlags(fs)
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+	if err := auth.load(); err != nil {
+		return err
+	}
+
+	pf, err := o.peerFinder(ctx)
+	if err != nil {
+		return err
+	}
+	if err := profiling.serve(ctx); err != nil {
+		return err
+	}
+
+	store := newPeerStore(pf)
+	store.current.Domains = o.domains(pf)
+	if *grpcAddr != "" {
+		if err := serveGRPC(ctx, *grpcAddr, store, auth.grpcOptions()...); err != nil {
+			return err
+		}
+	}
+	if eds.addr != "" {
+		if eds.cluster == "" {
+			eds.cluster = o.service
+		}
+		if err := eds.serve(ctx, store, auth.grpcOptions()...); err != nil {
+			return err
+		}
+	}
+	if dnsOpts.addr != "" {
+		if err := dnsOpts.serve(ctx, store, pf.Service(), pf.Domain()); err != nil {
+			return err
+		}
+	}
+	pf.Start(ctx)
+	go func() {
+		for u := range pf.Updates() {
+			store.set(u)
+			probes.setReady()
+		}
+	}()
+
+	mux := http.NewServeMux()
+	probes.pf = pf
+	probes.register(mux)
+	mux.Handle("/peers", auth.handler(store))
+	mux.Handle("/watch", auth.handler(http.HandlerFunc(store.serveWatch)))
+	l, err := listen(*addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	slog.Info("Serving peers", "address", *addr)
+	if err := auth.serve(srv, l); err != http.ErrServerClosed {
+		return err
+	}
+	pf.Stop()
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestPeerStore(t *testing.T) {
+	pf, err := peerfinder.New(peerfinder.Config{Service: "nginx", Domain: "default.svc.cluster.local", Hostname: "web-0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := newPeerStore(pf)
+	get := func(method string) (*httptest.ResponseRecorder, peerList) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, "/peers", nil))
+		var l peerList
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &l); err != nil {
+				t.Fatalf("invalid JSON %q: %v", w.Body, err)
+			}
+		}
+		return w, l
+	}
+
+	if _, l := get(http.MethodGet); l.Updated != nil || len(l.Peers) != 0 || !reflect.DeepEqual(l.Domains, []string{"default.svc.cluster.local"}) {
+		t.Errorf("unexpected peers before the first update: %+v", l)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	s.set(peerfinder.Update{
+		Peers:   []string{"web-0.nginx.default.svc.cluster.local"},
+		Details: map[string]peerfinder.Peer{"web-0.nginx.default.svc.cluster.local": {Port: 80}},
+		Time:    now,
+		Source:  "dns:nginx",
+	})
+	_, l := get(http.MethodGet)
+	expected := []member{{Name: "web-0.nginx.default.svc.cluster.local", Port: 80}}
+	if !reflect.DeepEqual(l.Members, expected) || l.Updated == nil || !l.Updated.Equal(now) || l.Source != "dns:nginx" {
+		t.Errorf("unexpected peers: %+v", l)
+	}
+	if w, _ := get(http.MethodPost); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST to be rejected, got %d", w.Code)
+	}
+}
+
+func TestPeerStoreWatch(t *testing.T) {
+	pf, err := peerfinder.New(peerfinder.Config{Service: "nginx", Domain: "default.svc.cluster.local", Hostname: "web-0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := newPeerStore(pf)
+	server := httptest.NewServer(http.HandlerFunc(s.serveWatch))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+
+	s.set(peerfinder.Update{Peers: []string{"a"}})
+	scanner := bufio.NewScanner(resp.Body)
+	for _, expected := range [][]string{{"a"}, {"b"}} {
+		var e peerEvent
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				if err := json.Unmarshal([]byte(data), &e); err != nil {
+					t.Fatalf("invalid event %q: %v", data, err)
+				}
+				break
+			}
+		}
+		if !reflect.DeepEqual(e.Added, expected) {
+			t.Errorf("expected added %v, got %+v", expected, e)
+		}
+		s.set(peerfinder.Update{Peers: []string{"a", "b"}})
+	}
+}
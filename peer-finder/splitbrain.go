@@ -0,0 +1,200 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/sets"
+)
+
+// appliedPeersPath is where health serves the peers last applied, for the
+// others to compare with theirs.
+const appliedPeersPath = "/applied-peers"
+
+// appliedPeers is what appliedPeersPath serves.
+type appliedPeers struct {
+	Peers []string `json:"peers"`
+}
+
+// splitBrain compares the peers applied by this pod with those applied by
+// each of them, asked on the health port of their peer-finder, reporting a
+// split brain once some disagree for longer than after, e.g. when two halves
+// of the peers don't see each other and reconfigure independently.
+type splitBrain struct {
+	port   int
+	after  time.Duration
+	period time.Duration
+	self   string
+	client *http.Client
+	// events posts the split brains, if not nil.
+	events *eventObserver
+	// detected receives the peers disagreeing with this pod, for
+	// on-split-brain to run, nil if disabled so that it never does.
+	detected chan []string
+
+	mu    sync.Mutex
+	peers []string
+
+	// since is when the peers started disagreeing, zero if they agree.
+	since time.Time
+	split bool
+}
+
+// start checks the peers every period until ctx is cancelled.
+func (s *splitBrain) start(ctx context.Context) {
+	s.detected = make(chan []string, 1)
+	go func() {
+		ticker := time.NewTicker(s.period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.check(ctx, time.Now())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// applied records the peers applied by this pod.
+func (s *splitBrain) applied(u peerfinder.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peers = u.Peers
+}
+
+// check compares the peers with those of the others at now, reporting a split
+// brain when they disagreed for longer than after, and its end.
+func (s *splitBrain) check(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	peers := s.peers
+	s.mu.Unlock()
+	if peers == nil {
+		return
+	}
+	divergent := s.divergent(ctx, peers)
+	divergentPeers.Set(float64(len(divergent)))
+	switch {
+	case len(divergent) == 0:
+		s.since = time.Time{}
+		if s.split {
+			s.split = false
+			splitBrainDetected.Set(0)
+			slog.Info("Peers agree on the membership again")
+			s.event(corev1.EventTypeNormal, "SplitBrainResolved", "All the peers agree on the membership again")
+		}
+	case s.since.IsZero():
+		s.since = now
+	case !s.split && now.Sub(s.since) >= s.after:
+		s.split = true
+		splitBrainDetected.Set(1)
+		slog.Warn("Split brain, peers disagree on the membership", "for", now.Sub(s.since), "peers", divergent)
+		s.event(corev1.EventTypeWarning, "SplitBrain", fmt.Sprintf("Peers disagree on the membership for %s: %s", s.after, strings.Join(divergent, ", ")))
+		// Replace the peers waiting for on-split-brain, if any.
+		select {
+		case <-s.detected:
+		default:
+		}
+		s.detected <- divergent
+	}
+}
+
+func (s *splitBrain) event(eventType, reason, message string) {
+	if s.events != nil {
+		s.events.event(eventType, reason, message)
+	}
+}
+
+// divergent returns the peers whose peers differ from peers, asking them
+// concurrently. The peers which cannot be asked are left out.
+func (s *splitBrain) divergent(ctx context.Context, peers []string) []string {
+	want := sets.NewString(peers...)
+	differs := make([]bool, len(peers))
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		if p == s.self {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			theirs, err := s.fetch(ctx, p)
+			if err != nil {
+				slog.Debug("Cannot get the peers of a peer", "peer", p, "err", err)
+				return
+			}
+			differs[i] = !want.Equal(sets.NewString(theirs...))
+		}()
+	}
+	wg.Wait()
+	var divergent []string
+	for i, p := range peers {
+		if differs[i] {
+			divergent = append(divergent, p)
+		}
+	}
+	return divergent
+}
+
+// fetch returns the peers applied by peer.
+func (s *splitBrain) fetch(ctx context.Context, peer string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, peerfinder.DefaultHandshakeTimeout)
+	defer cancel()
+	u := url.URL{Scheme: "http", Host: net.JoinHostPort(peer, strconv.Itoa(s.port)), Path: appliedPeersPath}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting the peers failed: %s", resp.Status)
+	}
+	var view appliedPeers
+	if err := json.NewDecoder(resp.Body).Decode(&view); err != nil {
+		return nil, err
+	}
+	return view.Peers, nil
+}
+
+// splitBrainEnv returns the environment of on-split-brain, that of the hooks
+// for last, the last update applied, with the peers disagreeing with it.
+func splitBrainEnv(last peerfinder.Update, service string, divergent []string) []string {
+	return append(hookEnv(last, service), "DIVERGENT_PEERS="+strings.Join(divergent, ","))
+}
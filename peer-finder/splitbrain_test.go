@@ -0,0 +1,110 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestSplitBrain(t *testing.T) {
+	// Each peer serves its health, reached by name through the client.
+	healths := map[string]*health{"a": {}, "b": {}}
+	servers := map[string]string{}
+	for name, h := range healths {
+		mux := http.NewServeMux()
+		h.register(mux)
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+		servers[name] = srv.Listener.Addr().String()
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(addr)
+			if a, ok := servers[host]; ok {
+				addr = a
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	s := &splitBrain{port: 8080, after: time.Minute, self: "c", client: client, detected: make(chan []string, 1)}
+	ctx := context.Background()
+	start := time.Now()
+
+	// Nothing is compared before this pod applied peers, nor with the peers
+	// which did not.
+	s.check(ctx, start)
+	s.applied(peerfinder.Update{Peers: []string{"a", "b", "c"}})
+	s.check(ctx, start)
+	if !s.since.IsZero() {
+		t.Fatalf("expected the peers without peers applied to be left out")
+	}
+
+	healths["a"].setPeers([]string{"a", "b", "c"})
+	healths["b"].setPeers([]string{"c", "b"})
+	s.check(ctx, start)
+	if s.split || s.since != start {
+		t.Fatalf("expected the peers to start disagreeing, got split %v since %v", s.split, s.since)
+	}
+	if got := testutil.ToFloat64(divergentPeers); got != 1 {
+		t.Errorf("expected 1 divergent peer, got %v", got)
+	}
+	s.check(ctx, start.Add(time.Minute))
+	if !s.split {
+		t.Fatalf("expected a split brain after %v", s.after)
+	}
+	if got := testutil.ToFloat64(splitBrainDetected); got != 1 {
+		t.Errorf("expected peer_finder_split_brain to be 1, got %v", got)
+	}
+	select {
+	case divergent := <-s.detected:
+		if !reflect.DeepEqual(divergent, []string{"b"}) {
+			t.Errorf("expected b to diverge, got %v", divergent)
+		}
+	default:
+		t.Fatalf("expected the split brain to be detected")
+	}
+	s.check(ctx, start.Add(2*time.Minute))
+	if len(s.detected) != 0 {
+		t.Errorf("expected the split brain to be detected once")
+	}
+
+	healths["b"].setPeers([]string{"c", "b", "a"})
+	s.check(ctx, start.Add(3*time.Minute))
+	if s.split || !s.since.IsZero() {
+		t.Errorf("expected the split brain to be resolved")
+	}
+	if got := testutil.ToFloat64(splitBrainDetected); got != 0 {
+		t.Errorf("expected peer_finder_split_brain to be 0, got %v", got)
+	}
+}
+
+func TestSplitBrainEnv(t *testing.T) {
+	env := splitBrainEnv(peerfinder.Update{Peers: []string{"a", "b"}}, "svc", []string{"a", "b"})
+	if got := env[len(env)-1]; got != "DIVERGENT_PEERS=a,b" {
+		t.Errorf("expected DIVERGENT_PEERS=a,b, got %s", got)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// signals are the signals that can be sent to a supervised process.
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// parseSignal parses a signal name such as SIGHUP or HUP.
+func parseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := signals[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported signal %q", name)
+	}
+	return sig, nil
+}
+
+// supervisor runs a long-running child process and reloads it when the peers
+// change, either by signalling or by restarting it.
+type supervisor struct {
+	argv    []string
+	restart bool
+	signal  syscall.Signal
+
+	cmd *exec.Cmd
+	// exited receives the result of the child once it exits.
+	exited chan error
+}
+
+func newSupervisor(argv []string, reload, signal string) (*supervisor, error) {
+	s := &supervisor{argv: argv, exited: make(chan error, 1)}
+	switch reload {
+	case "signal":
+		sig, err := parseSignal(signal)
+		if err != nil {
+			return nil, err
+		}
+		s.signal = sig
+	case "restart":
+		s.restart = true
+	default:
+		return nil, fmt.Errorf("unknown reload mode %q, must be signal or restart", reload)
+	}
+	return s, nil
+}
+
+// start starts the child.
+func (s *supervisor) start() error {
+	slog.Info("Starting supervised program", "argv", s.argv)
+	cmd := exec.Command(s.argv[0], s.argv[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.cmd = cmd
+	go func() {
+		s.exited <- cmd.Wait()
+	}()
+	return nil
+}
+
+// reload signals or restarts the child.
+func (s *supervisor) reload() error {
+	if !s.restart {
+		slog.Info("Reloading supervised program", "signal", s.signal.String(), "argv", s.argv)
+		return s.cmd.Process.Signal(s.signal)
+	}
+	s.stop()
+	return s.start()
+}
+
+// stop terminates the child and waits for it to exit.
+func (s *supervisor) stop() error {
+	slog.Info("Stopping supervised program", "argv", s.argv)
+	if err := s.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		// The child already exited.
+		slog.Warn("Failed to terminate supervised program", "argv", s.argv, "err", err)
+	}
+	return <-s.exited
+}
+
+// exitCode returns the exit code of a child that exited with err.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			return status.ExitStatus()
+		}
+	}
+	return exitError
+}
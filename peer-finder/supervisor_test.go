@@ -0,0 +1,84 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseSignal(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected syscall.Signal
+		err      bool
+	}{
+		{"SIGHUP", syscall.SIGHUP, false},
+		{"hup", syscall.SIGHUP, false},
+		{"USR2", syscall.SIGUSR2, false},
+		{"SIGKILL", 0, true},
+	}
+	for _, c := range cases {
+		sig, err := parseSignal(c.name)
+		if (err != nil) != c.err || sig != c.expected {
+			t.Errorf("%s: expected %v (error: %v), got %v (%v)", c.name, c.expected, c.err, sig, err)
+		}
+	}
+}
+
+func TestSupervisorSignal(t *testing.T) {
+	s, err := newSupervisor([]string{"sh", "-c", `trap "exit 3" HUP; while true; do sleep 0.1; done`}, "signal", "SIGHUP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.start(); err != nil {
+		t.Fatal(err)
+	}
+	// Give the shell time to install its trap.
+	time.Sleep(200 * time.Millisecond)
+	if err := s.reload(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-s.exited:
+		if code := exitCode(err); code != 3 {
+			t.Errorf("expected exit code 3, got %d (%v)", code, err)
+		}
+	case <-time.After(5 * time.Second):
+		s.stop()
+		t.Fatalf("child did not get the signal")
+	}
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	s, err := newSupervisor([]string{"sleep", "10"}, "restart", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.start(); err != nil {
+		t.Fatal(err)
+	}
+	first := s.cmd.Process.Pid
+	if err := s.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.cmd.Process.Pid == first {
+		t.Errorf("expected the child to be restarted")
+	}
+	s.stop()
+}
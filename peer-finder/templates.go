@@ -0,0 +1,139 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"text/template"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// templatePeer is a peer as seen by templates. It prints as its name.
+type templatePeer struct {
+	// Name is the fully qualified name of the peer.
+	Name string
+	// Hostname is the first label of Name.
+	Hostname string
+	// Ordinal is the StatefulSet ordinal of the peer, -1 if it has none.
+	Ordinal int
+	// Port is the port of the peer, 0 if unknown.
+	Port int
+	// Cluster is the ID of the cluster of the peer within its clusterset, ""
+	// if unknown.
+	Cluster string
+	// Domain is the domain the peer was found in with -extdomain, "" if
+	// unknown.
+	Domain string
+	// Ready is false for the not ready peers reported with -include-not-ready.
+	Ready bool
+	// Zone and Region are the topology of the node of the peer, "" if
+	// unknown.
+	Zone   string
+	Region string
+	// Unreachable is set for the dead peers reported with
+	// -failure-detection=flag or -probe-unreachable=flag.
+	Unreachable bool
+	// ProbeStatus is the serving status of the peer with -probe-type=grpc,
+	// e.g. SERVING, "" otherwise.
+	ProbeStatus string
+	// Labels and Annotations are those of -peer-labels and -peer-annotations
+	// of the pod of the peer, e.g. {{index .Labels "role"}}.
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+func (p templatePeer) String() string {
+	return p.Name
+}
+
+// templateData is what templates are executed with.
+type templateData struct {
+	Peers   []templatePeer
+	Added   []templatePeer
+	Removed []templatePeer
+	Self    templatePeer
+	// ReadyPeers and NotReadyPeers split Peers by readiness.
+	ReadyPeers    []templatePeer
+	NotReadyPeers []templatePeer
+}
+
+func newTemplatePeer(name string, details map[string]peerfinder.Peer) templatePeer {
+	ordinal, ok := peerfinder.Ordinal(name)
+	if !ok {
+		ordinal = -1
+	}
+	return templatePeer{
+		Name:        name,
+		Hostname:    peerfinder.Hostname(name),
+		Ordinal:     ordinal,
+		Port:        details[name].Port,
+		Cluster:     details[name].Cluster,
+		Domain:      details[name].Domain,
+		Ready:       !details[name].NotReady,
+		Zone:        details[name].Zone,
+		Region:      details[name].Region,
+		Unreachable: details[name].Unreachable,
+		ProbeStatus: details[name].ProbeStatus,
+		Labels:      details[name].Labels,
+		Annotations: details[name].Annotations,
+	}
+}
+
+func newTemplatePeers(names []string, details map[string]peerfinder.Peer) []templatePeer {
+	peers := make([]templatePeer, 0, len(names))
+	for _, n := range names {
+		peers = append(peers, newTemplatePeer(n, details))
+	}
+	return peers
+}
+
+var templateFuncs = template.FuncMap{
+	"join": func(sep string, peers []templatePeer) string {
+		names := make([]string, 0, len(peers))
+		for _, p := range peers {
+			names = append(names, p.Name)
+		}
+		return strings.Join(names, sep)
+	},
+}
+
+// fileTemplate is a template rendered to a file.
+type fileTemplate struct {
+	tmpl *template.Template
+	out  string
+}
+
+func (t *fileTemplate) render(u peerfinder.Update) error {
+	ready, notReady := readiness(u)
+	data := templateData{
+		Peers:         newTemplatePeers(u.Peers, u.Details),
+		Added:         newTemplatePeers(u.Added, u.Details),
+		Removed:       newTemplatePeers(u.Removed, u.Details),
+		Self:          newTemplatePeer(u.Self, u.Details),
+		ReadyPeers:    newTemplatePeers(ready, u.Details),
+		NotReadyPeers: newTemplatePeers(notReady, u.Details),
+	}
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return err
+	}
+	slog.Info("Writing template", "path", t.out)
+	return writeFileAtomic(t.out, b.Bytes(), 0644)
+}
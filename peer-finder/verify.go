@@ -0,0 +1,55 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+func runVerify(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	var o options
+	o.addFlags(fs)
+	timeout := fs.Duration("timeout", 10*time.Second, "How long to wait for the lookup to complete.")
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	pf, err := o.peerFinder(ctx)
+	if err != nil {
+		return err
+	}
+	u, err := pf.Lookup(ctx)
+	if err != nil {
+		return fmt.Errorf("lookup failed: %v", err)
+	}
+	fmt.Printf("Found %d peers with %s:\n", len(u.Peers), u.Source)
+	found := false
+	for _, p := range u.Peers {
+		fmt.Printf("  %s\n", p)
+		found = found || p == pf.Self()
+	}
+	if !found {
+		return fmt.Errorf("%s is not in the list of peers", pf.Self())
+	}
+	fmt.Printf("OK, found myself as %s\n", pf.Self())
+	return nil
+}
@@ -0,0 +1,487 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+	"k8s.io/contrib/peer-finder/pkg/peerfinder/kube"
+	"k8s.io/contrib/peer-finder/pkg/sets"
+)
+
+func runWatch(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	var o options
+	o.addFlags(fs)
+	var out outputOptions
+	out.addFlags(fs)
+	var files fileOptions
+	files.addFlags(fs)
+	var hooks hookOptions
+	hooks.addFlags(fs)
+	var probes health
+	probes.addFlags(fs)
+	probes.addAddressFlag(fs)
+	var profiling pprofOptions
+	profiling.addFlags(fs)
+	onChangeFlag := hooks.addHookFlag(fs, "on-change", "Script to run on change, must accept a new line separated list of peers via stdin.")
+	onStartFlag := hooks.addHookFlag(fs, "on-start", "Script to run on start, must accept a new line separated list of peers via stdin.")
+	onAddedFlag := hooks.addHookFlag(fs, "on-peer-added", "Script to run for each peer that joined, with its name as first argument and on stdin. It runs after on-change.")
+	onRemovedFlag := hooks.addHookFlag(fs, "on-peer-removed", "Script to run for each peer that left, with its name as first argument and on stdin. It runs after on-change.")
+	onCheckFlag := hooks.addHookFlag(fs, "on-change-check", "Script to run before on-change with the new peers, e.g. to validate the configuration generated for them. If it fails, nothing is applied and the check runs again after -check-retry-period.")
+	checkRetry := fs.Duration("check-retry-period", 10*time.Second, "How long to wait before running on-change-check again after it failed.")
+	onStopFlag := hooks.addHookFlag(fs, "on-stop", "Script to run on SIGTERM or SIGINT, e.g. for this pod to leave the cluster, must accept the last known new line separated list of peers via stdin. It does not run if no script ran before.")
+	onSplitBrainFlag := hooks.addHookFlag(fs, "on-split-brain", "Script to run when the peers disagreed with this pod on the membership for longer than -split-brain-after, e.g. to alert or to fence this pod, with the last known new line separated list of peers via stdin and the peers disagreeing, comma separated, in DIVERGENT_PEERS.")
+	splitAfter := fs.Duration("split-brain-after", 0, "How long the peers may disagree with this pod on the membership before a split brain is reported, through the peer_finder_split_brain metric, a SplitBrain event with -events and on-split-brain. The peers each peer applied are asked for on /applied-peers of -handshake-port. 0 disables the detection.")
+	splitPeriod := fs.Duration("split-brain-check-period", 30*time.Second, "How often the peers are asked for theirs with -split-brain-after.")
+	onScaleDownFlag := hooks.addHookFlag(fs, "on-scale-down", "Script to run when the StatefulSet of this pod is scaled down to as many replicas as its ordinal or fewer, e.g. to decommission or drain it before it is deleted, with the last known new line separated list of peers via stdin and the new count of replicas in REPLICAS. This requires permission to get pods and to get, list and watch statefulsets.")
+	seedCount := fs.Int("seeds", 0, "Only pass the N lowest ordinal peers, the seeds, to hooks, output files and the supervised program, e.g. to bootstrap Cassandra or Akka, IS_SEED telling hooks whether this pod is one of them. Changes of the other peers are not applied. 0 passes all the peers.")
+	var supervise argvFlag
+	fs.Var(&supervise, "supervise", "Program to start as a child once on-start has run, given as a JSON array or by repeating the flag once per argument. It is reloaded after each on-change and peer-finder exits with it.")
+	reload := fs.String("reload", "signal", "How the supervised program is reloaded when the peers change, one of: signal, restart.")
+	reloadSignal := fs.String("reload-signal", "SIGHUP", "The signal sent to the supervised program when -reload=signal.")
+	startupTimeout := fs.Duration("startup-timeout", 0, "How long to wait for this pod to be found among the peers before exiting with code 3. 0 waits until it is.")
+	auditFile := fs.String("audit-file", "", "A file a timestamped JSON record of each change of the peers and each run of a hook is appended to, with the old and new peers and the exit status of the hook.")
+	events := fs.Bool("events", false, "Whether changes of the peers and failures of hooks are posted as Kubernetes events on this pod, shown by kubectl describe pod. This requires permission to get pods and create events.")
+	configMap := fs.String("publish-configmap", "", "The name of a ConfigMap of the namespace the peers are written to, new line separated, with a revision hash of them, by the first of the peers or the leader with -leader-elect. This requires permission to get, create and update configmaps.")
+	annotate := fs.Bool("annotate-pod", false, "Whether this pod is annotated with "+peersHashAnnotation+", a hash of the peers, after each successful run of a hook, so that kubectl shows which pods converged on the same peers. This requires permission to patch pods.")
+	gate := fs.String("readiness-gate", "", "A condition type listed in the readinessGates of this pod, e.g. peer-finder.io/clustered, set to True once on-start has succeeded and this pod is among the peers. This requires permission to patch pods/status.")
+	barrierFlag := fs.Bool("barrier", false, "Whether the peers are held back until all of them found the same ones, each pod publishing those it found as the "+seenPeersAnnotation+" annotation, e.g. for quorum systems not to bootstrap on diverging views of DNS. This requires permission to get, list and patch pods.")
+	var leader leaderOptions
+	leader.addFlags(fs)
+	var notify webhookOptions
+	notify.addFlags(fs)
+	var publish natsOptions
+	publish.addFlags(fs)
+	var produce kafkaOptions
+	produce.addFlags(fs)
+	once := fs.Bool("once", false, "Exit as soon as this pod has been found among the peers and on-start has run, like the once command, e.g. in an init container.")
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+
+	var leading func() bool
+	if leader.elect || len(leader.only) > 0 {
+		pod, err := podName()
+		if err != nil {
+			return err
+		}
+		e, err := leader.elector(ctx, o.podNamespace(), o.service, pod)
+		if err != nil {
+			return err
+		}
+		leading = e.Leading
+	}
+	hooks.leading, hooks.leaderOnly = leading, leader.only.split()
+
+	if *seedCount < 0 {
+		return fmt.Errorf("-seeds must not be negative")
+	}
+	if *splitAfter > 0 && o.handshake == 0 {
+		return fmt.Errorf("-split-brain-after requires -handshake-port")
+	}
+
+	var observers []observer
+	var posted *eventObserver
+	if *events {
+		pod, err := podName()
+		if err != nil {
+			return err
+		}
+		if posted, err = newEventObserver(ctx, o.podNamespace(), pod); err != nil {
+			return err
+		}
+		observers = append(observers, posted)
+	}
+	if *configMap != "" {
+		client, err := kube.InClusterClient()
+		if err != nil {
+			return err
+		}
+		observers = append(observers, newConfigMapObserver(ctx, client, o.podNamespace(), *configMap, leading))
+	}
+	if *annotate {
+		pod, err := podName()
+		if err != nil {
+			return err
+		}
+		client, err := kube.InClusterClient()
+		if err != nil {
+			return err
+		}
+		observers = append(observers, newAnnotationObserver(ctx, client, o.podNamespace(), pod))
+	}
+	if *auditFile != "" {
+		obs, err := newAuditObserver(*auditFile)
+		if err != nil {
+			return err
+		}
+		observers = append(observers, obs)
+	}
+	if notify.url != "" {
+		obs, err := notify.observer(ctx)
+		if err != nil {
+			return err
+		}
+		observers = append(observers, obs)
+	}
+	if publish.url != "" {
+		if publish.subject == "" {
+			publish.subject = "peer-finder." + o.podNamespace() + "." + o.service
+		}
+		obs, err := publish.observer(ctx)
+		if err != nil {
+			return err
+		}
+		observers = append(observers, obs)
+	}
+	if len(produce.brokers) > 0 {
+		obs, err := produce.observer(ctx)
+		if err != nil {
+			return err
+		}
+		observers = append(observers, obs)
+	}
+	hooks.observers = observers
+	var agree *barrier
+	if *barrierFlag {
+		pod, err := podName()
+		if err != nil {
+			return err
+		}
+		client, err := kube.InClusterClient()
+		if err != nil {
+			return err
+		}
+		agree = &barrier{client: client, namespace: o.podNamespace(), pod: pod}
+	}
+	var ready *readinessGate
+	if *gate != "" {
+		pod, err := podName()
+		if err != nil {
+			return err
+		}
+		client, err := kube.InClusterClient()
+		if err != nil {
+			return err
+		}
+		ready = &readinessGate{client: client, namespace: o.podNamespace(), pod: pod, condition: corev1.PodConditionType(*gate)}
+	}
+
+	onChange, err := onChangeFlag.hook()
+	if err != nil {
+		return err
+	}
+	onStart, err := onStartFlag.hook()
+	if err != nil {
+		return err
+	}
+	onAdded, err := onAddedFlag.hook()
+	if err != nil {
+		return err
+	}
+	onRemoved, err := onRemovedFlag.hook()
+	if err != nil {
+		return err
+	}
+	onCheck, err := onCheckFlag.hook()
+	if err != nil {
+		return err
+	}
+	onStop, err := onStopFlag.hook()
+	if err != nil {
+		return err
+	}
+	onScaleDown, err := onScaleDownFlag.hook()
+	if err != nil {
+		return err
+	}
+	onSplitBrain, err := onSplitBrainFlag.hook()
+	if err != nil {
+		return err
+	}
+	scale := &scaleDown{}
+	if onScaleDown != nil {
+		pod, err := podName()
+		if err != nil {
+			return err
+		}
+		if scale, err = newScaleDown(ctx, o.podNamespace(), pod); err != nil {
+			return err
+		}
+	}
+	render, err := out.renderer()
+	if err != nil {
+		return err
+	}
+	if err := hooks.checkOutput(&out); err != nil {
+		return err
+	}
+	outputs, err := files.load(render)
+	if err != nil {
+		return err
+	}
+	var child *supervisor
+	if len(supervise) > 0 && *once {
+		return fmt.Errorf("-once cannot be used with -supervise")
+	}
+	if len(supervise) > 0 {
+		if child, err = newSupervisor(supervise, *reload, *reloadSignal); err != nil {
+			return err
+		}
+	}
+	perPeer := onAdded != nil || onRemoved != nil
+	if onChange == nil && onStart == nil && !perPeer && child == nil && outputs.empty() {
+		return fmt.Errorf("incomplete args, require -on-change and/or -on-start, -on-peer-added, -on-peer-removed, -supervise, -template or -write-peers-to")
+	}
+
+	pf, err := o.peerFinder(ctx)
+	if err != nil {
+		return err
+	}
+	if probes.resolver, err = o.resolver(); err != nil {
+		return err
+	}
+	if err := probes.serve(ctx, pf); err != nil {
+		return err
+	}
+	if err := profiling.serve(ctx); err != nil {
+		return err
+	}
+	// env returns the environment of the hooks for u.
+	env := func(u peerfinder.Update) []string {
+		return seedEnv(hookEnv(u, pf.Service()), &u, *seedCount)
+	}
+	split := &splitBrain{}
+	if *splitAfter > 0 {
+		split = &splitBrain{port: o.handshake, after: *splitAfter, period: *splitPeriod, self: pf.Self(), events: posted}
+		split.start(ctx)
+	}
+	if onStart == nil && onChange != nil {
+		slog.Info("No on-start supplied, on-change will be applied on start", "hook", onChange)
+	}
+
+	// The hook running when the context is cancelled is left to complete: the
+	// loop only ends once the update channel is closed.
+	pf.Start(ctx)
+	defer pf.Stop()
+	var last *peerfinder.Update
+	var exited chan error
+	defer func() {
+		// However the loop ended, the supervised program is stopped, unless
+		// it exited itself.
+		if exited == nil {
+			return
+		}
+		if err := child.stop(); err != nil {
+			slog.Warn("Supervised program exited", "argv", child.argv, "err", err)
+		}
+	}()
+	var startup <-chan time.Time
+	if *startupTimeout > 0 {
+		timer := time.NewTimer(*startupTimeout)
+		defer timer.Stop()
+		startup = timer.C
+	}
+	// rejected is the update on-change-check failed for, or the peers did
+	// not agree on with -barrier, checked again when retry fires.
+	var rejected *peerfinder.Update
+	var retry <-chan time.Time
+	for done := false; !done; {
+		var u peerfinder.Update
+		select {
+		case <-startup:
+			return startupTimeoutError(*startupTimeout, pf.Self())
+		case next, ok := <-pf.Updates():
+			if !ok {
+				done = true
+				continue
+			}
+			u = next
+			if rejected != nil {
+				// Nothing of the rejected update was applied.
+				u = rebase(u, last)
+			}
+		case <-retry:
+			u = *rejected
+		case n := <-scale.replicas:
+			if !scale.scaled(n) {
+				continue
+			}
+			in := ""
+			if last != nil {
+				if in, err = render(*last); err != nil {
+					return err
+				}
+			}
+			if err := fatal(onScaleDown.run(ctx, in, seedEnv(scaleDownEnv(last, pf.Service(), n), last, *seedCount))); err != nil {
+				return err
+			}
+			continue
+		case divergent := <-split.detected:
+			if onSplitBrain == nil || last == nil {
+				continue
+			}
+			in, err := render(*last)
+			if err != nil {
+				return err
+			}
+			if err := fatal(onSplitBrain.run(ctx, in, seedEnv(splitBrainEnv(*last, pf.Service(), divergent), last, *seedCount))); err != nil {
+				return err
+			}
+			continue
+		case err := <-exited:
+			slog.Warn("Supervised program exited", "argv", child.argv, "err", err)
+			exited = nil
+			return &exitCodeError{exitCode(err), fmt.Errorf("supervised program exited")}
+		}
+		if *seedCount > 0 {
+			u = seedsOf(u, *seedCount, last)
+			if !seedsChanged(u, last) {
+				// Only peers beyond the seeds changed.
+				rejected, retry = nil, nil
+				continue
+			}
+		}
+		in, err := render(u)
+		if err != nil {
+			return err
+		}
+		if agree != nil {
+			if err := agree.converged(ctx, u); err != nil {
+				slog.Info("Waiting for all the peers to agree on the membership", "retry", barrierRetry, "err", err)
+				rejected, retry = &u, time.After(barrierRetry)
+				continue
+			}
+		}
+		if onCheck != nil && !(u.Initial && onStart != nil) {
+			if err := onCheck.check(in, env(u)); err != nil {
+				slog.Warn("on-change-check failed, checking again later", "retry", *checkRetry, "err", err)
+				rejected, retry = &u, time.After(*checkRetry)
+				continue
+			}
+		}
+		rejected, retry = nil, nil
+		for _, obs := range observers {
+			obs.applying(last, u)
+		}
+		if err := outputs.write(u); err != nil {
+			return err
+		}
+		h := onChange
+		if u.Initial && onStart != nil {
+			h = onStart
+		}
+		var hookErr error
+		if h != nil {
+			hookErr = h.run(ctx, in, env(u))
+			if err := fatal(hookErr); err != nil {
+				return err
+			}
+		}
+		ready.applied(ctx, u, hookErr)
+		if !u.Initial {
+			if err := runPerPeer(ctx, onAdded, u.Added, env(u)); err != nil {
+				return err
+			}
+			if err := runPerPeer(ctx, onRemoved, u.Removed, env(u)); err != nil {
+				return err
+			}
+		}
+		last = &u
+		startup = nil
+		split.applied(u)
+		probes.setPeers(u.Peers)
+		// on-start has completed.
+		probes.setReady()
+		switch {
+		case *once:
+			done = true
+		case child != nil && u.Initial:
+			if err := child.start(); err != nil {
+				return err
+			}
+			exited = child.exited
+		case child != nil:
+			if err := child.reload(); err != nil {
+				return err
+			}
+		case onChange == nil && !perPeer && (onStart != nil || outputs.empty()):
+			// Like an init container only running on-start, there
+			// is nothing left to do. Files alone are written
+			// again on every change.
+			done = true
+		}
+	}
+	// There is nothing to clean up if no hook ever ran. The supervised
+	// program is still running, so that the hook can tell it to leave.
+	if ctx.Err() != nil && onStop != nil && last != nil {
+		in, err := render(*last)
+		if err != nil {
+			return err
+		}
+		// ctx is already cancelled, on-stop is retried all the same.
+		if err := fatal(onStop.run(context.Background(), in, env(*last))); err != nil {
+			return err
+		}
+	}
+	slog.Info("Peer finder exiting")
+	return nil
+}
+
+// rebase returns u with its added and removed peers relative to base instead,
+// the last update applied, nil if none was.
+func rebase(u peerfinder.Update, base *peerfinder.Update) peerfinder.Update {
+	if base == nil {
+		u.Added, u.Removed, u.Initial = u.Peers, nil, true
+		return u
+	}
+	old, new := sets.NewString(base.Peers...), sets.NewString(u.Peers...)
+	u.Added, u.Removed = nil, nil
+	for _, p := range u.Peers {
+		if !old.Has(p) {
+			u.Added = append(u.Added, p)
+		}
+	}
+	for _, p := range base.Peers {
+		if !new.Has(p) {
+			u.Removed = append(u.Removed, p)
+		}
+	}
+	u.Initial = false
+	return u
+}
+
+// runPerPeer runs h, if not nil, once for each of peers, until it fails for
+// good.
+func runPerPeer(ctx context.Context, h hookList, peers []string, env []string) error {
+	if h == nil {
+		return nil
+	}
+	for _, p := range peers {
+		if err := fatal(h.run(ctx, p, env, p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
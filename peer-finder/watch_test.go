@@ -0,0 +1,48 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestRebase(t *testing.T) {
+	base := &peerfinder.Update{Peers: []string{"a", "b"}}
+	cases := []struct {
+		name            string
+		base            *peerfinder.Update
+		u               peerfinder.Update
+		added, removed  []string
+		expectedInitial bool
+	}{
+		{"none applied", nil, peerfinder.Update{Peers: []string{"a", "c"}, Added: []string{"c"}}, []string{"a", "c"}, nil, true},
+		{"applied", base, peerfinder.Update{Peers: []string{"a", "c"}, Added: []string{"c"}}, []string{"c"}, []string{"b"}, false},
+		{"unchanged", base, peerfinder.Update{Peers: []string{"a", "b"}, Removed: []string{"c"}}, nil, nil, false},
+	}
+	for _, c := range cases {
+		u := rebase(c.u, c.base)
+		if !reflect.DeepEqual(u.Added, c.added) || !reflect.DeepEqual(u.Removed, c.removed) {
+			t.Errorf("%s: expected added %v and removed %v, got %v and %v", c.name, c.added, c.removed, u.Added, u.Removed)
+		}
+		if u.Initial != c.expectedInitial {
+			t.Errorf("%s: expected initial %v, got %v", c.name, c.expectedInitial, u.Initial)
+		}
+	}
+}
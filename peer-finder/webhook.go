@@ -0,0 +1,188 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+// signatureHeader is the header of the HMAC-SHA256 of the webhook payloads.
+const signatureHeader = "X-Peer-Finder-Signature"
+
+// webhookQueue is the count of notifications waiting to be delivered beyond
+// which new ones are dropped.
+const webhookQueue = 64
+
+// webhookOptions are the flags of the webhook notified of the changes of the
+// peers.
+type webhookOptions struct {
+	url          string
+	secretFile   string
+	timeout      time.Duration
+	retries      int
+	retryBackoff time.Duration
+}
+
+func (o *webhookOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "notify-url", "", "A URL a JSON document of each change of the peers is POSTed to, with the old and new peers, those added and removed and the time of the change.")
+	fs.StringVar(&o.secretFile, "notify-secret-file", "", "A file holding the key the notifications are signed with, their HMAC-SHA256 being sent in the "+signatureHeader+" header as sha256=<hex>.")
+	fs.DurationVar(&o.timeout, "notify-timeout", 10*time.Second, "How long to wait for the response to a notification.")
+	fs.IntVar(&o.retries, "notify-retries", 5, "How many times a notification is retried after a network error or a 5xx or 429 response.")
+	fs.DurationVar(&o.retryBackoff, "notify-retry-backoff", 1*time.Second, "How long to wait before retrying a notification the first time, the wait doubling after each retry.")
+}
+
+// notification is the payload POSTed to the webhook, published to NATS and
+// produced to Kafka.
+type notification struct {
+	Time    time.Time `json:"time" avro:"time"`
+	Self    string    `json:"self" avro:"self"`
+	Old     []string  `json:"old" avro:"old"`
+	New     []string  `json:"new" avro:"new"`
+	Added   []string  `json:"added" avro:"added"`
+	Removed []string  `json:"removed" avro:"removed"`
+}
+
+// newNotification returns the notification of the change from base, nil for
+// none, to u.
+func newNotification(base *peerfinder.Update, u peerfinder.Update) notification {
+	n := notification{Time: u.Time, Self: u.Self, New: u.Peers, Added: u.Added, Removed: u.Removed}
+	if base != nil {
+		n.Old = base.Peers
+	}
+	// Lists are always arrays, never null.
+	for _, l := range []*[]string{&n.Old, &n.New, &n.Added, &n.Removed} {
+		if *l == nil {
+			*l = []string{}
+		}
+	}
+	return n
+}
+
+// webhookObserver POSTs the changes of the peers to a URL. They are delivered
+// in order in the background, so that slow webhooks don't delay hooks.
+type webhookObserver struct {
+	opts   webhookOptions
+	key    []byte
+	client *http.Client
+	queue  chan []byte
+}
+
+// observer returns a webhookObserver delivering notifications until ctx is
+// cancelled.
+func (o *webhookOptions) observer(ctx context.Context) (*webhookObserver, error) {
+	w := &webhookObserver{opts: *o, client: &http.Client{Timeout: o.timeout}, queue: make(chan []byte, webhookQueue)}
+	if o.secretFile != "" {
+		key, err := os.ReadFile(o.secretFile)
+		if err != nil {
+			return nil, err
+		}
+		w.key = bytes.TrimSpace(key)
+	}
+	go w.run(ctx)
+	return w, nil
+}
+
+func (w *webhookObserver) applying(base *peerfinder.Update, u peerfinder.Update) {
+	b, err := json.Marshal(newNotification(base, u))
+	if err != nil {
+		slog.Warn("Failed to encode notification", "err", err)
+		return
+	}
+	select {
+	case w.queue <- b:
+	default:
+		slog.Warn("Dropping notification, too many are pending", "url", w.opts.url)
+	}
+}
+
+func (w *webhookObserver) hookRan(*hook, error) {}
+
+// run delivers the queued notifications until ctx is cancelled.
+func (w *webhookObserver) run(ctx context.Context) {
+	for {
+		select {
+		case b := <-w.queue:
+			w.deliver(ctx, b)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver POSTs body, retrying on failures that may be temporary.
+func (w *webhookObserver) deliver(ctx context.Context, body []byte) {
+	backoff := w.opts.retryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= w.opts.retries {
+			slog.Error("Failed to notify webhook", "url", w.opts.url, "attempts", attempt+1, "err", err)
+			return
+		}
+		slog.Warn("Failed to notify webhook, retrying", "url", w.opts.url, "in", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// post POSTs body once, returning whether it may be retried if it failed.
+func (w *webhookObserver) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "peer-finder")
+	if w.key != nil {
+		req.Header.Set(signatureHeader, "sha256="+sign(w.key, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, errors.New(resp.Status)
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body with key.
+func sign(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
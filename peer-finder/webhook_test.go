@@ -0,0 +1,99 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/contrib/peer-finder/pkg/peerfinder"
+)
+
+func TestWebhookObserver(t *testing.T) {
+	received := make(chan notification)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if sig := r.Header.Get(signatureHeader); sig != "sha256="+sign([]byte("secret"), body) {
+			t.Errorf("invalid signature %q", sig)
+		}
+		// Fail the first attempt to check retries.
+		if attempts++; attempts == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var n notification
+		if err := json.Unmarshal(body, &n); err != nil {
+			t.Errorf("invalid notification %q: %v", body, err)
+		}
+		received <- n
+	}))
+	defer server.Close()
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	o := &webhookOptions{url: server.URL, secretFile: secret, timeout: time.Second, retries: 1, retryBackoff: time.Millisecond}
+	w, err := o.observer(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	base := &peerfinder.Update{Peers: []string{"a"}}
+	w.applying(nil, *base)
+	w.applying(base, peerfinder.Update{Peers: []string{"a", "b"}, Added: []string{"b"}})
+	for _, expected := range []notification{
+		{Old: []string{}, New: []string{"a"}, Added: []string{}, Removed: []string{}},
+		{Old: []string{"a"}, New: []string{"a", "b"}, Added: []string{"b"}, Removed: []string{}},
+	} {
+		select {
+		case n := <-received:
+			if !reflect.DeepEqual(n, expected) {
+				t.Errorf("expected %+v, got %+v", expected, n)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %+v", expected)
+		}
+	}
+}
+
+func TestNotificationLists(t *testing.T) {
+	// The previous update had no peers, e.g. with -self-optional.
+	b, err := json.Marshal(newNotification(&peerfinder.Update{}, peerfinder.Update{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var lists map[string]any
+	if err := json.Unmarshal(b, &lists); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, key := range []string{"old", "new", "added", "removed"} {
+		if _, ok := lists[key].([]any); !ok {
+			t.Errorf("expected %s to be an array, got %v", key, lists[key])
+		}
+	}
+}